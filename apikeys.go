@@ -0,0 +1,152 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/gorilla/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	apiKeyHeader = "X-API-Key"
+	apiKeyPrefix = "rttm_"
+
+	ScopeTTS = "tts"
+)
+
+type contextKey int
+
+const apiKeyContextKey contextKey = 0
+
+// APIKey grants a client access to the API. Only a hash of the key is
+// stored; the key itself is shown once when it is created.
+type APIKey struct {
+	Id        bson.ObjectId `bson:"_id"`
+	Hash      string
+	Prefix    string
+	Owner     string
+	Scopes    []string
+	Revoked   bool
+	RevokedAt time.Time `bson:",omitempty"`
+	CreatedAt time.Time
+}
+
+func hashAPIKey(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return hex.EncodeToString(sum[:])
+}
+
+// CreateAPIKey stores a new key for owner and returns it along with the
+// plain text key.
+func CreateAPIKey(owner string, scopes []string) (*APIKey, string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return nil, "", err
+	}
+
+	key := apiKeyPrefix + hex.EncodeToString(b)
+
+	apiKey := &APIKey{
+		Id:        bson.NewObjectId(),
+		Hash:      hashAPIKey(key),
+		Prefix:    key[:len(apiKeyPrefix)+6],
+		Owner:     owner,
+		Scopes:    scopes,
+		CreatedAt: time.Now(),
+	}
+
+	if err := APIKeyCollection.Insert(apiKey); err != nil {
+		return nil, "", err
+	}
+
+	return apiKey, key, nil
+}
+
+// GetAPIKey returns the active key matching the plain text key.
+func GetAPIKey(key string) (*APIKey, error) {
+	apiKey := &APIKey{}
+	err := APIKeyCollection.Find(bson.M{"hash": hashAPIKey(key), "revoked": false}).One(&apiKey)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return apiKey, nil
+}
+
+func FindAPIKeys() ([]APIKey, error) {
+	var apiKeys []APIKey
+	err := APIKeyCollection.Find(nil).Sort("createdat").All(&apiKeys)
+
+	return apiKeys, err
+}
+
+func RevokeAPIKey(id string) error {
+	if bson.IsObjectIdHex(id) == false {
+		return fmt.Errorf("Invalid Id: %s", id)
+	}
+
+	return APIKeyCollection.UpdateId(bson.ObjectIdHex(id), bson.M{"$set": bson.M{
+		"revoked":   true,
+		"revokedat": time.Now(),
+	}})
+}
+
+func (k *APIKey) HasScope(scope string) bool {
+	for _, s := range k.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
+
+// RequestAPIKey returns the key that authenticated r, if any.
+func RequestAPIKey(r *http.Request) *APIKey {
+	if apiKey, ok := context.Get(r, apiKeyContextKey).(*APIKey); ok {
+		return apiKey
+	}
+
+	return nil
+}
+
+// RequireAPIKey only lets requests carrying an active key with scope through
+// to h. The key is read from the X-API-Key header or a Bearer Authorization
+// header.
+func RequireAPIKey(scope string, h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		key := r.Header.Get(apiKeyHeader)
+
+		if auth := r.Header.Get("Authorization"); key == "" && strings.HasPrefix(auth, "Bearer ") {
+			key = strings.TrimSpace(strings.TrimPrefix(auth, "Bearer "))
+		}
+
+		if key == "" {
+			renderJSONError(w, http.StatusUnauthorized, "API key required")
+			return
+		}
+
+		apiKey, err := GetAPIKey(key)
+		if err != nil {
+			log.Println("Invalid API key", err)
+			renderJSONError(w, http.StatusUnauthorized, "Invalid API key")
+			return
+		}
+
+		if !apiKey.HasScope(scope) {
+			renderJSONError(w, http.StatusForbidden, "API key is missing scope "+scope)
+			return
+		}
+
+		context.Set(r, apiKeyContextKey, apiKey)
+		h(w, r)
+	}
+}
@@ -0,0 +1,37 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestRequireAPIKeyMissing(t *testing.T) {
+	called := false
+	handler := RequireAPIKey(ScopeTTS, func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	r, _ := http.NewRequest("POST", "/api/rttm", nil)
+	w := httptest.NewRecorder()
+
+	handler(w, r)
+
+	if called || w.Code != http.StatusUnauthorized {
+		t.Errorf("Expected 401 without calling handler, got %d", w.Code)
+	}
+}
+
+func TestAPIKeyHasScope(t *testing.T) {
+	apiKey := &APIKey{Scopes: []string{ScopeTTS}}
+
+	if !apiKey.HasScope(ScopeTTS) || apiKey.HasScope("admin") {
+		t.Error("Unexpected scopes")
+	}
+}
+
+func TestHashAPIKey(t *testing.T) {
+	if hashAPIKey("rttm_a") == hashAPIKey("rttm_b") || len(hashAPIKey("rttm_a")) != 64 {
+		t.Error("Unexpected API key hash")
+	}
+}
@@ -0,0 +1,25 @@
+package audio
+
+import (
+	"fmt"
+	"time"
+)
+
+// Result is a single audio file assembled from several chunks.
+type Result struct {
+	Audio    []byte
+	Duration time.Duration
+}
+
+// Join assembles chunks encoded as contentType into a single file, with
+// silence inserted between consecutive chunks.
+func Join(contentType string, chunks [][]byte, silence time.Duration) (*Result, error) {
+	switch contentType {
+	case "audio/mpeg":
+		return JoinMP3(chunks, silence)
+	case "audio/wav":
+		return JoinWAV(chunks, silence)
+	}
+
+	return nil, fmt.Errorf("audio: unsupported content type %s", contentType)
+}
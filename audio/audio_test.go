@@ -0,0 +1,179 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"testing"
+	"time"
+)
+
+// MPEG-2 Layer III, 32kbps, 22050Hz, mono: 104 byte frames of 576 samples.
+const testHeader = 0xfff340c0
+
+var testFrameDuration = 576 * time.Second / 22050
+
+func testMP3(frames int, id3 bool, xing bool) []byte {
+	var buf bytes.Buffer
+
+	if id3 {
+		buf.Write([]byte{'I', 'D', '3', 3, 0, 0, 0, 0, 0, 10})
+		buf.Write(make([]byte, 10))
+	}
+
+	if xing {
+		frame := make([]byte, 104)
+		binary.BigEndian.PutUint32(frame, testHeader)
+		copy(frame[4+9:], "Xing")
+		buf.Write(frame)
+	}
+
+	for i := 0; i < frames; i++ {
+		frame := bytes.Repeat([]byte{0x55}, 104)
+		binary.BigEndian.PutUint32(frame, testHeader)
+		buf.Write(frame)
+	}
+
+	if id3 {
+		tag := make([]byte, 128)
+		copy(tag, "TAG")
+		buf.Write(tag)
+	}
+
+	return buf.Bytes()
+}
+
+func TestParseMP3(t *testing.T) {
+	mp3, err := ParseMP3(testMP3(10, true, true))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(mp3.Frames) != 10 {
+		t.Errorf("Expected 10 frames, got %d", len(mp3.Frames))
+	}
+
+	if mp3.Duration != 10*testFrameDuration {
+		t.Errorf("Unexpected duration %v", mp3.Duration)
+	}
+}
+
+func TestParseMP3Invalid(t *testing.T) {
+	if _, err := ParseMP3([]byte("not an mp3")); err != ErrNoFrames {
+		t.Errorf("Expected ErrNoFrames, got %v", err)
+	}
+}
+
+func TestJoinMP3(t *testing.T) {
+	result, err := Join("audio/mpeg", [][]byte{testMP3(10, true, true), testMP3(5, true, false)}, 0)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if binary.BigEndian.Uint32(result.Audio) != testHeader|1<<16 {
+		t.Fatalf("Expected file to start with a frame header, got % x", result.Audio[:4])
+	}
+
+	if !bytes.Equal(result.Audio[13:17], []byte("Info")) {
+		t.Errorf("Expected Info tag, got %q", result.Audio[13:17])
+	}
+
+	frames := binary.BigEndian.Uint32(result.Audio[21:25])
+	size := binary.BigEndian.Uint32(result.Audio[25:29])
+
+	if frames != 15 || int(size) != len(result.Audio) || len(result.Audio) != 16*104 {
+		t.Errorf("Unexpected Info header frames=%d bytes=%d length=%d", frames, size, len(result.Audio))
+	}
+
+	if result.Duration != 15*testFrameDuration {
+		t.Errorf("Unexpected duration %v", result.Duration)
+	}
+
+	mp3, err := ParseMP3(result.Audio)
+
+	if err != nil || len(mp3.Frames) != 15 {
+		t.Errorf("Expected joined file to parse back into 15 frames, got %v", err)
+	}
+}
+
+func TestJoinMP3Silence(t *testing.T) {
+	silence := 10 * testFrameDuration
+	result, err := JoinMP3([][]byte{testMP3(2, false, false), testMP3(2, false, false), testMP3(2, false, false)}, silence)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Duration != 26*testFrameDuration {
+		t.Errorf("Unexpected duration %v", result.Duration)
+	}
+
+	silent := result.Audio[3*104+4 : 4*104]
+
+	if !bytes.Equal(silent, make([]byte, 100)) {
+		t.Error("Expected an empty frame after the first chunk")
+	}
+}
+
+func testWAV(samples []byte) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString("RIFF")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xffffffff))
+	buf.WriteString("WAVEfmt ")
+	binary.Write(&buf, binary.LittleEndian, uint32(16))
+	// PCM, mono, 8000Hz, 16000 bytes/s, block align 2, 16 bits
+	binary.Write(&buf, binary.LittleEndian, []uint16{1, 1})
+	binary.Write(&buf, binary.LittleEndian, []uint32{8000, 16000})
+	binary.Write(&buf, binary.LittleEndian, []uint16{2, 16})
+	buf.WriteString("data")
+	binary.Write(&buf, binary.LittleEndian, uint32(0xffffffff))
+	buf.Write(samples)
+
+	return buf.Bytes()
+}
+
+func TestJoinWAV(t *testing.T) {
+	a := bytes.Repeat([]byte{1}, 16000)
+	b := bytes.Repeat([]byte{2}, 8000)
+
+	result, err := Join("audio/wav", [][]byte{testWAV(a), testWAV(b)}, 500*time.Millisecond)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if result.Duration != 2*time.Second {
+		t.Errorf("Unexpected duration %v", result.Duration)
+	}
+
+	wav, err := ParseWAV(result.Audio)
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := append(append(a, make([]byte, 8000)...), b...)
+
+	if !bytes.Equal(wav.Data, expected) {
+		t.Error("Joined samples do not match")
+	}
+
+	if int(binary.LittleEndian.Uint32(result.Audio[4:8])) != len(result.Audio)-8 {
+		t.Error("Unexpected RIFF size")
+	}
+}
+
+func TestJoinWAVZeroBlockAlign(t *testing.T) {
+	chunk := testWAV(make([]byte, 100))
+	binary.LittleEndian.PutUint16(chunk[32:34], 0)
+
+	if _, err := ParseWAV(chunk); err != ErrInvalidWAV {
+		t.Errorf("Expected ErrInvalidWAV, got %v", err)
+	}
+
+	if _, err := Join("audio/wav", [][]byte{chunk, chunk}, time.Second); err != ErrInvalidWAV {
+		t.Errorf("Expected ErrInvalidWAV, got %v", err)
+	}
+}
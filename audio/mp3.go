@@ -0,0 +1,310 @@
+// Package audio joins synthesized speech chunks into a single playable file.
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var ErrNoFrames = errors.New("audio: no MPEG audio frames found")
+
+var bitrates = [2][3][16]int{
+	// MPEG-1 Layer I, II, III
+	{
+		{0, 32, 64, 96, 128, 160, 192, 224, 256, 288, 320, 352, 384, 416, 448, 0},
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 384, 0},
+		{0, 32, 40, 48, 56, 64, 80, 96, 112, 128, 160, 192, 224, 256, 320, 0},
+	},
+	// MPEG-2 and MPEG-2.5 Layer I, II, III
+	{
+		{0, 32, 48, 56, 64, 80, 96, 112, 128, 144, 160, 176, 192, 224, 256, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+		{0, 8, 16, 24, 32, 40, 48, 56, 64, 80, 96, 112, 128, 144, 160, 0},
+	},
+}
+
+var sampleRates = map[int][3]int{
+	mpeg1:  {44100, 48000, 32000},
+	mpeg2:  {22050, 24000, 16000},
+	mpeg25: {11025, 12000, 8000},
+}
+
+const (
+	mpeg25 = 0
+	mpeg2  = 2
+	mpeg1  = 3
+
+	layer3 = 1
+	layer2 = 2
+	layer1 = 3
+
+	channelMono = 3
+)
+
+// frameHeader is a decoded 4 byte MPEG audio frame header.
+type frameHeader uint32
+
+func (h frameHeader) version() int      { return int(h>>19) & 3 }
+func (h frameHeader) layer() int        { return int(h>>17) & 3 }
+func (h frameHeader) protected() bool   { return (h>>16)&1 == 0 }
+func (h frameHeader) bitrateIndex() int { return int(h>>12) & 15 }
+func (h frameHeader) rateIndex() int    { return int(h>>10) & 3 }
+func (h frameHeader) padding() int      { return int(h>>9) & 1 }
+func (h frameHeader) channelMode() int  { return int(h>>6) & 3 }
+
+func (h frameHeader) valid() bool {
+	return h>>21 == 0x7ff &&
+		h.version() != 1 &&
+		h.layer() != 0 &&
+		h.bitrateIndex() != 0 && h.bitrateIndex() != 15 &&
+		h.rateIndex() != 3
+}
+
+func (h frameHeader) bitrate() int {
+	table := 1
+	if h.version() == mpeg1 {
+		table = 0
+	}
+
+	return bitrates[table][layer1-h.layer()][h.bitrateIndex()] * 1000
+}
+
+func (h frameHeader) sampleRate() int {
+	return sampleRates[h.version()][h.rateIndex()]
+}
+
+func (h frameHeader) samples() int {
+	switch {
+	case h.layer() == layer1:
+		return 384
+	case h.layer() == layer3 && h.version() != mpeg1:
+		return 576
+	}
+
+	return 1152
+}
+
+func (h frameHeader) size() int {
+	if h.layer() == layer1 {
+		return (12*h.bitrate()/h.sampleRate() + h.padding()) * 4
+	}
+
+	return h.samples()/8*h.bitrate()/h.sampleRate() + h.padding()
+}
+
+func (h frameHeader) duration() time.Duration {
+	return time.Duration(h.samples()) * time.Second / time.Duration(h.sampleRate())
+}
+
+// sideInfoSize is the offset of the Xing/Info tag from the end of the header.
+func (h frameHeader) sideInfoSize() int {
+	size := 0
+
+	if h.protected() {
+		size = 2
+	}
+
+	mono := h.channelMode() == channelMono
+
+	switch {
+	case h.version() == mpeg1 && mono:
+		size += 17
+	case h.version() == mpeg1:
+		size += 32
+	case mono:
+		size += 9
+	default:
+		size += 17
+	}
+
+	return size
+}
+
+// MP3 is a parsed MPEG audio stream without any ID3 or Xing/Info headers.
+type MP3 struct {
+	Frames   [][]byte
+	Duration time.Duration
+}
+
+// ParseMP3 extracts audio frames from data, skipping ID3v1/ID3v2 tags,
+// Xing/Info/VBRI headers and any garbage between frames.
+func ParseMP3(data []byte) (*MP3, error) {
+	data = stripID3v1(data)
+	mp3 := &MP3{}
+	pos := skipID3v2(data)
+
+	for pos+4 <= len(data) {
+		h := frameHeader(binary.BigEndian.Uint32(data[pos:]))
+
+		if !h.valid() || pos+h.size() > len(data) || h.size() < 4 {
+			pos++
+			continue
+		}
+
+		frame := data[pos : pos+h.size()]
+		pos += len(frame)
+
+		if len(mp3.Frames) == 0 && isInfoFrame(h, frame) {
+			continue
+		}
+
+		mp3.Frames = append(mp3.Frames, frame)
+		mp3.Duration += h.duration()
+	}
+
+	if len(mp3.Frames) == 0 {
+		return nil, ErrNoFrames
+	}
+
+	return mp3, nil
+}
+
+// JoinMP3 concatenates the frames of every chunk, inserting silence between
+// chunks, and prefixes the result with a single Info header describing the
+// total number of frames and bytes so that players report the right duration.
+func JoinMP3(chunks [][]byte, silence time.Duration) (*Result, error) {
+	var frames [][]byte
+	var duration time.Duration
+	var first frameHeader
+
+	for i, chunk := range chunks {
+		mp3, err := ParseMP3(chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			first = frameHeader(binary.BigEndian.Uint32(mp3.Frames[0]))
+		} else if silence > 0 && first.layer() == layer3 {
+			for _, frame := range silentFrames(first, silence) {
+				frames = append(frames, frame)
+				duration += first.duration()
+			}
+		}
+
+		frames = append(frames, mp3.Frames...)
+		duration += mp3.Duration
+	}
+
+	if len(frames) == 0 {
+		return nil, ErrNoFrames
+	}
+
+	size := 0
+	vbr := false
+
+	for _, frame := range frames {
+		size += len(frame)
+
+		if frameHeader(binary.BigEndian.Uint32(frame)).bitrateIndex() != first.bitrateIndex() {
+			vbr = true
+		}
+	}
+
+	info := infoFrame(first, len(frames), size, vbr)
+
+	buf := bytes.NewBuffer(make([]byte, 0, size+len(info)))
+	buf.Write(info)
+
+	for _, frame := range frames {
+		buf.Write(frame)
+	}
+
+	return &Result{Audio: buf.Bytes(), Duration: duration}, nil
+}
+
+func isInfoFrame(h frameHeader, frame []byte) bool {
+	offset := 4 + h.sideInfoSize()
+
+	if len(frame) >= offset+4 {
+		tag := string(frame[offset : offset+4])
+
+		if tag == "Xing" || tag == "Info" {
+			return true
+		}
+	}
+
+	return len(frame) >= 40 && string(frame[36:40]) == "VBRI"
+}
+
+// infoFrame builds an empty frame carrying a Xing (VBR) or Info (CBR) tag
+// for a stream of frames totalling size bytes, excluding the tag itself.
+func infoFrame(h frameHeader, frames int, size int, vbr bool) []byte {
+	// Clear CRC protection and padding, and use a bitrate large enough to
+	// hold the tag.
+	h = h | 1<<16
+	h = h &^ (1 << 9)
+
+	needed := 4 + h.sideInfoSize() + 16
+
+	for h.size() < needed && h.bitrateIndex() < 14 {
+		h = h&^(15<<12) | frameHeader(h.bitrateIndex()+1)<<12
+	}
+
+	frame := make([]byte, h.size())
+	binary.BigEndian.PutUint32(frame, uint32(h))
+
+	tag := "Info"
+	if vbr {
+		tag = "Xing"
+	}
+
+	offset := 4 + h.sideInfoSize()
+	copy(frame[offset:], tag)
+	binary.BigEndian.PutUint32(frame[offset+4:], 0x0003)
+	binary.BigEndian.PutUint32(frame[offset+8:], uint32(frames))
+	binary.BigEndian.PutUint32(frame[offset+12:], uint32(size+len(frame)))
+
+	return frame
+}
+
+// silentFrames returns enough empty frames matching h to fill duration. A
+// Layer III frame whose side info and main data are zero decodes to silence.
+func silentFrames(h frameHeader, duration time.Duration) [][]byte {
+	h = h | 1<<16
+	h = h &^ (1 << 9)
+
+	count := int((duration + h.duration() - 1) / h.duration())
+	frames := make([][]byte, count)
+
+	for i := range frames {
+		frame := make([]byte, h.size())
+		binary.BigEndian.PutUint32(frame, uint32(h))
+		frames[i] = frame
+	}
+
+	return frames
+}
+
+func skipID3v2(data []byte) int {
+	pos := 0
+
+	for len(data)-pos >= 10 && string(data[pos:pos+3]) == "ID3" {
+		flags := data[pos+5]
+		size := int(data[pos+6]&0x7f)<<21 | int(data[pos+7]&0x7f)<<14 |
+			int(data[pos+8]&0x7f)<<7 | int(data[pos+9]&0x7f)
+
+		pos += 10 + size
+
+		// Footer present
+		if flags&0x10 != 0 {
+			pos += 10
+		}
+	}
+
+	if pos > len(data) {
+		return len(data)
+	}
+
+	return pos
+}
+
+func stripID3v1(data []byte) []byte {
+	if len(data) >= 128 && string(data[len(data)-128:len(data)-125]) == "TAG" {
+		return data[:len(data)-128]
+	}
+
+	return data
+}
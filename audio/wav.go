@@ -0,0 +1,114 @@
+package audio
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"time"
+)
+
+var ErrInvalidWAV = errors.New("audio: invalid WAV data")
+
+// WAV is the format and sample data of a PCM RIFF/WAVE file.
+type WAV struct {
+	Format []byte
+	Data   []byte
+}
+
+func (w *WAV) byteRate() int {
+	return int(binary.LittleEndian.Uint32(w.Format[8:12]))
+}
+
+func (w *WAV) blockAlign() int {
+	return int(binary.LittleEndian.Uint16(w.Format[12:14]))
+}
+
+// ParseWAV reads the fmt and data chunks of a RIFF/WAVE file. Streaming
+// encoders such as espeak-ng write placeholder sizes, so a data chunk
+// running past the end of the file is truncated rather than rejected.
+func ParseWAV(data []byte) (*WAV, error) {
+	if len(data) < 12 || string(data[0:4]) != "RIFF" || string(data[8:12]) != "WAVE" {
+		return nil, ErrInvalidWAV
+	}
+
+	wav := &WAV{}
+	pos := 12
+
+	for pos+8 <= len(data) {
+		id := string(data[pos : pos+4])
+		size := int(binary.LittleEndian.Uint32(data[pos+4 : pos+8]))
+		pos += 8
+
+		if size < 0 || pos+size > len(data) {
+			size = len(data) - pos
+		}
+
+		switch id {
+		case "fmt ":
+			wav.Format = data[pos : pos+size]
+		case "data":
+			wav.Data = data[pos : pos+size]
+		}
+
+		pos += size + size%2
+	}
+
+	// Sample frames can't be empty, and silence is sized in whole frames
+	if len(wav.Format) < 16 || wav.Data == nil || wav.blockAlign() == 0 {
+		return nil, ErrInvalidWAV
+	}
+
+	return wav, nil
+}
+
+// JoinWAV concatenates the samples of every chunk under a single header,
+// inserting silence between chunks. All chunks must share the same format.
+func JoinWAV(chunks [][]byte, silence time.Duration) (*Result, error) {
+	var first *WAV
+	var samples bytes.Buffer
+
+	for i, chunk := range chunks {
+		wav, err := ParseWAV(chunk)
+		if err != nil {
+			return nil, err
+		}
+
+		if i == 0 {
+			first = wav
+		} else {
+			if !bytes.Equal(wav.Format, first.Format) {
+				return nil, errors.New("audio: WAV chunks have different formats")
+			}
+
+			gap := int(int64(first.byteRate()) * int64(silence) / int64(time.Second))
+			gap -= gap % first.blockAlign()
+			samples.Write(make([]byte, gap))
+		}
+
+		samples.Write(wav.Data)
+	}
+
+	if first == nil {
+		return nil, ErrInvalidWAV
+	}
+
+	size := samples.Len()
+
+	buf := bytes.NewBuffer(make([]byte, 0, 20+len(first.Format)+8+size))
+	buf.WriteString("RIFF")
+	binary.Write(buf, binary.LittleEndian, uint32(4+8+len(first.Format)+8+size))
+	buf.WriteString("WAVE")
+	buf.WriteString("fmt ")
+	binary.Write(buf, binary.LittleEndian, uint32(len(first.Format)))
+	buf.Write(first.Format)
+	buf.WriteString("data")
+	binary.Write(buf, binary.LittleEndian, uint32(size))
+	buf.Write(samples.Bytes())
+
+	duration := time.Duration(0)
+	if first.byteRate() > 0 {
+		duration = time.Duration(int64(size) * int64(time.Second) / int64(first.byteRate()))
+	}
+
+	return &Result{Audio: buf.Bytes(), Duration: duration}, nil
+}
@@ -0,0 +1,161 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strings"
+	"time"
+
+	"github.com/jpadilla/rttm/services"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const defaultMaxURLsPerMessage = 5
+
+// Batch groups the jobs created from a single SMS or submission so that the
+// requester gets one summary SMS once all of them are finished.
+type Batch struct {
+	Id        bson.ObjectId `bson:"_id"`
+	Phone     string
+	Notified  bool
+	CreatedAt time.Time
+}
+
+// ExtractURLs returns the distinct URLs found in text, in order, up to max.
+// It also reports how many were dropped because of the cap.
+func ExtractURLs(text string, max int) ([]string, int) {
+	var urls []string
+	seen := map[string]bool{}
+	dropped := 0
+
+	for _, word := range strings.Fields(text) {
+		// Links are often wrapped in or followed by punctuation in prose
+		word = strings.TrimLeft(word, "([{<\"'")
+		word = strings.TrimRight(word, ".,;:!?)]}>\"'")
+
+		if !IsValidURL(word) || seen[word] {
+			continue
+		}
+
+		seen[word] = true
+
+		if len(urls) == max {
+			dropped++
+			continue
+		}
+
+		urls = append(urls, word)
+	}
+
+	return urls, dropped
+}
+
+func maxURLsPerMessage() int {
+	return envInt("MAX_URLS_PER_MESSAGE", defaultMaxURLsPerMessage)
+}
+
+// EnqueueJobs stores a job for every url. Several jobs are grouped in a
+// Batch and summarized in a single SMS.
+func EnqueueJobs(urls []string, phone string) ([]*Job, error) {
+	if len(urls) == 1 {
+		job, err := EnqueueJob(urls[0], phone)
+		if err != nil {
+			return nil, err
+		}
+
+		return []*Job{job}, nil
+	}
+
+	batch := &Batch{
+		Id:        bson.NewObjectId(),
+		Phone:     phone,
+		CreatedAt: time.Now(),
+	}
+
+	if err := BatchCollection.Insert(batch); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	jobs := make([]*Job, 0, len(urls))
+
+	for _, url := range urls {
+		job, err := enqueueJob(url, phone, batch.Id)
+		if err != nil {
+			return nil, err
+		}
+
+		jobs = append(jobs, job)
+	}
+
+	return jobs, nil
+}
+
+// finishBatch sends the summary SMS for batchId if every job in it is done
+// or dead. Only one worker sends it.
+func finishBatch(batchId bson.ObjectId) error {
+	pending, err := JobCollection.Find(bson.M{
+		"batch_id": batchId,
+		"state":    bson.M{"$nin": []string{JobDone, JobDead}},
+	}).Count()
+
+	if err != nil || pending > 0 {
+		return err
+	}
+
+	batch := &Batch{}
+	_, err = BatchCollection.Find(bson.M{"_id": batchId, "notified": false}).Apply(mgo.Change{
+		Update:    bson.M{"$set": bson.M{"notified": true}},
+		ReturnNew: true,
+	}, batch)
+
+	if err == mgo.ErrNotFound {
+		return nil
+	}
+
+	if err != nil {
+		return err
+	}
+
+	var jobs []Job
+	if err = JobCollection.Find(bson.M{"batch_id": batchId}).Sort("createdat").All(&jobs); err != nil {
+		return err
+	}
+
+	subscriber, err := GetSubscriber(batch.Phone)
+	if err != nil {
+		return err
+	}
+
+	if subscriber.OptedOut {
+		log.Println("Not notifying unsubscribed", batch.Phone)
+		return nil
+	}
+
+	log.Println("Sending batch summary SMS...")
+	return services.SendSMS(batch.Phone, batchSummary(jobs))
+}
+
+func batchSummary(jobs []Job) string {
+	lines := []string{}
+
+	for i, job := range jobs {
+		if job.State != JobDone || !job.PostId.Valid() || !job.RequestId.Valid() {
+			lines = append(lines, fmt.Sprintf("%d. Sorry, we couldn't read %s", i+1, job.URL))
+			continue
+		}
+
+		post, err := GetPostById(job.PostId)
+		if err != nil {
+			lines = append(lines, fmt.Sprintf("%d. %s", i+1, job.URL))
+			continue
+		}
+
+		// Link through the request, so listens are counted
+		request := &Request{Id: job.RequestId, Post: post}
+		lines = append(lines, fmt.Sprintf("%d. %s\n%s", i+1, SmartTruncate(post.Title, 60, "..."), request.ListenURL()))
+	}
+
+	return strings.Join(lines, "\n")
+}
@@ -0,0 +1,91 @@
+package main
+
+import (
+	"errors"
+	"reflect"
+	"testing"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestExtractURLs(t *testing.T) {
+	urls, dropped := ExtractURLs("See http://a.com/1, http://b.com/2. And (http://c.com/3) http://a.com/1 http://d.com/4", 3)
+	expected := []string{"http://a.com/1", "http://b.com/2", "http://c.com/3"}
+
+	if !reflect.DeepEqual(urls, expected) || dropped != 1 {
+		t.Errorf("Unexpected URLs %q, dropped %d", urls, dropped)
+	}
+}
+
+func TestFinishBatch(t *testing.T) {
+	defer withTestDB(t)()
+
+	phone := "+15555550100"
+
+	// Unsubscribed, so the summary isn't sent through Twilio
+	if err := SetSubscriber(phone, bson.M{"optedout": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	jobs, err := EnqueueJobs([]string{"http://example.com/a", "http://example.com/b"}, phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	notified := func() bool {
+		batch := &Batch{}
+		if err := BatchCollection.FindId(jobs[0].BatchId).One(batch); err != nil {
+			t.Fatal(err)
+		}
+		return batch.Notified
+	}
+
+	if err = jobs[0].SetState(JobDone); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = finishBatch(jobs[0].BatchId); err != nil {
+		t.Fatal(err)
+	}
+
+	if notified() {
+		t.Error("Expected no summary while a job is pending")
+	}
+
+	// The last job dying finishes the batch
+	jobs[1].Attempts = jobs[1].MaxAttempts
+	if err = jobs[1].Fail(errors.New("Timeout")); err != nil {
+		t.Fatal(err)
+	}
+
+	if !notified() {
+		t.Error("Expected the batch to be finished")
+	}
+
+	// Finishing it again is harmless
+	if err = finishBatch(jobs[0].BatchId); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestBatchSummary(t *testing.T) {
+	defer withTestDB(t)()
+
+	post := &Post{Id: bson.NewObjectId(), Title: "Bridges", AudioURL: "https://bucket.example.com/a.mp3"}
+	if err := PostCollection.Insert(post); err != nil {
+		t.Fatal(err)
+	}
+
+	requestId := bson.NewObjectId()
+	jobs := []Job{
+		{URL: "http://example.com/a", State: JobDone, PostId: post.Id, RequestId: requestId},
+		{URL: "http://example.com/b", State: JobDead},
+	}
+
+	expected := "1. Bridges\n" + siteURL() + "/listen/" + requestId.Hex() + ".mp3\n" +
+		"2. Sorry, we couldn't read http://example.com/b"
+
+	if summary := batchSummary(jobs); summary != expected {
+		t.Errorf("Expected\n%s\ngot\n%s", expected, summary)
+	}
+}
@@ -0,0 +1,173 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/jpadilla/rttm/services"
+)
+
+const (
+	callbackSignatureHeader = "X-RTTM-Signature"
+	callbackTimeout         = 10 * time.Second
+	callbackMaxAttempts     = 3
+)
+
+// callbackBackoff is the wait before the first retry of a callback. It
+// doubles after every failed attempt.
+var callbackBackoff = time.Second
+
+// callbackClient only connects to public addresses, checked again on every
+// connection and redirect, as callback hosts can resolve to anything.
+var callbackClient = services.NewPublicClient(callbackTimeout)
+
+var errNoCallbackSecret = errors.New("Callbacks are disabled until CALLBACK_SECRET is set")
+
+// Delivery is a single attempt at POSTing a payload to a callback URL.
+type Delivery struct {
+	URL        string
+	Attempt    int
+	StatusCode int
+	Error      string
+	Duration   time.Duration
+	CreatedAt  time.Time
+}
+
+type callbackPayload struct {
+	JobId string `json:"job_id"`
+	URL   string `json:"url,omitempty"`
+	Error string `json:"error,omitempty"`
+}
+
+// ValidateCallbackURL checks that callback is an absolute http(s) URL that
+// does not point at this host or a private network.
+func ValidateCallbackURL(callback string) error {
+	u, err := url.Parse(callback)
+	if err != nil {
+		return err
+	}
+
+	if u.Scheme != "http" && u.Scheme != "https" {
+		return fmt.Errorf("Invalid callback URL scheme: %s", u.Scheme)
+	}
+
+	host := u.Host
+	if h, _, err := net.SplitHostPort(u.Host); err == nil {
+		host = h
+	}
+
+	if host == "" || strings.EqualFold(host, "localhost") {
+		return fmt.Errorf("Invalid callback URL host: %s", u.Host)
+	}
+
+	if ip := net.ParseIP(strings.Trim(host, "[]")); ip != nil && !services.IsPublicIP(ip) {
+		return fmt.Errorf("Invalid callback URL host: %s", u.Host)
+	}
+
+	return nil
+}
+
+// callbackSecret returns CALLBACK_SECRET. Callbacks are never sent unsigned,
+// since receivers couldn't tell them from forged ones.
+func callbackSecret() (string, error) {
+	secret := os.Getenv("CALLBACK_SECRET")
+	if secret == "" {
+		return "", errNoCallbackSecret
+	}
+
+	return secret, nil
+}
+
+// SignPayload returns the hex encoded HMAC-SHA256 of body keyed by secret.
+func SignPayload(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// DeliverCallback POSTs body to callback, retrying with exponential backoff
+// on network errors and non 2xx responses. The body is signed with
+// CALLBACK_SECRET in the X-RTTM-Signature header. Every attempt is passed
+// to record so that it can be stored.
+func DeliverCallback(callback string, body []byte, record func(Delivery)) error {
+	secret, err := callbackSecret()
+	if err != nil {
+		return err
+	}
+
+	backoff := callbackBackoff
+
+	for attempt := 1; attempt <= callbackMaxAttempts; attempt++ {
+		delivery := deliverOnce(callback, body, secret)
+		delivery.Attempt = attempt
+
+		if record != nil {
+			record(delivery)
+		}
+
+		if delivery.Error == "" {
+			return nil
+		}
+
+		err = fmt.Errorf("Callback delivery to %s failed: %s", callback, delivery.Error)
+		log.Println(err)
+
+		if attempt < callbackMaxAttempts {
+			time.Sleep(backoff)
+			backoff *= 2
+		}
+	}
+
+	return err
+}
+
+func deliverOnce(callback string, body []byte, secret string) Delivery {
+	start := time.Now()
+	delivery := Delivery{URL: callback, CreatedAt: start}
+
+	req, err := http.NewRequest("POST", callback, bytes.NewReader(body))
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set(callbackSignatureHeader, "sha256="+SignPayload(secret, body))
+
+	log.Println("Sending data to callback", callback)
+
+	resp, err := callbackClient.Do(req)
+	delivery.Duration = time.Since(start)
+
+	if err != nil {
+		delivery.Error = err.Error()
+		return delivery
+	}
+
+	defer resp.Body.Close()
+	io.Copy(ioutil.Discard, resp.Body)
+
+	delivery.StatusCode = resp.StatusCode
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		delivery.Error = resp.Status
+	}
+
+	log.Println("response Status:", resp.Status)
+
+	return delivery
+}
@@ -0,0 +1,141 @@
+package main
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpadilla/rttm/services"
+)
+
+// useTestServer lets callbacks reach server, which listens on loopback.
+func useTestServer(server *httptest.Server) func() {
+	client := callbackClient
+	callbackClient = server.Client()
+
+	return func() { callbackClient = client }
+}
+
+func TestValidateCallbackURL(t *testing.T) {
+	tests := map[string]bool{
+		"https://example.com/hook":      true,
+		"http://example.com:8080/hook":  true,
+		"ftp://example.com/hook":        false,
+		"example.com/hook":              false,
+		"http://localhost/hook":         false,
+		"http://127.0.0.1:8080/hook":    false,
+		"http://10.0.0.1/hook":          false,
+		"http://169.254.169.254/latest": false,
+		"http://[::1]/hook":             false,
+		"http://8.8.8.8/hook":           true,
+	}
+
+	for url, valid := range tests {
+		err := ValidateCallbackURL(url)
+
+		if (err == nil) != valid {
+			t.Errorf("%s: expected valid=%v, got %v", url, valid, err)
+		}
+	}
+}
+
+func TestDeliverCallback(t *testing.T) {
+	callbackBackoff = time.Millisecond
+	os.Setenv("CALLBACK_SECRET", "secret")
+	defer os.Setenv("CALLBACK_SECRET", "")
+
+	body := []byte(`{"job_id":"1","url":"http://example.com/1.mp3"}`)
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+
+		b, _ := ioutil.ReadAll(r.Body)
+
+		if r.Header.Get(callbackSignatureHeader) != "sha256="+SignPayload("secret", b) {
+			t.Error("Invalid signature")
+		}
+
+		if requests == 1 {
+			http.Error(w, "", http.StatusServiceUnavailable)
+		}
+	}))
+	defer server.Close()
+	defer useTestServer(server)()
+
+	var deliveries []Delivery
+
+	err := DeliverCallback(server.URL, body, func(d Delivery) {
+		deliveries = append(deliveries, d)
+	})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(deliveries) != 2 || deliveries[0].StatusCode != 503 || deliveries[1].StatusCode != 200 {
+		t.Errorf("Unexpected deliveries %+v", deliveries)
+	}
+}
+
+func TestDeliverCallbackFailure(t *testing.T) {
+	callbackBackoff = time.Millisecond
+	os.Setenv("CALLBACK_SECRET", "secret")
+	defer os.Setenv("CALLBACK_SECRET", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Error(w, "", http.StatusInternalServerError)
+	}))
+	defer server.Close()
+	defer useTestServer(server)()
+
+	attempts := 0
+
+	err := DeliverCallback(server.URL, []byte(`{}`), func(d Delivery) {
+		attempts++
+	})
+
+	if err == nil || attempts != callbackMaxAttempts {
+		t.Errorf("Expected %d failed attempts, got %d: %v", callbackMaxAttempts, attempts, err)
+	}
+}
+
+func TestDeliverCallbackRefused(t *testing.T) {
+	callbackBackoff = time.Millisecond
+	requests := 0
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		requests++
+	}))
+	defer server.Close()
+
+	// Unsigned callbacks are never sent
+	os.Setenv("CALLBACK_SECRET", "")
+
+	if err := DeliverCallback(server.URL, []byte(`{}`), nil); !errors.Is(err, errNoCallbackSecret) {
+		t.Errorf("Expected errNoCallbackSecret, got %v", err)
+	}
+
+	// Nor are callbacks to a private address, whatever the URL looked like
+	os.Setenv("CALLBACK_SECRET", "secret")
+	defer os.Setenv("CALLBACK_SECRET", "")
+
+	var deliveries []Delivery
+
+	DeliverCallback(server.URL, []byte(`{}`), func(d Delivery) {
+		deliveries = append(deliveries, d)
+	})
+
+	if len(deliveries) == 0 || !strings.Contains(deliveries[0].Error, services.ErrPrivateAddress.Error()) {
+		t.Errorf("Expected the private address to be refused, got %+v", deliveries)
+	}
+
+	if requests != 0 {
+		t.Errorf("Expected no requests to reach the server, got %d", requests)
+	}
+}
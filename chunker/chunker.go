@@ -0,0 +1,200 @@
+// Package chunker splits long text into pieces small enough for a TTS
+// provider, preferring paragraph, then sentence, then word boundaries.
+package chunker
+
+import (
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Measure reports the size of s in the unit a provider limits on.
+type Measure func(s string) int
+
+var (
+	// Runes measures text in characters.
+	Runes Measure = utf8.RuneCountInString
+
+	// Bytes measures text in UTF-8 encoded bytes.
+	Bytes Measure = func(s string) int { return len(s) }
+)
+
+// Chunker splits text into chunks no larger than Max as reported by Measure.
+type Chunker struct {
+	Max     int
+	Measure Measure
+}
+
+type level struct {
+	split     func(string) []string
+	separator string
+}
+
+var levels = []level{
+	{splitParagraphs, "\n\n"},
+	{splitSentences, " "},
+	{strings.Fields, " "},
+}
+
+// Split splits text into chunks of at most max characters.
+func Split(text string, max int) []string {
+	return New(max, Runes).Split(text)
+}
+
+// New returns a Chunker limited to max units of measure. A nil measure
+// counts characters.
+func New(max int, measure Measure) *Chunker {
+	if measure == nil {
+		measure = Runes
+	}
+
+	return &Chunker{Max: max, Measure: measure}
+}
+
+// Split splits text into non-empty chunks. Chunks are packed greedily so
+// that as few as possible are produced without cutting through a paragraph,
+// sentence or word unless it alone exceeds the limit.
+func (c *Chunker) Split(text string) []string {
+	text = strings.TrimSpace(text)
+
+	if text == "" {
+		return nil
+	}
+
+	if c.Max <= 0 {
+		return []string{text}
+	}
+
+	return c.split(text, 0)
+}
+
+func (c *Chunker) split(text string, depth int) []string {
+	if c.Measure(text) <= c.Max {
+		return []string{text}
+	}
+
+	if depth == len(levels) {
+		return c.hardSplit(text)
+	}
+
+	var chunks []string
+	current := ""
+	separator := levels[depth].separator
+
+	for _, piece := range levels[depth].split(text) {
+		for _, part := range c.split(piece, depth+1) {
+			candidate := part
+
+			if current != "" {
+				candidate = current + separator + part
+			}
+
+			if c.Measure(candidate) <= c.Max {
+				current = candidate
+				continue
+			}
+
+			if current != "" {
+				chunks = append(chunks, current)
+			}
+
+			current = part
+		}
+	}
+
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+// hardSplit cuts a single word that does not fit on its own.
+func (c *Chunker) hardSplit(text string) []string {
+	var chunks []string
+	current := ""
+
+	for _, r := range text {
+		candidate := current + string(r)
+
+		if current != "" && c.Measure(candidate) > c.Max {
+			chunks = append(chunks, current)
+			candidate = string(r)
+		}
+
+		current = candidate
+	}
+
+	if current != "" {
+		chunks = append(chunks, current)
+	}
+
+	return chunks
+}
+
+func splitParagraphs(text string) []string {
+	var paragraphs []string
+
+	for _, line := range strings.Split(text, "\n") {
+		if line = strings.TrimSpace(line); line != "" {
+			paragraphs = append(paragraphs, line)
+		}
+	}
+
+	return paragraphs
+}
+
+func splitSentences(text string) []string {
+	var sentences []string
+
+	runes := []rune(text)
+	start := 0
+
+	for i := 0; i < len(runes); i++ {
+		if !isTerminal(runes[i]) {
+			continue
+		}
+
+		// Include repeated punctuation and closing quotes or brackets
+		end := i + 1
+		for end < len(runes) && (isTerminal(runes[end]) || isClosing(runes[end])) {
+			end++
+		}
+
+		if end < len(runes) && !unicode.IsSpace(runes[end]) {
+			i = end - 1
+			continue
+		}
+
+		if sentence := strings.TrimSpace(string(runes[start:end])); sentence != "" {
+			sentences = append(sentences, sentence)
+		}
+
+		start = end
+		i = end - 1
+	}
+
+	if sentence := strings.TrimSpace(string(runes[start:])); sentence != "" {
+		sentences = append(sentences, sentence)
+	}
+
+	return sentences
+}
+
+func isTerminal(r rune) bool {
+	switch r {
+	case '.', '!', '?', '…', '。', '！', '？':
+		return true
+	}
+
+	return false
+}
+
+func isClosing(r rune) bool {
+	switch r {
+	case '"', '\'', ')', ']', '”', '’', '»':
+		return true
+	}
+
+	return false
+}
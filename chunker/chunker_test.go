@@ -0,0 +1,126 @@
+package chunker
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func TestSplit(t *testing.T) {
+	tests := []struct {
+		name     string
+		text     string
+		max      int
+		expected []string
+	}{
+		{
+			name:     "empty",
+			text:     " \n\n ",
+			max:      10,
+			expected: nil,
+		},
+		{
+			name:     "fits",
+			text:     "Hello World.",
+			max:      20,
+			expected: []string{"Hello World."},
+		},
+		{
+			name:     "no limit",
+			text:     "Hello World.",
+			max:      0,
+			expected: []string{"Hello World."},
+		},
+		{
+			name:     "paragraphs",
+			text:     "First paragraph.\n\nSecond paragraph.\nThird one.",
+			max:      20,
+			expected: []string{"First paragraph.", "Second paragraph.", "Third one."},
+		},
+		{
+			name:     "packs paragraphs",
+			text:     "One.\nTwo.\nThree is longer.",
+			max:      16,
+			expected: []string{"One.\n\nTwo.", "Three is longer."},
+		},
+		{
+			name:     "sentences",
+			text:     "This is one. This is two! Is this three? Yes.",
+			max:      26,
+			expected: []string{"This is one. This is two!", "Is this three? Yes."},
+		},
+		{
+			name:     "quoted sentence",
+			text:     `He said "stop." Then he left.`,
+			max:      16,
+			expected: []string{`He said "stop."`, "Then he left."},
+		},
+		{
+			name:     "abbreviation without space",
+			text:     "Visit example.com today.",
+			max:      14,
+			expected: []string{"Visit", "example.com", "today."},
+		},
+		{
+			name:     "words",
+			text:     "alpha beta gamma delta",
+			max:      11,
+			expected: []string{"alpha beta", "gamma delta"},
+		},
+		{
+			name:     "long word",
+			text:     "abcdefghij",
+			max:      4,
+			expected: []string{"abcd", "efgh", "ij"},
+		},
+		{
+			name:     "multibyte runes",
+			text:     "ññññ ññññ",
+			max:      4,
+			expected: []string{"ññññ", "ññññ"},
+		},
+	}
+
+	for _, test := range tests {
+		chunks := Split(test.text, test.max)
+
+		if !reflect.DeepEqual(chunks, test.expected) {
+			t.Errorf("%s: got %q, expected %q", test.name, chunks, test.expected)
+		}
+	}
+}
+
+func TestSplitBytes(t *testing.T) {
+	chunks := New(5, Bytes).Split("ñññ ñññ")
+	expected := []string{"ññ", "ñ", "ññ", "ñ"}
+
+	if !reflect.DeepEqual(chunks, expected) {
+		t.Errorf("got %q, expected %q", chunks, expected)
+	}
+}
+
+func TestSplitRespectsLimit(t *testing.T) {
+	paragraph := "Lorem ipsum dolor sit amet, consectetur adipisicing elit, sed do eiusmod tempor incididunt ut labore et dolore magna aliqua. Ut enim ad minim veniam, quis nostrud exercitation ullamco laboris nisi ut aliquip ex ea commodo consequat."
+	text := strings.Repeat(paragraph+"\n", 50)
+
+	for _, max := range []int{1, 7, 40, 140, 1000} {
+		chunks := Split(text, max)
+
+		for _, chunk := range chunks {
+			if chunk == "" || strings.TrimSpace(chunk) != chunk {
+				t.Errorf("max %d: unexpected chunk %q", max, chunk)
+			}
+
+			if Runes(chunk) > max {
+				t.Errorf("max %d: chunk exceeds limit %q", max, chunk)
+			}
+		}
+
+		joined := strings.Join(strings.Fields(strings.Join(chunks, " ")), "")
+		original := strings.Join(strings.Fields(text), "")
+
+		if joined != original {
+			t.Errorf("max %d: chunks lost text", max)
+		}
+	}
+}
@@ -0,0 +1,94 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"strings"
+	"text/tabwriter"
+)
+
+const commandUsage = `Usage:
+  rttm                                    Run the web server
+  rttm worker                             Run the background job worker
+  rttm apikey create <owner> [scope...]   Mint a new API key (default scope: tts)
+  rttm apikey list                        List API keys
+  rttm apikey revoke <id>                 Revoke an API key
+  rttm migrate users                      Create users for existing phones and link their requests`
+
+// RunCommand runs the administrative command named by args.
+func RunCommand(args []string) error {
+	switch args[0] {
+	case "worker":
+		RunWorker()
+		return nil
+	case "apikey":
+		return runAPIKeyCommand(args[1:])
+	case "migrate":
+		return runMigrateCommand(args[1:])
+	}
+
+	return fmt.Errorf("Unknown command %q\n%s", args[0], commandUsage)
+}
+
+func runAPIKeyCommand(args []string) error {
+	if len(args) == 0 {
+		return errors.New(commandUsage)
+	}
+
+	switch {
+	case args[0] == "create" && len(args) >= 2:
+		scopes := args[2:]
+		if len(scopes) == 0 {
+			scopes = []string{ScopeTTS}
+		}
+
+		apiKey, key, err := CreateAPIKey(args[1], scopes)
+		if err != nil {
+			return err
+		}
+
+		fmt.Printf("Created API key %s for %s with scopes %s\n", apiKey.Id.Hex(), apiKey.Owner, strings.Join(apiKey.Scopes, ","))
+		fmt.Printf("Key (shown only once): %s\n", key)
+		return nil
+
+	case args[0] == "list":
+		apiKeys, err := FindAPIKeys()
+		if err != nil {
+			return err
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(w, "ID\tPREFIX\tOWNER\tSCOPES\tCREATED\tREVOKED")
+
+		for _, k := range apiKeys {
+			fmt.Fprintf(w, "%s\t%s\t%s\t%s\t%s\t%v\n", k.Id.Hex(), k.Prefix, k.Owner, strings.Join(k.Scopes, ","), k.CreatedAt.Format("2006-01-02"), k.Revoked)
+		}
+
+		return w.Flush()
+
+	case args[0] == "revoke" && len(args) == 2:
+		if err := RevokeAPIKey(args[1]); err != nil {
+			return err
+		}
+
+		fmt.Printf("Revoked API key %s\n", args[1])
+		return nil
+	}
+
+	return errors.New(commandUsage)
+}
+
+func runMigrateCommand(args []string) error {
+	if len(args) != 1 || args[0] != "users" {
+		return errors.New(commandUsage)
+	}
+
+	n, err := MigrateUsers()
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Migrated requests for %d phones\n", n)
+	return nil
+}
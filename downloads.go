@@ -0,0 +1,78 @@
+package main
+
+import (
+	"net/http"
+	"net/url"
+	"path"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// DownloadStats counts how a request's audio was fetched through its
+// listen URL.
+type DownloadStats struct {
+	Full      int   // complete responses
+	Partial   int   // byte ranges, e.g. a player seeking or resuming
+	Redirects int   // sent on to audio the app does not serve itself
+	Bytes     int64 // audio bytes sent
+	LastAt    time.Time
+}
+
+// ListenURL is where the requester streams the audio, e.g.
+// /listen/{id}.mp3, so that downloads are counted for this request.
+func (r *Request) ListenURL() string {
+	ext := ""
+	if r.Post != nil {
+		if u, err := url.Parse(r.Post.AudioURL); err == nil {
+			ext = path.Ext(u.Path)
+		}
+	}
+
+	return siteURL() + "/listen/" + r.Id.Hex() + ext
+}
+
+// RecordDownload adds a response with status and bytes of audio to the
+// download stats of request id. Other statuses than 200, 206 and 302, e.g.
+// 304 Not Modified, are not counted.
+func RecordDownload(id bson.ObjectId, status int, bytes int64) error {
+	var field string
+
+	switch status {
+	case http.StatusOK:
+		field = "downloads.full"
+	case http.StatusPartialContent:
+		field = "downloads.partial"
+	case http.StatusFound:
+		field = "downloads.redirects"
+	default:
+		return nil
+	}
+
+	return RequestCollection.UpdateId(id, bson.M{
+		"$inc": bson.M{field: 1, "downloads.bytes": bytes},
+		"$set": bson.M{"downloads.lastat": time.Now()},
+	})
+}
+
+// countingWriter records the status and body size of a response.
+type countingWriter struct {
+	http.ResponseWriter
+	status int
+	bytes  int64
+}
+
+func (w *countingWriter) WriteHeader(status int) {
+	w.status = status
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *countingWriter) Write(b []byte) (int, error) {
+	if w.status == 0 {
+		w.status = http.StatusOK
+	}
+
+	n, err := w.ResponseWriter.Write(b)
+	w.bytes += int64(n)
+	return n, err
+}
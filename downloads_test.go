@@ -0,0 +1,111 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/gorilla/mux"
+	"github.com/jpadilla/rttm/storage"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestListenURL(t *testing.T) {
+	id := bson.NewObjectId()
+
+	tests := map[string]string{
+		"https://bucket.s3.amazonaws.com/posts/1/abc.mp3": ".mp3",
+		"http://example.com/audio/posts/1/abc.wav?v=1":    ".wav",
+		"": "",
+	}
+
+	for audioURL, ext := range tests {
+		request := &Request{Id: id, Post: &Post{AudioURL: audioURL}}
+
+		if url := request.ListenURL(); url != siteURL()+"/listen/"+id.Hex()+ext {
+			t.Errorf("Unexpected listen URL %s for %q", url, audioURL)
+		}
+	}
+}
+
+func TestCountingWriter(t *testing.T) {
+	w := &countingWriter{ResponseWriter: httptest.NewRecorder()}
+	w.Write([]byte("abc"))
+	w.Write([]byte("de"))
+
+	if w.status != http.StatusOK || w.bytes != 5 {
+		t.Errorf("Unexpected count %d %d", w.status, w.bytes)
+	}
+}
+
+func TestListenHandler(t *testing.T) {
+	defer withTestDB(t)()
+
+	root, err := ioutil.TempDir("", "rttm-listen")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	local, _ := storage.NewLocalStore(root, "/media")
+	local.Put("posts/1/a.mp3", []byte("0123456789"), "audio/mpeg")
+
+	Store = local
+	defer func() { Store = nil }()
+
+	post := &Post{Id: bson.NewObjectId(), AudioKey: "posts/1/a.mp3", AudioURL: local.PublicURL("posts/1/a.mp3")}
+	request := &Request{Id: bson.NewObjectId(), PostId: post.Id, CreatedAt: time.Now()}
+
+	if err = PostCollection.Insert(post); err != nil {
+		t.Fatal(err)
+	}
+
+	if err = RequestCollection.Insert(request); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/listen/{id}", ListenHandler).Methods("GET", "HEAD")
+
+	get := func(method string, rangeHeader string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, "/listen/"+request.Id.Hex()+".mp3", nil)
+		if rangeHeader != "" {
+			r.Header.Set("Range", rangeHeader)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w
+	}
+
+	if w := get("GET", ""); w.Code != http.StatusOK || w.Body.String() != "0123456789" {
+		t.Errorf("Unexpected response %d %q", w.Code, w.Body.String())
+	}
+
+	if w := get("GET", "bytes=0-3"); w.Code != http.StatusPartialContent || w.Body.String() != "0123" {
+		t.Errorf("Unexpected range response %d %q", w.Code, w.Body.String())
+	}
+
+	if w := get("HEAD", ""); w.Code != http.StatusOK || w.Header().Get("Content-Length") != "10" {
+		t.Errorf("Unexpected HEAD response %d %v", w.Code, w.Header())
+	}
+
+	saved, err := GetRequestById(request.Id.Hex())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if stats := saved.Downloads; stats.Full != 1 || stats.Partial != 1 || stats.Bytes != 14 || stats.LastAt.IsZero() {
+		t.Errorf("Unexpected download stats %+v", stats)
+	}
+
+	// Audio the app does not serve itself is redirected to
+	Store = nil
+
+	if w := get("GET", ""); w.Code != http.StatusFound || w.Header().Get("Location") != post.AudioURL {
+		t.Errorf("Expected a redirect, got %d %v", w.Code, w.Header())
+	}
+}
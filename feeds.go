@@ -0,0 +1,565 @@
+package main
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"mime"
+	"net/url"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	itunesNamespace = "http://www.itunes.com/dtds/podcast-1.0.dtd"
+	atomNamespace   = "http://www.w3.org/2005/Atom"
+	jsonFeedVersion = "https://jsonfeed.org/version/1.1"
+	feedAuthor      = "Read This To Me"
+	feedCategory    = "News"
+	feedLanguage    = "en-us"
+
+	// RFC 2822 dates with a numeric zone, as podcast validators expect
+	itunesRFC822 = time.RFC1123Z
+)
+
+// Feed is a user's podcast independent of the format it is served in.
+type Feed struct {
+	Title       string
+	Description string
+	Link        string
+	FeedURL     string
+	ImageURL    string
+	Updated     time.Time
+	Pages       FeedPages
+	Items       []*FeedItem
+}
+
+// FeedPages links the pages of a feed split per RFC 5005, section 3.
+// Links that don't apply to a page are empty.
+type FeedPages struct {
+	First    string
+	Previous string
+	Next     string
+	Last     string
+}
+
+// FeedItem is one article read aloud.
+type FeedItem struct {
+	Id        string
+	Title     string
+	Link      string
+	Summary   string
+	Author    string
+	ImageURL  string
+	Published time.Time
+	Audio     FeedAudio
+}
+
+// FeedAudio is the recording attached to a FeedItem.
+type FeedAudio struct {
+	URL         string
+	ContentType string
+	Length      int
+	Duration    time.Duration
+}
+
+// FeedFormat is a way of serializing a Feed.
+type FeedFormat struct {
+	Name        string
+	ContentType string
+	Write       func(feed *Feed, w io.Writer) error
+}
+
+var (
+	RSSFormat = FeedFormat{"rss", "application/rss+xml; charset=utf-8", func(feed *Feed, w io.Writer) error {
+		return writeXML(w, feed.RSS())
+	}}
+	AtomFormat = FeedFormat{"atom", "application/atom+xml; charset=utf-8", func(feed *Feed, w io.Writer) error {
+		return writeXML(w, feed.Atom())
+	}}
+	JSONFeedFormat = FeedFormat{"json", "application/feed+json; charset=utf-8", func(feed *Feed, w io.Writer) error {
+		b, err := json.MarshalIndent(feed.JSON(), "", "  ")
+		if err != nil {
+			return err
+		}
+
+		_, err = w.Write(b)
+		return err
+	}}
+
+	feedFormats = []FeedFormat{RSSFormat, AtomFormat, JSONFeedFormat}
+)
+
+// ParseFeedPath splits a feed path segment such as "abc123.atom" into the
+// token and the format its suffix names. Without a suffix the format is
+// negotiated from accept, defaulting to RSS, and negotiated is true.
+func ParseFeedPath(segment string, accept string) (token string, format FeedFormat, negotiated bool) {
+	for _, format := range feedFormats {
+		if strings.HasSuffix(segment, "."+format.Name) {
+			return strings.TrimSuffix(segment, "."+format.Name), format, false
+		}
+	}
+
+	for _, mediaRange := range strings.Split(accept, ",") {
+		mediaType, _, _ := mime.ParseMediaType(mediaRange)
+
+		switch mediaType {
+		case "application/rss+xml":
+			return segment, RSSFormat, true
+		case "application/atom+xml":
+			return segment, AtomFormat, true
+		case "application/feed+json", "application/json":
+			return segment, JSONFeedFormat, true
+		}
+	}
+
+	return segment, RSSFormat, true
+}
+
+// NewFeed builds the feed titled title, published at feedURL, from
+// requests. The feed artwork comes from the first article that has any.
+func NewFeed(title string, feedURL string, requests []Request) *Feed {
+	feed := &Feed{
+		Title:       title,
+		Description: "Articles read to you by " + feedAuthor,
+		Link:        siteURL(),
+		FeedURL:     feedURL,
+	}
+
+	for _, request := range requests {
+		post := request.Post
+
+		item := &FeedItem{
+			Id:        request.Id.Hex(),
+			Title:     post.Title,
+			Link:      post.URL,
+			Summary:   post.GetShortDescription(),
+			Author:    post.AuthorNames(),
+			ImageURL:  post.ImageURL(),
+			Published: request.CreatedAt,
+			Audio: FeedAudio{
+				URL:         request.ListenURL(),
+				ContentType: audioContentType(post.AudioURL),
+				Length:      post.Length,
+				Duration:    post.Duration,
+			},
+		}
+
+		if feed.ImageURL == "" {
+			feed.ImageURL = item.ImageURL
+		}
+
+		if item.Published.After(feed.Updated) {
+			feed.Updated = item.Published
+		}
+
+		feed.Items = append(feed.Items, item)
+	}
+
+	if feed.Updated.IsZero() {
+		feed.Updated = time.Now()
+	}
+
+	return feed
+}
+
+// Paginate points the feed at page of lastPage, where page n of the feed at
+// baseURL is at baseURL?page=n and the first page is baseURL itself.
+func (f *Feed) Paginate(baseURL string, page int, lastPage int) {
+	pageURL := func(n int) string {
+		if n <= 1 {
+			return baseURL
+		}
+
+		return fmt.Sprintf("%s?page=%d", baseURL, n)
+	}
+
+	f.FeedURL = pageURL(page)
+	f.Pages = FeedPages{}
+
+	if lastPage <= 1 {
+		return
+	}
+
+	f.Pages.First = pageURL(1)
+	f.Pages.Last = pageURL(lastPage)
+
+	if page > 1 {
+		f.Pages.Previous = pageURL(page - 1)
+	}
+
+	if page < lastPage {
+		f.Pages.Next = pageURL(page + 1)
+	}
+}
+
+// links returns the feed's self and paging links as Atom links.
+func (f *Feed) links(contentType string) []*atomLink {
+	links := []*atomLink{{Href: f.FeedURL, Rel: "self", Type: contentType}}
+
+	for _, link := range []struct{ rel, href string }{
+		{"first", f.Pages.First},
+		{"previous", f.Pages.Previous},
+		{"next", f.Pages.Next},
+		{"last", f.Pages.Last},
+	} {
+		if link.href != "" {
+			links = append(links, &atomLink{Href: link.href, Rel: link.rel, Type: contentType})
+		}
+	}
+
+	return links
+}
+
+// podcastRSS is an RSS 2.0 document with the itunes: extensions podcast
+// apps rely on for artwork, durations and authors.
+type podcastRSS struct {
+	XMLName  xml.Name        `xml:"rss"`
+	Version  string          `xml:"version,attr"`
+	ITunesNS string          `xml:"xmlns:itunes,attr"`
+	AtomNS   string          `xml:"xmlns:atom,attr"`
+	Channel  *podcastChannel `xml:"channel"`
+}
+
+type podcastChannel struct {
+	Title          string          `xml:"title"`
+	Link           string          `xml:"link"`
+	Description    string          `xml:"description"`
+	Language       string          `xml:"language"`
+	PubDate        string          `xml:"pubDate,omitempty"`
+	AtomLinks      []*atomLink     `xml:"atom:link"`
+	Image          *rssImage       `xml:"image,omitempty"`
+	ITunesAuthor   string          `xml:"itunes:author"`
+	ITunesSummary  string          `xml:"itunes:summary"`
+	ITunesExplicit string          `xml:"itunes:explicit"`
+	ITunesImage    *itunesImage    `xml:"itunes:image,omitempty"`
+	ITunesCategory *itunesCategory `xml:"itunes:category"`
+	Items          []*podcastItem  `xml:"item"`
+}
+
+type rssImage struct {
+	URL   string `xml:"url"`
+	Title string `xml:"title"`
+	Link  string `xml:"link"`
+}
+
+type itunesImage struct {
+	Href string `xml:"href,attr"`
+}
+
+type itunesCategory struct {
+	Text string `xml:"text,attr"`
+}
+
+type podcastItem struct {
+	Title          string        `xml:"title"`
+	Link           string        `xml:"link"`
+	Description    string        `xml:"description"`
+	GUID           *rssGUID      `xml:"guid"`
+	PubDate        string        `xml:"pubDate"`
+	Enclosure      *rssEnclosure `xml:"enclosure"`
+	ITunesAuthor   string        `xml:"itunes:author,omitempty"`
+	ITunesSummary  string        `xml:"itunes:summary,omitempty"`
+	ITunesDuration string        `xml:"itunes:duration,omitempty"`
+	ITunesExplicit string        `xml:"itunes:explicit"`
+	ITunesImage    *itunesImage  `xml:"itunes:image,omitempty"`
+}
+
+type rssGUID struct {
+	IsPermaLink bool   `xml:"isPermaLink,attr"`
+	Value       string `xml:",chardata"`
+}
+
+type rssEnclosure struct {
+	URL    string `xml:"url,attr"`
+	Length int    `xml:"length,attr"`
+	Type   string `xml:"type,attr"`
+}
+
+// RSS returns the feed as a podcast RSS document.
+func (f *Feed) RSS() *podcastRSS {
+	channel := &podcastChannel{
+		Title:          f.Title,
+		Link:           f.Link,
+		Description:    f.Description,
+		Language:       feedLanguage,
+		PubDate:        f.Updated.Format(itunesRFC822),
+		AtomLinks:      f.links("application/rss+xml"),
+		ITunesAuthor:   feedAuthor,
+		ITunesSummary:  f.Description,
+		ITunesExplicit: "false",
+		ITunesCategory: &itunesCategory{Text: feedCategory},
+	}
+
+	if f.ImageURL != "" {
+		channel.Image = &rssImage{URL: f.ImageURL, Title: f.Title, Link: f.Link}
+		channel.ITunesImage = &itunesImage{Href: f.ImageURL}
+	}
+
+	for _, item := range f.Items {
+		rssItem := &podcastItem{
+			Title:          item.Title,
+			Link:           item.Link,
+			Description:    item.Summary,
+			GUID:           &rssGUID{Value: item.Id},
+			PubDate:        item.Published.Format(itunesRFC822),
+			Enclosure:      &rssEnclosure{URL: item.Audio.URL, Length: item.Audio.Length, Type: item.Audio.ContentType},
+			ITunesAuthor:   item.Author,
+			ITunesSummary:  item.Summary,
+			ITunesDuration: itunesDuration(item.Audio.Duration),
+			ITunesExplicit: "false",
+		}
+
+		if item.ImageURL != "" {
+			rssItem.ITunesImage = &itunesImage{Href: item.ImageURL}
+		}
+
+		channel.Items = append(channel.Items, rssItem)
+	}
+
+	return &podcastRSS{
+		Version:  "2.0",
+		ITunesNS: itunesNamespace,
+		AtomNS:   atomNamespace,
+		Channel:  channel,
+	}
+}
+
+// atomFeed is an Atom 1.0 document. gorilla/feeds only allows one link per
+// entry, which leaves no room for the audio enclosure.
+type atomFeed struct {
+	XMLName  xml.Name     `xml:"feed"`
+	Xmlns    string       `xml:"xmlns,attr"`
+	Id       string       `xml:"id"`
+	Title    string       `xml:"title"`
+	Subtitle string       `xml:"subtitle,omitempty"`
+	Updated  string       `xml:"updated"`
+	Logo     string       `xml:"logo,omitempty"`
+	Links    []*atomLink  `xml:"link"`
+	Author   *atomPerson  `xml:"author"`
+	Entries  []*atomEntry `xml:"entry"`
+}
+
+type atomLink struct {
+	Href   string `xml:"href,attr"`
+	Rel    string `xml:"rel,attr,omitempty"`
+	Type   string `xml:"type,attr,omitempty"`
+	Length int    `xml:"length,attr,omitempty"`
+}
+
+type atomPerson struct {
+	Name string `xml:"name"`
+}
+
+type atomEntry struct {
+	Id        string      `xml:"id"`
+	Title     string      `xml:"title"`
+	Published string      `xml:"published"`
+	Updated   string      `xml:"updated"`
+	Summary   string      `xml:"summary,omitempty"`
+	Author    *atomPerson `xml:"author,omitempty"`
+	Links     []*atomLink `xml:"link"`
+}
+
+// Atom returns the feed as an Atom document with audio enclosure links.
+func (f *Feed) Atom() *atomFeed {
+	atom := &atomFeed{
+		Xmlns:    atomNamespace,
+		Id:       f.FeedURL,
+		Title:    f.Title,
+		Subtitle: f.Description,
+		Updated:  f.Updated.Format(time.RFC3339),
+		Logo:     f.ImageURL,
+		Links:    append(f.links("application/atom+xml"), &atomLink{Href: f.Link, Rel: "alternate", Type: "text/html"}),
+		Author:   &atomPerson{Name: feedAuthor},
+	}
+
+	for _, item := range f.Items {
+		entry := &atomEntry{
+			Id:        siteURL() + "/" + item.Id,
+			Title:     item.Title,
+			Published: item.Published.Format(time.RFC3339),
+			Updated:   item.Published.Format(time.RFC3339),
+			Summary:   item.Summary,
+			Links: []*atomLink{
+				{Href: item.Link, Rel: "alternate", Type: "text/html"},
+				{Href: item.Audio.URL, Rel: "enclosure", Type: item.Audio.ContentType, Length: item.Audio.Length},
+			},
+		}
+
+		if item.Author != "" {
+			entry.Author = &atomPerson{Name: item.Author}
+		}
+
+		atom.Entries = append(atom.Entries, entry)
+	}
+
+	return atom
+}
+
+// jsonFeed is a JSON Feed 1.1 document, see https://jsonfeed.org/version/1.1
+type jsonFeed struct {
+	Version     string           `json:"version"`
+	Title       string           `json:"title"`
+	HomePageURL string           `json:"home_page_url"`
+	FeedURL     string           `json:"feed_url"`
+	NextURL     string           `json:"next_url,omitempty"`
+	Description string           `json:"description,omitempty"`
+	Icon        string           `json:"icon,omitempty"`
+	Authors     []jsonFeedPerson `json:"authors"`
+	Language    string           `json:"language"`
+	Items       []*jsonFeedItem  `json:"items"`
+}
+
+type jsonFeedPerson struct {
+	Name string `json:"name"`
+}
+
+type jsonFeedItem struct {
+	Id            string               `json:"id"`
+	URL           string               `json:"url,omitempty"`
+	Title         string               `json:"title"`
+	ContentText   string               `json:"content_text"`
+	Summary       string               `json:"summary,omitempty"`
+	Image         string               `json:"image,omitempty"`
+	DatePublished string               `json:"date_published"`
+	Authors       []jsonFeedPerson     `json:"authors,omitempty"`
+	Attachments   []jsonFeedAttachment `json:"attachments"`
+}
+
+type jsonFeedAttachment struct {
+	URL               string `json:"url"`
+	MimeType          string `json:"mime_type"`
+	SizeInBytes       int    `json:"size_in_bytes,omitempty"`
+	DurationInSeconds int    `json:"duration_in_seconds,omitempty"`
+}
+
+// JSON returns the feed as a JSON Feed with audio attachments.
+func (f *Feed) JSON() *jsonFeed {
+	feed := &jsonFeed{
+		Version:     jsonFeedVersion,
+		Title:       f.Title,
+		HomePageURL: f.Link,
+		FeedURL:     f.FeedURL,
+		NextURL:     f.Pages.Next,
+		Description: f.Description,
+		Icon:        f.ImageURL,
+		Authors:     []jsonFeedPerson{{Name: feedAuthor}},
+		Language:    "en-US",
+		Items:       []*jsonFeedItem{},
+	}
+
+	for _, item := range f.Items {
+		jsonItem := &jsonFeedItem{
+			Id:            item.Id,
+			URL:           item.Link,
+			Title:         item.Title,
+			ContentText:   item.Summary,
+			Summary:       item.Summary,
+			Image:         item.ImageURL,
+			DatePublished: item.Published.Format(time.RFC3339),
+			Attachments: []jsonFeedAttachment{{
+				URL:               item.Audio.URL,
+				MimeType:          item.Audio.ContentType,
+				SizeInBytes:       item.Audio.Length,
+				DurationInSeconds: int(item.Audio.Duration.Seconds() + 0.5),
+			}},
+		}
+
+		if item.Author != "" {
+			jsonItem.Authors = []jsonFeedPerson{{Name: item.Author}}
+		}
+
+		feed.Items = append(feed.Items, jsonItem)
+	}
+
+	return feed
+}
+
+// feedETag returns a strong ETag identifying a feed document by everything
+// it is rendered from.
+func feedETag(parts ...interface{}) string {
+	h := sha256.New()
+
+	// Quote every part so that neighbouring parts can't run together
+	for _, part := range parts {
+		fmt.Fprintf(h, "%q;", fmt.Sprint(part))
+	}
+
+	return `"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+func writeXML(w io.Writer, v interface{}) error {
+	b, err := xml.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	_, err = io.WriteString(w, xml.Header+string(b))
+	return err
+}
+
+// itunesDuration formats d as HH:MM:SS, or "" when it is unknown.
+func itunesDuration(d time.Duration) string {
+	if d <= 0 {
+		return ""
+	}
+
+	seconds := int(d.Seconds() + 0.5)
+	return fmt.Sprintf("%02d:%02d:%02d", seconds/3600, seconds/60%60, seconds%60)
+}
+
+// audioTypes maps audio file extensions to the types podcast apps expect.
+// The system MIME tables vary, e.g. giving audio/x-wav or nothing for .wav.
+var audioTypes = map[string]string{
+	".mp3":  "audio/mpeg",
+	".wav":  "audio/wav",
+	".m4a":  "audio/mp4",
+	".aac":  "audio/aac",
+	".ogg":  "audio/ogg",
+	".opus": "audio/ogg",
+}
+
+// audioContentType guesses the type of the audio at audioURL from its
+// extension, defaulting to MP3.
+func audioContentType(audioURL string) string {
+	if u, err := url.Parse(audioURL); err == nil {
+		if contentType, ok := audioTypes[strings.ToLower(path.Ext(u.Path))]; ok {
+			return contentType
+		}
+	}
+
+	return "audio/mpeg"
+}
+
+// ImageURL returns the post's lead image, or else its site's favicon.
+func (p Post) ImageURL() string {
+	for _, image := range p.Images {
+		if image.URL != "" {
+			return image.URL
+		}
+	}
+
+	return p.FaviconURL
+}
+
+// AuthorNames lists the post's authors, or else where it was published.
+func (p Post) AuthorNames() string {
+	var names []string
+
+	for _, author := range p.Authors {
+		if author.Name != "" {
+			names = append(names, author.Name)
+		}
+	}
+
+	if len(names) == 0 {
+		return p.ProviderName
+	}
+
+	return strings.Join(names, ", ")
+}
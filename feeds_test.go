@@ -0,0 +1,382 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"regexp"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+// parsedFeed reads back the parts of a podcast feed that Apple's and
+// Cast Feed Validator's checks look at.
+type parsedFeed struct {
+	XMLName xml.Name `xml:"rss"`
+	Version string   `xml:"version,attr"`
+	Channel struct {
+		Title string `xml:"title"`
+		Links []struct {
+			XMLName xml.Name
+			Href    string `xml:"href,attr"`
+			Rel     string `xml:"rel,attr"`
+			Value   string `xml:",chardata"`
+		} `xml:"link"`
+		Description string `xml:"description"`
+		Language    string `xml:"language"`
+		Author      string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+		Explicit    string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+		Image       struct {
+			Href string `xml:"href,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd image"`
+		Category struct {
+			Text string `xml:"text,attr"`
+		} `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd category"`
+		RSSImage struct {
+			URL string `xml:"url"`
+		} `xml:"image"`
+		Items []struct {
+			Title string `xml:"title"`
+			GUID  struct {
+				IsPermaLink string `xml:"isPermaLink,attr"`
+				Value       string `xml:",chardata"`
+			} `xml:"guid"`
+			PubDate   string `xml:"pubDate"`
+			Enclosure struct {
+				URL    string `xml:"url,attr"`
+				Length string `xml:"length,attr"`
+				Type   string `xml:"type,attr"`
+			} `xml:"enclosure"`
+			Duration string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd duration"`
+			Author   string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd author"`
+			Explicit string `xml:"http://www.itunes.com/dtds/podcast-1.0.dtd explicit"`
+		} `xml:"item"`
+	} `xml:"channel"`
+}
+
+var itunesDurationPattern = regexp.MustCompile(`^\d{2}:\d{2}:\d{2}$`)
+
+// validatePodcastFeed reports the problems podcast feed validators would.
+func validatePodcastFeed(t *testing.T, b []byte) *parsedFeed {
+	feed := &parsedFeed{}
+	if err := xml.Unmarshal(b, feed); err != nil {
+		t.Fatalf("Invalid XML: %v\n%s", err, b)
+	}
+
+	if feed.Version != "2.0" {
+		t.Errorf("Expected RSS 2.0, got %q", feed.Version)
+	}
+
+	if !bytes.Contains(b, []byte(`xmlns:itunes="`+itunesNamespace+`"`)) {
+		t.Error("Missing itunes namespace declaration")
+	}
+
+	c := feed.Channel
+	link, self := "", ""
+
+	for _, l := range c.Links {
+		if l.XMLName.Space == atomNamespace && l.Rel == "self" {
+			self = l.Href
+		} else if l.XMLName.Space == "" {
+			link = l.Value
+		}
+	}
+
+	required := map[string]string{
+		"title":           c.Title,
+		"link":            link,
+		"atom:link self":  self,
+		"description":     c.Description,
+		"language":        c.Language,
+		"itunes:author":   c.Author,
+		"itunes:category": c.Category.Text,
+	}
+
+	for name, value := range required {
+		if value == "" {
+			t.Errorf("Missing channel %s", name)
+		}
+	}
+
+	if c.Explicit != "true" && c.Explicit != "false" {
+		t.Errorf("Invalid channel itunes:explicit %q", c.Explicit)
+	}
+
+	guids := map[string]bool{}
+
+	for _, item := range c.Items {
+		if item.Title == "" || item.Enclosure.URL == "" || item.Enclosure.Length == "" || !strings.HasPrefix(item.Enclosure.Type, "audio/") {
+			t.Errorf("Incomplete item %+v", item)
+		}
+
+		if item.GUID.Value == "" || guids[item.GUID.Value] {
+			t.Errorf("Missing or duplicate guid %q", item.GUID.Value)
+		}
+		guids[item.GUID.Value] = true
+
+		if item.GUID.IsPermaLink != "false" {
+			t.Errorf("Expected guid not to be a permalink, got %q", item.GUID.IsPermaLink)
+		}
+
+		if _, err := time.Parse(time.RFC1123Z, item.PubDate); err != nil {
+			t.Errorf("Invalid pubDate %q", item.PubDate)
+		}
+
+		if item.Duration != "" && !itunesDurationPattern.MatchString(item.Duration) {
+			t.Errorf("Invalid itunes:duration %q", item.Duration)
+		}
+
+		if item.Explicit != "true" && item.Explicit != "false" {
+			t.Errorf("Invalid item itunes:explicit %q", item.Explicit)
+		}
+	}
+
+	return feed
+}
+
+func testFeedRequests() []Request {
+	return []Request{
+		{
+			Id:        bson.NewObjectId(),
+			CreatedAt: time.Date(2014, 8, 1, 12, 0, 0, 0, time.UTC),
+			Post: &Post{
+				Title:        "Without artwork & <friends>",
+				URL:          "http://example.com/1",
+				AudioURL:     "https://bucket.s3.amazonaws.com/1.mp3",
+				Length:       1024,
+				Duration:     90*time.Second + 400*time.Millisecond,
+				ProviderName: "Example",
+			},
+		},
+		{
+			Id:        bson.NewObjectId(),
+			CreatedAt: time.Date(2014, 8, 2, 12, 0, 0, 0, time.UTC),
+			Post: &Post{
+				Title:      "With artwork",
+				URL:        "http://example.com/2",
+				AudioURL:   "https://bucket.s3.amazonaws.com/2.wav",
+				Length:     2048,
+				Duration:   2*time.Hour + 3*time.Minute + 4*time.Second,
+				FaviconURL: "http://example.com/favicon.ico",
+				Images:     []Image{{URL: "http://example.com/lead.jpg"}},
+				Authors:    []Author{{Name: "Jane Doe"}, {Name: "John Roe"}},
+			},
+		},
+	}
+}
+
+func TestFeedRSS(t *testing.T) {
+	requests := testFeedRequests()
+
+	var b bytes.Buffer
+	if err := RSSFormat.Write(NewFeed("My articles", "http://example.com/feed/abc.rss", requests), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	feed := validatePodcastFeed(t, b.Bytes())
+	c := feed.Channel
+
+	if c.Image.Href != "http://example.com/lead.jpg" || c.RSSImage.URL != c.Image.Href {
+		t.Errorf("Unexpected channel image %q %q", c.Image.Href, c.RSSImage.URL)
+	}
+
+	if len(c.Items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(c.Items))
+	}
+
+	first, second := c.Items[0], c.Items[1]
+
+	if first.Title != "Without artwork & <friends>" || first.GUID.Value != requests[0].Id.Hex() {
+		t.Errorf("Unexpected item %+v", first)
+	}
+
+	if first.Duration != "00:01:30" || second.Duration != "02:03:04" {
+		t.Errorf("Unexpected durations %q %q", first.Duration, second.Duration)
+	}
+
+	if first.Author != "Example" || second.Author != "Jane Doe, John Roe" {
+		t.Errorf("Unexpected authors %q %q", first.Author, second.Author)
+	}
+
+	if first.Enclosure.Type != "audio/mpeg" || first.Enclosure.Length != "1024" {
+		t.Errorf("Unexpected enclosure %+v", first.Enclosure)
+	}
+}
+
+func TestItunesDuration(t *testing.T) {
+	tests := map[time.Duration]string{
+		0:                "",
+		-time.Second:     "",
+		59 * time.Second: "00:00:59",
+		61 * time.Minute: "01:01:00",
+	}
+
+	for d, expected := range tests {
+		if actual := itunesDuration(d); actual != expected {
+			t.Errorf("itunesDuration(%s) = %q, expected %q", d, actual, expected)
+		}
+	}
+}
+
+func TestAudioContentType(t *testing.T) {
+	tests := map[string]string{
+		"https://bucket.example.com/a.mp3":     "audio/mpeg",
+		"https://example.com/media/a.WAV":      "audio/wav",
+		"https://example.com/listen/a.m4a?x=1": "audio/mp4",
+		"https://example.com/audio/a":          "audio/mpeg",
+		"https://example.com/audio/a.html":     "audio/mpeg",
+	}
+
+	for audioURL, expected := range tests {
+		if actual := audioContentType(audioURL); actual != expected {
+			t.Errorf("audioContentType(%q) = %q, expected %q", audioURL, actual, expected)
+		}
+	}
+}
+
+func TestFeedETag(t *testing.T) {
+	if feedETag("ab", "c", 1) != feedETag("ab", "c", 1) {
+		t.Error("Expected the same ETag for the same parts")
+	}
+
+	// Parts that would concatenate to the same string
+	if feedETag("ab", "c") == feedETag("a", "bc") || feedETag("a", 12) == feedETag("a1", 2) {
+		t.Error("Expected different ETags for different parts")
+	}
+}
+
+func TestFeedAtom(t *testing.T) {
+	requests := testFeedRequests()
+
+	var b bytes.Buffer
+	if err := AtomFormat.Write(NewFeed("My articles", "http://example.com/feed/abc.atom", requests), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	var feed struct {
+		XMLName xml.Name `xml:"http://www.w3.org/2005/Atom feed"`
+		Id      string   `xml:"id"`
+		Updated string   `xml:"updated"`
+		Links   []struct {
+			Href string `xml:"href,attr"`
+			Rel  string `xml:"rel,attr"`
+		} `xml:"link"`
+		Entries []struct {
+			Id    string `xml:"id"`
+			Links []struct {
+				Href   string `xml:"href,attr"`
+				Rel    string `xml:"rel,attr"`
+				Type   string `xml:"type,attr"`
+				Length string `xml:"length,attr"`
+			} `xml:"link"`
+		} `xml:"entry"`
+	}
+
+	if err := xml.Unmarshal(b.Bytes(), &feed); err != nil {
+		t.Fatalf("Invalid Atom: %v\n%s", err, b.Bytes())
+	}
+
+	if feed.Id != "http://example.com/feed/abc.atom" || feed.Links[0].Rel != "self" || feed.Links[0].Href != feed.Id {
+		t.Errorf("Unexpected feed id and links %s %+v", feed.Id, feed.Links)
+	}
+
+	if feed.Updated != "2014-08-02T12:00:00Z" {
+		t.Errorf("Expected the newest item's date, got %s", feed.Updated)
+	}
+
+	if len(feed.Entries) != 2 {
+		t.Fatalf("Expected 2 entries, got %d", len(feed.Entries))
+	}
+
+	enclosure := feed.Entries[1].Links[1]
+
+	if enclosure.Rel != "enclosure" || enclosure.Href != requests[1].ListenURL() || enclosure.Length != "2048" || !strings.HasPrefix(enclosure.Type, "audio/") {
+		t.Errorf("Unexpected enclosure %+v", enclosure)
+	}
+}
+
+func TestFeedJSON(t *testing.T) {
+	requests := testFeedRequests()
+
+	var b bytes.Buffer
+	if err := JSONFeedFormat.Write(NewFeed("My articles", "http://example.com/feed/abc.json", requests), &b); err != nil {
+		t.Fatal(err)
+	}
+
+	var feed map[string]interface{}
+	if err := json.Unmarshal(b.Bytes(), &feed); err != nil {
+		t.Fatalf("Invalid JSON: %v\n%s", err, b.Bytes())
+	}
+
+	if feed["version"] != jsonFeedVersion || feed["title"] != "My articles" || feed["feed_url"] != "http://example.com/feed/abc.json" {
+		t.Errorf("Unexpected feed %v", feed)
+	}
+
+	items := feed["items"].([]interface{})
+	if len(items) != 2 {
+		t.Fatalf("Expected 2 items, got %d", len(items))
+	}
+
+	item := items[0].(map[string]interface{})
+	attachment := item["attachments"].([]interface{})[0].(map[string]interface{})
+
+	if item["id"] != requests[0].Id.Hex() || item["date_published"] != "2014-08-01T12:00:00Z" {
+		t.Errorf("Unexpected item %v", item)
+	}
+
+	if attachment["mime_type"] != "audio/mpeg" || attachment["size_in_bytes"] != 1024.0 || attachment["duration_in_seconds"] != 90.0 {
+		t.Errorf("Unexpected attachment %v", attachment)
+	}
+}
+
+func TestParseFeedPath(t *testing.T) {
+	tests := []struct {
+		segment    string
+		accept     string
+		token      string
+		format     string
+		negotiated bool
+	}{
+		{"abc", "", "abc", "rss", true},
+		{"abc.rss", "application/json", "abc", "rss", false},
+		{"abc.atom", "", "abc", "atom", false},
+		{"abc.json", "", "abc", "json", false},
+		{"abc", "application/atom+xml", "abc", "atom", true},
+		{"abc", "text/html, application/feed+json;q=0.9", "abc", "json", true},
+		{"abc", "*/*", "abc", "rss", true},
+		{"+15551234567.atom", "", "+15551234567", "atom", false},
+	}
+
+	for _, test := range tests {
+		token, format, negotiated := ParseFeedPath(test.segment, test.accept)
+
+		if token != test.token || format.Name != test.format || negotiated != test.negotiated {
+			t.Errorf("ParseFeedPath(%q, %q) = %q %s %v", test.segment, test.accept, token, format.Name, negotiated)
+		}
+	}
+}
+
+func TestFeedPaginate(t *testing.T) {
+	tests := []struct {
+		page, lastPage int
+		expected       FeedPages
+		self           string
+	}{
+		{1, 1, FeedPages{}, "http://x/f.rss"},
+		{1, 3, FeedPages{First: "http://x/f.rss", Next: "http://x/f.rss?page=2", Last: "http://x/f.rss?page=3"}, "http://x/f.rss"},
+		{2, 3, FeedPages{First: "http://x/f.rss", Previous: "http://x/f.rss", Next: "http://x/f.rss?page=3", Last: "http://x/f.rss?page=3"}, "http://x/f.rss?page=2"},
+		{3, 3, FeedPages{First: "http://x/f.rss", Previous: "http://x/f.rss?page=2", Last: "http://x/f.rss?page=3"}, "http://x/f.rss?page=3"},
+	}
+
+	for _, test := range tests {
+		feed := &Feed{}
+		feed.Paginate("http://x/f.rss", test.page, test.lastPage)
+
+		if feed.Pages != test.expected || feed.FeedURL != test.self {
+			t.Errorf("Page %d of %d: got %+v %s", test.page, test.lastPage, feed.Pages, feed.FeedURL)
+		}
+	}
+}
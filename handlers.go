@@ -4,32 +4,42 @@ import (
 	"bytes"
 	"encoding/json"
 	"encoding/xml"
+	"errors"
+	"fmt"
 	"html/template"
 	"io/ioutil"
 	"log"
 	"net/http"
 	"os"
-	"regexp"
+	"path"
 	"strconv"
 	"strings"
 	"time"
 
-	"github.com/gorilla/feeds"
 	"github.com/gorilla/mux"
+	"github.com/jpadilla/rttm/services"
+	"github.com/jpadilla/rttm/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
 )
 
-const (
-	itunesRFC822 = "Mon, 2 Jan 2006 15:04:05 MST"
-)
+const defaultFeedPageSize = 50
 
 type submitData struct {
 	URL     string
 	Title   string
 	Phone   string
+	Jobs    []*Job
 	Errors  map[string]string
 	Success bool
 }
 
+// URLs returns the distinct URLs entered, one per line.
+func (data *submitData) URLs() []string {
+	urls, _ := ExtractURLs(data.URL, maxURLsPerMessage())
+	return urls
+}
+
 func (data *submitData) validate() bool {
 	data.Errors = make(map[string]string)
 
@@ -38,13 +48,22 @@ func (data *submitData) validate() bool {
 		data.Errors["Phone"] = "Required"
 	}
 
-	// Validate URL
-	if strings.TrimSpace(data.URL) == "" {
+	// Validate URLs, one per line
+	lines := strings.Fields(data.URL)
+
+	if len(lines) == 0 {
 		data.Errors["URL"] = "Required"
 	}
 
-	if IsValidURL(data.URL) == false {
-		data.Errors["URL"] = "Invalid URL"
+	for _, line := range lines {
+		if IsValidURL(line) == false {
+			data.Errors["URL"] = "Invalid URL: " + line
+			break
+		}
+	}
+
+	if _, dropped := ExtractURLs(data.URL, maxURLsPerMessage()); dropped > 0 {
+		data.Errors["URL"] = fmt.Sprintf("Send at most %d URLs at a time", maxURLsPerMessage())
 	}
 
 	return len(data.Errors) == 0
@@ -56,7 +75,55 @@ type apiRequest struct {
 }
 
 type apiResponse struct {
-	URL string `json:"url"`
+	OK        bool   `json:"ok"`
+	JobId     string `json:"job_id"`
+	StatusURL string `json:"status_url"`
+}
+
+type jobResponse struct {
+	Id        string    `json:"id"`
+	URL       string    `json:"url"`
+	State     string    `json:"state"`
+	Done      bool      `json:"done"`
+	Error     string    `json:"error,omitempty"`
+	Attempts  int       `json:"attempts"`
+	RequestId string    `json:"request_id,omitempty"`
+	PostId    string    `json:"post_id,omitempty"`
+	ViewURL   string    `json:"view_url,omitempty"`
+	AudioURL  string    `json:"audio_url,omitempty"`
+	StatusURL string    `json:"status_url"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+func newJobResponse(job *Job) *jobResponse {
+	response := &jobResponse{
+		Id:        job.Id.Hex(),
+		URL:       job.URL,
+		State:     job.State,
+		Done:      job.State == JobDone || job.State == JobDead,
+		Error:     job.Error,
+		Attempts:  job.Attempts,
+		AudioURL:  job.AudioURL,
+		StatusURL: "/jobs/" + job.Id.Hex(),
+		CreatedAt: job.CreatedAt,
+		UpdatedAt: job.UpdatedAt,
+	}
+
+	if job.APIKeyId.Valid() {
+		response.StatusURL = "/api/jobs/" + job.Id.Hex()
+	}
+
+	if job.PostId.Valid() {
+		response.PostId = job.PostId.Hex()
+	}
+
+	if job.RequestId.Valid() {
+		response.RequestId = job.RequestId.Hex()
+		response.ViewURL = "/" + job.RequestId.Hex()
+	}
+
+	return response
 }
 
 func APIHandler(w http.ResponseWriter, r *http.Request) {
@@ -70,46 +137,43 @@ func APIHandler(w http.ResponseWriter, r *http.Request) {
 
 	err = json.Unmarshal(body, &data)
 	if err != nil {
-		renderError(w, err)
+		renderJSONError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	w.Header().Set("Content-Type", "application/json")
-	w.Write([]byte(`{"ok":true}`))
-
-	go func(text string, callback string) {
-		playlist, err := CreateTTS(text)
-		if err != nil {
-			renderError(w, err)
-			return
-		}
-
-		mp3Url := UploadPlaylist(playlist)
-		log.Println("Uploaded public file to ", mp3Url)
+	if strings.TrimSpace(data.Text) == "" {
+		renderJSONError(w, http.StatusBadRequest, "text is required")
+		return
+	}
 
-		response := apiResponse{mp3Url}
+	if err = ValidateCallbackURL(data.CallbackURL); err != nil {
+		renderJSONError(w, http.StatusBadRequest, err.Error())
+		return
+	}
 
-		jsonResponse, err := json.Marshal(response)
-		if err != nil {
-			renderError(w, err)
-			return
-		}
+	if _, err = callbackSecret(); err != nil {
+		renderJSONError(w, http.StatusServiceUnavailable, err.Error())
+		return
+	}
 
-		req, err := http.NewRequest("POST", callback, bytes.NewBuffer(jsonResponse))
-		req.Header.Set("Content-Type", "application/json")
+	apiKey := RequestAPIKey(r)
 
-		log.Println("Sending data to callback", callback)
+	if !consume(APIKeyQuota, "apikey", apiKey.Id.Hex(), len([]rune(data.Text))) {
+		renderJSONError(w, http.StatusTooManyRequests, "Daily character quota exceeded")
+		return
+	}
 
-		client := &http.Client{}
-		resp, err := client.Do(req)
-		if err != nil {
-			log.Println("Error sending data to callback", err)
-		}
-		defer resp.Body.Close()
+	job, err := EnqueueTextJob(data.Text, data.CallbackURL, apiKey)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
 
-		log.Println("response Status:", resp.Status)
-		log.Println("response Headers:", resp.Header)
-	}(data.Text, data.CallbackURL)
+	renderJSON(w, http.StatusAccepted, apiResponse{
+		OK:        true,
+		JobId:     job.Id.Hex(),
+		StatusURL: "/api/jobs/" + job.Id.Hex(),
+	})
 }
 
 func SubmitHandler(w http.ResponseWriter, r *http.Request) {
@@ -144,53 +208,335 @@ func postSubmitHandler(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	if !allow(IPLimiter, "ip", ClientIP(r)) || !allow(PhoneLimiter, "phone", phone) {
+		data.Errors["Generic"] = rateLimitMessage
+		w.WriteHeader(http.StatusTooManyRequests)
+		render(w, "templates/submit.html", data)
+		return
+	}
+
+	jobs, err := EnqueueJobs(data.URLs(), phone)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+
 	data.URL = ""
+	data.Jobs = jobs
 	data.Success = true
 	render(w, "templates/submit.html", data)
-
-	log.Println("Running goroutine...")
-	go CreateRequest(url, phone)
 }
 
 func TwilioCallbackHandler(w http.ResponseWriter, r *http.Request) {
-	if r.Method == "POST" {
-		body := ""
-		to := r.FormValue("To")
-		accountSid := r.FormValue("AccountSid")
+	to := r.FormValue("To")
+	accountSid := r.FormValue("AccountSid")
+
+	if to != os.Getenv("TWILIO_NUMBER") || accountSid != os.Getenv("TWILIO_ACCOUNT_SID") {
+		http.Error(w, "Invalid number or Sid", http.StatusInternalServerError)
+		return
+	}
+
+	command := ParseSMSCommand(r.FormValue("Body"))
+
+	reply, err := HandleSMSCommand(r.FormValue("From"), command)
+	if err != nil {
+		log.Println("Error handling SMS", command.Name, err)
+		reply = "Sorry, something went wrong on our end. Please try again later."
+	}
+
+	renderTwiML(w, reply)
+}
 
-		if to != os.Getenv("TWILIO_NUMBER") || accountSid != os.Getenv("TWILIO_ACCOUNT_SID") {
-			http.Error(w, "Invalid number or Sid", http.StatusInternalServerError)
+type signInData struct {
+	Phone    string
+	CodeSent bool
+	Errors   map[string]string
+}
+
+// SignInHandler texts a one-time code to the phone entered and signs in
+// whoever enters it back.
+func SignInHandler(w http.ResponseWriter, r *http.Request) {
+	data := &signInData{
+		Phone:  strings.TrimSpace(r.FormValue("phone")),
+		Errors: make(map[string]string),
+	}
+
+	if r.Method == "GET" {
+		render(w, "templates/signin.html", data)
+		return
+	}
+
+	if data.Phone == "" {
+		data.Errors["Phone"] = "Required"
+		render(w, "templates/signin.html", data)
+		return
+	}
+
+	if code := r.FormValue("code"); code != "" {
+		user, err := VerifyLoginCode(data.Phone, code)
+		if err == errInvalidCode {
+			data.CodeSent = true
+			data.Errors["Code"] = err.Error()
+			render(w, "templates/signin.html", data)
 			return
 		}
 
-		words := regexp.MustCompile(`(\s+)`).Split(r.FormValue("Body"), -1)
+		if err != nil {
+			renderError(w, err)
+			return
+		}
 
-		// Look for and extract valid URL in Body
-		for _, word := range words {
-			if IsValidURL(word) {
-				body = word
+		SignIn(w, user)
+		http.Redirect(w, r, "/account", http.StatusSeeOther)
+		return
+	}
+
+	err := sendLoginCode(r, data.Phone, "")
+	if err == errRateLimited {
+		data.Errors["Generic"] = rateLimitMessage
+		w.WriteHeader(http.StatusTooManyRequests)
+		render(w, "templates/signin.html", data)
+		return
+	}
+
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+
+	data.CodeSent = true
+	render(w, "templates/signin.html", data)
+}
+
+var errRateLimited = errors.New(rateLimitMessage)
+
+// sendLoginCode texts phone a new code. It returns errRateLimited when too
+// many codes were requested, or the error storing the code, in which case
+// none was sent.
+func sendLoginCode(r *http.Request, phone string, userId bson.ObjectId) error {
+	if !allow(IPLimiter, "ip", ClientIP(r)) || !allow(PhoneLimiter, "signin", phone) {
+		return errRateLimited
+	}
+
+	code, err := CreateLoginCode(phone, userId)
+	if err != nil {
+		return err
+	}
+
+	if err = services.SendSMS(phone, "Your Read This To Me code is "+code); err != nil {
+		log.Println("Error sending login code", err)
+	}
+
+	return nil
+}
+
+func SignOutHandler(w http.ResponseWriter, r *http.Request) {
+	SignOut(w)
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+type accountData struct {
+	User      *User
+	CSRFToken string
+	FeedURL   string
+	Phone     string
+	CodeSent  bool
+	Saved     bool
+	Rotated   bool
+	Errors    map[string]string
+}
+
+// speechRates are the SSML prosody rates offered, "" being the default.
+var speechRates = []string{"", "x-slow", "slow", "medium", "fast", "x-fast"}
+
+func (data *accountData) Rates() []string {
+	return speechRates
+}
+
+// AccountHandler shows and updates the signed in user's preferences.
+func AccountHandler(w http.ResponseWriter, r *http.Request) {
+	data := &accountData{
+		User:      CurrentUser(r),
+		CSRFToken: CSRFToken(r),
+		Errors:    make(map[string]string),
+	}
+
+	if r.Method == "POST" {
+		data.User.Email = r.FormValue("email")
+		data.User.Voice = strings.TrimSpace(r.FormValue("voice"))
+		if data.User.Voice != "" {
+			voice, ok := services.FindVoice(Synthesizer, data.User.Voice)
+			if !ok {
+				data.Errors["Voice"] = "Choose one of " + strings.Join(Synthesizer.Voices(), ", ")
+				renderAccount(w, data)
+				return
+			}
+			data.User.Voice = voice
+		}
+		data.User.SpeechRate = ""
+		for _, rate := range speechRates {
+			if rate == r.FormValue("rate") {
+				data.User.SpeechRate = rate
 			}
 		}
+		data.User.FeedTitle = strings.TrimSpace(r.FormValue("feed_title"))
 
-		if body == "" {
-			http.Error(w, "", http.StatusInternalServerError)
+		limit, err := strconv.Atoi(r.FormValue("feed_limit"))
+		if r.FormValue("feed_limit") != "" && (err != nil || limit < 0) {
+			data.Errors["FeedLimit"] = "Must be a positive number"
+			renderAccount(w, data)
 			return
 		}
 
-		data := &submitData{
-			URL:   body,
-			Phone: r.FormValue("From"),
+		data.User.FeedLimit = limit
+
+		if err = data.User.Update(); err != nil {
+			renderError(w, err)
+			return
 		}
 
-		if data.validate() == false {
-			log.Println("Errors", data.Errors)
-			http.Error(w, "", http.StatusInternalServerError)
+		data.Saved = true
+	}
+
+	renderAccount(w, data)
+}
+
+// AccountFeedHandler gives the signed in user a new private feed URL.
+func AccountFeedHandler(w http.ResponseWriter, r *http.Request) {
+	data := &accountData{
+		User:      CurrentUser(r),
+		CSRFToken: CSRFToken(r),
+		Errors:    make(map[string]string),
+	}
+
+	if err := data.User.RotateFeedToken(); err != nil {
+		renderError(w, err)
+		return
+	}
+
+	data.Rotated = true
+	renderAccount(w, data)
+}
+
+func renderAccount(w http.ResponseWriter, data *accountData) {
+	feedURL, err := data.User.FeedURL()
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+
+	data.FeedURL = feedURL
+	render(w, "templates/account.html", data)
+}
+
+// AccountPhoneHandler adds a phone number to the signed in user once they
+// enter the code texted to it.
+func AccountPhoneHandler(w http.ResponseWriter, r *http.Request) {
+	data := &accountData{
+		User:      CurrentUser(r),
+		CSRFToken: CSRFToken(r),
+		Phone:     strings.TrimSpace(r.FormValue("phone")),
+		Errors:    make(map[string]string),
+	}
+
+	if data.Phone == "" {
+		data.Errors["Phone"] = "Required"
+		renderAccount(w, data)
+		return
+	}
+
+	if code := r.FormValue("code"); code != "" {
+		user, err := VerifyLoginCode(data.Phone, code)
+		if err == errInvalidCode {
+			data.CodeSent = true
+			data.Errors["Code"] = err.Error()
+			renderAccount(w, data)
 			return
 		}
 
-		log.Println("Running goroutine...")
-		go CreateRequest(data.URL, data.Phone)
+		if err == nil && user.Id != data.User.Id {
+			err = fmt.Errorf("%s belongs to another account", data.Phone)
+		}
+
+		if err != nil {
+			data.Errors["Phone"] = err.Error()
+			renderAccount(w, data)
+			return
+		}
+
+		data.User = user
+		data.Phone = ""
+		data.Saved = true
+		renderAccount(w, data)
+		return
+	}
+
+	if owner, err := GetUserByPhone(data.Phone); err == nil && owner.Id != data.User.Id {
+		data.Errors["Phone"] = data.Phone + " belongs to another account"
+		renderAccount(w, data)
+		return
+	}
+
+	err := sendLoginCode(r, data.Phone, data.User.Id)
+	if err == errRateLimited {
+		data.Errors["Phone"] = rateLimitMessage
+		w.WriteHeader(http.StatusTooManyRequests)
+		renderAccount(w, data)
+		return
+	}
+
+	if err != nil {
+		renderError(w, err)
+		return
 	}
+
+	data.CodeSent = true
+	renderAccount(w, data)
+}
+
+// JobStatusHandler shows the progress of an article submitted over SMS or
+// the web at /jobs/{id}, or as JSON at /jobs/{id}.json for the page to poll.
+// API jobs are only visible to their key, through APIJobHandler.
+func JobStatusHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := strings.TrimSuffix(params["id"], ".json")
+
+	job, err := GetJobById(id)
+	if err == nil && job.APIKeyId.Valid() {
+		err = mgo.ErrNotFound
+	}
+
+	if err != nil {
+		log.Println("Errors", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	if id != params["id"] {
+		renderJSON(w, http.StatusOK, newJobResponse(job))
+		return
+	}
+
+	render(w, "templates/status.html", newJobResponse(job))
+}
+
+// APIJobHandler returns the status of a job created with the caller's API
+// key.
+func APIJobHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+
+	job, err := GetJobById(params["id"])
+	if err == nil && job.APIKeyId != RequestAPIKey(r).Id {
+		err = mgo.ErrNotFound
+	}
+
+	if err != nil {
+		log.Println("Errors", err)
+		renderJSONError(w, http.StatusNotFound, "not found")
+		return
+	}
+
+	renderJSON(w, http.StatusOK, newJobResponse(job))
 }
 
 func ViewHandler(w http.ResponseWriter, r *http.Request) {
@@ -206,52 +552,157 @@ func ViewHandler(w http.ResponseWriter, r *http.Request) {
 	render(w, "templates/view.html", result)
 }
 
+// ListenHandler streams a request's audio at /listen/{id}, optionally with
+// the audio's extension, and counts the download towards the request. Audio
+// in stores the app does not serve itself, like S3, is redirected to.
+func ListenHandler(w http.ResponseWriter, r *http.Request) {
+	params := mux.Vars(r)
+	id := strings.TrimSuffix(params["id"], path.Ext(params["id"]))
+
+	request, err := GetRequestById(id)
+	if err != nil || request.Post.AudioURL == "" {
+		log.Println("Not found", err)
+		http.NotFound(w, r)
+		return
+	}
+
+	post := request.Post
+	cw := &countingWriter{ResponseWriter: w}
+
+	if opener, ok := Store.(storage.Opener); ok && post.AudioKey != "" {
+		blob, err := opener.Open(post.AudioKey)
+		if err == storage.ErrNotFound {
+			log.Println("Missing audio", post.AudioKey)
+			http.NotFound(w, r)
+			return
+		}
+
+		if err != nil {
+			log.Println(err)
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+		defer blob.Close()
+
+		storage.Serve(cw, r, post.AudioKey, blob)
+	} else {
+		http.Redirect(cw, r, post.AudioURL, http.StatusFound)
+
+		// The redirect's body is not audio
+		cw.bytes = 0
+	}
+
+	if r.Method == "GET" {
+		if err = RecordDownload(request.Id, cw.status, cw.bytes); err != nil {
+			log.Println(err)
+		}
+	}
+}
+
+// FeedHandler serves a user's podcast at their private /feed/{token} URL as
+// RSS, Atom or JSON Feed, chosen by a .rss, .atom or .json suffix or else the
+// Accept header. Old /feed/{phone} URLs are gone.
 func FeedHandler(w http.ResponseWriter, r *http.Request) {
 	params := mux.Vars(r)
+	token, format, negotiated := ParseFeedPath(params["token"], r.Header.Get("Accept"))
+
+	if isPhoneNumber(token) {
+		phoneFeedHandler(w, r)
+		return
+	}
 
-	requests, err := FindRequestsByPhone(params["phone"])
-	log.Println(requests, err)
+	user, err := GetUserByFeedToken(token)
 	if err != nil {
 		log.Println("Not found", err)
 		http.NotFound(w, r)
 		return
 	}
 
-	feed := &feeds.RssFeed{
-		Title:       "RTTM",
-		Link:        "http://rttm.herokuapp.com",
-		Description: "Read this to me",
-		PubDate:     time.Now().Format(itunesRFC822),
+	count, newest, err := RequestStats(user.Id)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+
+	limit := user.FeedLimit
+	if limit <= 0 {
+		limit = envInt("FEED_PAGE_SIZE", defaultFeedPageSize)
 	}
 
-	for _, request := range requests {
-		item := &feeds.RssItem{
-			Title:       request.Post.Title,
-			Link:        request.Post.URL,
-			Description: request.Post.GetShortDescription(),
-			PubDate:     request.CreatedAt.Format(itunesRFC822),
-			Enclosure: &feeds.RssEnclosure{
-				Url:    request.Post.AudioURL,
-				Length: strconv.Itoa(request.Post.Length),
-				Type:   "audio/mpeg",
-			},
-		}
+	// An empty feed still has its first page
+	lastPage := (count + limit - 1) / limit
+	if lastPage < 1 {
+		lastPage = 1
+	}
+	page, err := strconv.Atoi(r.FormValue("page"))
+
+	if r.FormValue("page") == "" {
+		page = 1
+	} else if err != nil || page < 1 || page > lastPage {
+		http.NotFound(w, r)
+		return
+	}
+
+	title := user.FeedTitle
+	if title == "" {
+		title = "RTTM"
+	}
+
+	if negotiated {
+		w.Header().Set("Vary", "Accept")
+	}
+
+	// No Last-Modified: deleting an older request changes the feed without
+	// changing any timestamp, but it does change the count in the ETag
+	w.Header().Set("Cache-Control", "private, max-age=300")
+	w.Header().Set("ETag", feedETag(token, format.Name, title, page, limit, count, newest.UnixNano(), user.UpdatedAt.UnixNano()))
 
-		feed.Items = append(feed.Items, item)
+	if notModified(r, w.Header().Get("ETag")) {
+		w.WriteHeader(http.StatusNotModified)
+		return
 	}
 
-	x := feed.FeedXml()
+	requests, err := FindRequestsByUser(user.Id, (page-1)*limit, limit)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
 
-	// write default xml header, without the newline
-	if _, err := w.Write([]byte(xml.Header[:len(xml.Header)-1])); err != nil {
+	feedURL, err := user.FeedURL()
+	if err != nil {
 		renderError(w, err)
 		return
 	}
 
-	e := xml.NewEncoder(w)
-	e.Indent("", "  ")
+	feed := NewFeed(title, feedURL+"."+format.Name, requests)
+	feed.Paginate(feed.FeedURL, page, lastPage)
+
+	w.Header().Set("Content-Type", format.ContentType)
+
+	if err = format.Write(feed, w); err != nil {
+		log.Println("Error writing feed", err)
+	}
+}
+
+// notModified reports whether r's If-None-Match header matches etag, so the
+// client's copy is still current.
+func notModified(r *http.Request, etag string) bool {
+	for _, candidate := range strings.Split(r.Header.Get("If-None-Match"), ",") {
+		candidate = strings.TrimPrefix(strings.TrimSpace(candidate), "W/")
+
+		if candidate == etag || candidate == "*" {
+			return true
+		}
+	}
+
+	return false
+}
 
-	e.Encode(x)
+// phoneFeedHandler answers requests for a deprecated phone feed URL. Anyone
+// who knows a phone number could fetch it, so it never leads to the private
+// feed; the owner has to text FEED for the new link.
+func phoneFeedHandler(w http.ResponseWriter, r *http.Request) {
+	http.Error(w, "This feed has moved. Text FEED to get your new private link.", http.StatusGone)
 }
 
 func IconHandler(w http.ResponseWriter, r *http.Request) {
@@ -271,6 +722,35 @@ func render(w http.ResponseWriter, filename string, data interface{}) {
 	}
 }
 
+func renderJSON(w http.ResponseWriter, status int, data interface{}) {
+	b, err := json.Marshal(data)
+	if err != nil {
+		renderError(w, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(b)
+}
+
+func renderJSONError(w http.ResponseWriter, status int, message string) {
+	renderJSON(w, status, map[string]string{"error": message})
+}
+
+// renderTwiML replies to an inbound Twilio SMS with message.
+func renderTwiML(w http.ResponseWriter, message string) {
+	var b bytes.Buffer
+
+	b.WriteString(xml.Header)
+	b.WriteString("<Response><Message>")
+	xml.EscapeText(&b, []byte(message))
+	b.WriteString("</Message></Response>")
+
+	w.Header().Set("Content-Type", "text/xml")
+	w.Write(b.Bytes())
+}
+
 func renderError(w http.ResponseWriter, err error) {
 	log.Println(err)
 	http.Error(w, err.Error(), http.StatusInternalServerError)
@@ -0,0 +1,196 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/context"
+	"github.com/gorilla/mux"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestNewJobResponse(t *testing.T) {
+	job := &Job{
+		Id:        bson.NewObjectId(),
+		URL:       "http://example.com",
+		State:     JobDone,
+		RequestId: bson.NewObjectId(),
+	}
+
+	response := newJobResponse(job)
+
+	if !response.Done {
+		t.Error("Expected done job")
+	}
+
+	if response.ViewURL != "/"+job.RequestId.Hex() || response.StatusURL != "/jobs/"+job.Id.Hex() {
+		t.Errorf("Unexpected URLs %s %s", response.ViewURL, response.StatusURL)
+	}
+
+	if response.PostId != "" {
+		t.Errorf("Expected empty post id, got %s", response.PostId)
+	}
+}
+
+func TestStatusTemplate(t *testing.T) {
+	job := &Job{Id: bson.NewObjectId(), URL: "http://example.com", State: JobSynthesizing}
+	w := httptest.NewRecorder()
+
+	render(w, "templates/status.html", newJobResponse(job))
+
+	if !strings.Contains(w.Body.String(), "synthesizing") || !strings.Contains(w.Body.String(), "poll();") {
+		t.Error("Expected status page to show the state and poll for updates")
+	}
+}
+
+func TestSubmitDataValidate(t *testing.T) {
+	tests := []struct {
+		urls  string
+		valid bool
+	}{
+		{"", false},
+		{"http://example.com", true},
+		{"http://example.com\r\nhttp://example.org\n\nhttp://example.com", true},
+		{"http://example.com\nnot a url", false},
+		{"http://a.com/1 http://a.com/2 http://a.com/3 http://a.com/4 http://a.com/5 http://a.com/6", false},
+	}
+
+	for _, test := range tests {
+		data := &submitData{URL: test.urls, Phone: "+15551234567"}
+
+		if data.validate() != test.valid {
+			t.Errorf("%q: expected valid=%v, got %v", test.urls, test.valid, data.Errors)
+		}
+	}
+
+	data := &submitData{URL: "http://example.com\nhttp://example.org\nhttp://example.com"}
+
+	if urls := data.URLs(); len(urls) != 2 {
+		t.Errorf("Expected duplicate URLs to be removed, got %q", urls)
+	}
+}
+
+func TestSubmitTemplate(t *testing.T) {
+	job := &Job{Id: bson.NewObjectId(), URL: "http://example.com/post"}
+	w := httptest.NewRecorder()
+
+	render(w, "templates/submit.html", &submitData{Success: true, Jobs: []*Job{job}})
+
+	if !strings.Contains(w.Body.String(), `href="/jobs/`+job.Id.Hex()+`"`) {
+		t.Error("Expected submit page to link to the job status page")
+	}
+}
+
+func TestPhoneFeedHandlerGone(t *testing.T) {
+	r := httptest.NewRequest("GET", "/feed/+15551234567", nil)
+	w := httptest.NewRecorder()
+	phoneFeedHandler(w, r)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("Expected 410, got %d", w.Code)
+	}
+}
+
+func TestFeedHandlerEmpty(t *testing.T) {
+	defer withTestDB(t)()
+
+	user, err := FindOrCreateUserByPhone("+15555550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = user.RotateFeedToken(); err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/feed/{token}", FeedHandler)
+
+	for page, code := range map[string]int{"": http.StatusOK, "1": http.StatusOK, "2": http.StatusNotFound} {
+		r := httptest.NewRequest("GET", "/feed/"+user.FeedToken+".rss?page="+page, nil)
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+
+		if w.Code != code {
+			t.Errorf("Page %q: expected %d, got %d", page, code, w.Code)
+		}
+	}
+}
+
+func TestNotModified(t *testing.T) {
+	tests := []struct {
+		header   string
+		value    string
+		expected bool
+	}{
+		{"", "", false},
+		{"If-None-Match", `"abc"`, true},
+		{"If-None-Match", `"xyz", W/"abc"`, true},
+		{"If-None-Match", `"xyz"`, false},
+		{"If-None-Match", "*", true},
+		{"If-Modified-Since", time.Now().Format(http.TimeFormat), false},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/feed/abc", nil)
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+
+		if notModified(r, `"abc"`) != test.expected {
+			t.Errorf("%s: %s should be %v", test.header, test.value, test.expected)
+		}
+	}
+}
+
+func TestJobHandlersScope(t *testing.T) {
+	defer withTestDB(t)()
+
+	owner := &APIKey{Id: bson.NewObjectId()}
+
+	apiJob, err := EnqueueTextJob("Hello", "", owner)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	smsJob, err := EnqueueJob("http://example.com/a", "+15555550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	router := mux.NewRouter()
+	router.HandleFunc("/api/jobs/{id}", APIJobHandler)
+	router.HandleFunc("/jobs/{id}", JobStatusHandler)
+
+	get := func(path string, key *APIKey) int {
+		r := httptest.NewRequest("GET", path, nil)
+		if key != nil {
+			context.Set(r, apiKeyContextKey, key)
+		}
+
+		w := httptest.NewRecorder()
+		router.ServeHTTP(w, r)
+		return w.Code
+	}
+
+	tests := []struct {
+		path     string
+		key      *APIKey
+		expected int
+	}{
+		{"/api/jobs/" + apiJob.Id.Hex(), owner, http.StatusOK},
+		{"/api/jobs/" + apiJob.Id.Hex(), &APIKey{Id: bson.NewObjectId()}, http.StatusNotFound},
+		{"/api/jobs/" + smsJob.Id.Hex(), owner, http.StatusNotFound},
+		{"/jobs/" + apiJob.Id.Hex() + ".json", nil, http.StatusNotFound},
+		{"/jobs/" + smsJob.Id.Hex() + ".json", nil, http.StatusOK},
+	}
+
+	for _, test := range tests {
+		if code := get(test.path, test.key); code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.path, test.expected, code)
+		}
+	}
+}
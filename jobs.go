@@ -0,0 +1,550 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/jpadilla/rttm/services"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	JobQueued       = "queued"
+	JobRunning      = "running"
+	JobExtracting   = "extracting"
+	JobSynthesizing = "synthesizing"
+	JobUploading    = "uploading"
+	JobNotifying    = "notifying"
+	JobDone         = "done"
+	JobFailed       = "failed"
+	JobDead         = "dead"
+)
+
+const (
+	defaultJobLease       = 10 * time.Minute
+	defaultJobMaxAttempts = 5
+	jobRetryBackoff       = 30 * time.Second
+)
+
+// Job is a unit of article-to-audio work stored in the jobs collection so
+// that it survives restarts. Failed jobs are retried with exponential
+// backoff until MaxAttempts, after which they are moved to JobDead.
+//
+// Jobs with a CallbackURL were submitted through the API: their Text is
+// synthesized directly and the result is POSTed to the callback.
+type Job struct {
+	Id           bson.ObjectId `bson:"_id"`
+	URL          string
+	Phone        string
+	Text         string
+	CallbackURL  string
+	AudioURL     string
+	Deliveries   []Delivery
+	APIKeyId     bson.ObjectId `bson:"apikey_id,omitempty"`
+	State        string
+	Error        string
+	Attempts     int
+	MaxAttempts  int
+	RunAfter     time.Time
+	LeaseOwner   string
+	LeaseExpires time.Time
+	PostId       bson.ObjectId `bson:"post_id,omitempty"`
+	RequestId    bson.ObjectId `bson:"request_id,omitempty"`
+	BatchId      bson.ObjectId `bson:"batch_id,omitempty"`
+	QuotaCharged bool          `bson:"quota_charged,omitempty"`
+	CreatedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+var errQuotaExceeded = errors.New("Daily character quota exceeded")
+
+// errLeaseLost is returned by job updates once another worker has claimed
+// the job, e.g. because this one stalled past its lease.
+var errLeaseLost = errors.New("Job lease lost to another worker")
+
+// permanentError fails a job without further retries.
+type permanentError struct {
+	error
+}
+
+// activeJobStates are the states a job is in while a worker holds its lease.
+var activeJobStates = []string{JobRunning, JobExtracting, JobSynthesizing, JobUploading, JobNotifying}
+
+// EnqueueJob stores a new job converting url and notifying phone.
+func EnqueueJob(url string, phone string) (*Job, error) {
+	return enqueueJob(url, phone, "")
+}
+
+func enqueueJob(url string, phone string, batchId bson.ObjectId) (*Job, error) {
+	now := time.Now()
+	job := &Job{
+		Id:          bson.NewObjectId(),
+		URL:         url,
+		Phone:       phone,
+		BatchId:     batchId,
+		State:       JobQueued,
+		MaxAttempts: jobMaxAttempts(),
+		RunAfter:    now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := JobCollection.Insert(job); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// EnqueueTextJob stores a new job synthesizing text and POSTing the result to
+// callback on behalf of apiKey.
+func EnqueueTextJob(text string, callback string, apiKey *APIKey) (*Job, error) {
+	now := time.Now()
+	job := &Job{
+		Id:          bson.NewObjectId(),
+		Text:        text,
+		CallbackURL: callback,
+		APIKeyId:    apiKey.Id,
+		State:       JobQueued,
+		MaxAttempts: jobMaxAttempts(),
+		RunAfter:    now,
+		CreatedAt:   now,
+		UpdatedAt:   now,
+	}
+
+	if err := JobCollection.Insert(job); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return job, nil
+}
+
+func GetJobById(id string) (*Job, error) {
+	if bson.IsObjectIdHex(id) == false {
+		return nil, fmt.Errorf("Invalid Id: %s", id)
+	}
+
+	job := &Job{}
+	err := JobCollection.FindId(bson.ObjectIdHex(id)).One(&job)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// ClaimJob leases the next runnable job to owner. Jobs whose lease expired
+// while in progress, e.g. because a worker was restarted, are claimed again.
+// It returns mgo.ErrNotFound when there is nothing to do.
+func ClaimJob(owner string, lease time.Duration) (*Job, error) {
+	now := time.Now()
+	query := bson.M{
+		"$or": []bson.M{
+			{"state": bson.M{"$in": []string{JobQueued, JobFailed}}, "runafter": bson.M{"$lte": now}},
+			{"state": bson.M{"$in": activeJobStates}, "leaseexpires": bson.M{"$lt": now}},
+		},
+	}
+
+	change := mgo.Change{
+		Update: bson.M{
+			"$set": bson.M{
+				"state":        JobRunning,
+				"leaseowner":   owner,
+				"leaseexpires": now.Add(lease),
+				"updatedat":    now,
+			},
+			"$inc": bson.M{"attempts": 1},
+		},
+		ReturnNew: true,
+	}
+
+	job := &Job{}
+	_, err := JobCollection.Find(query).Sort("runafter").Apply(change, job)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// SetState records the stage the job reached and extends its lease.
+func (job *Job) SetState(state string) error {
+	job.State = state
+	job.UpdatedAt = time.Now()
+
+	update := bson.M{
+		"state":     job.State,
+		"updatedat": job.UpdatedAt,
+	}
+
+	if state != JobDone {
+		job.LeaseExpires = job.UpdatedAt.Add(defaultJobLease)
+		update["leaseexpires"] = job.LeaseExpires
+	}
+
+	log.Printf("Job %s %s", job.Id.Hex(), state)
+
+	return job.update(bson.M{"$set": update})
+}
+
+// update applies change to the job while this worker still holds its lease.
+// Jobs that were never claimed have no owner and can be updated directly.
+func (job *Job) update(change bson.M) error {
+	err := JobCollection.Update(bson.M{"_id": job.Id, "leaseowner": job.LeaseOwner}, change)
+
+	if err == mgo.ErrNotFound {
+		return errLeaseLost
+	}
+
+	return err
+}
+
+// holdLease renews the job's lease every third of lease until the returned
+// func is called, so that a slow step doesn't let another worker claim it.
+func (job *Job) holdLease(lease time.Duration) func() {
+	done := make(chan struct{})
+	ticker := time.NewTicker(lease / 3)
+
+	go func() {
+		defer ticker.Stop()
+
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				err := JobCollection.Update(
+					bson.M{"_id": job.Id, "leaseowner": job.LeaseOwner, "state": bson.M{"$in": activeJobStates}},
+					bson.M{"$set": bson.M{"leaseexpires": time.Now().Add(lease)}},
+				)
+
+				if err == mgo.ErrNotFound {
+					log.Printf("Job %s: %s", job.Id.Hex(), errLeaseLost)
+					return
+				}
+
+				if err != nil {
+					log.Println("Error renewing job lease", err)
+				}
+			}
+		}
+	}()
+
+	return func() { close(done) }
+}
+
+// Fail records err and schedules a retry, or moves the job to JobDead once
+// it has used all of its attempts or err is permanent.
+func (job *Job) Fail(err error) error {
+	_, permanent := err.(permanentError)
+
+	job.Error = err.Error()
+	job.UpdatedAt = time.Now()
+	job.State = JobFailed
+
+	if permanent || job.Attempts >= job.MaxAttempts {
+		job.State = JobDead
+	} else {
+		job.RunAfter = job.UpdatedAt.Add(job.Backoff())
+	}
+
+	log.Printf("Job %s %s: %s", job.Id.Hex(), job.State, job.Error)
+
+	err = job.update(bson.M{"$set": bson.M{
+		"state":     job.State,
+		"error":     job.Error,
+		"runafter":  job.RunAfter,
+		"updatedat": job.UpdatedAt,
+	}})
+
+	// The job's new owner reports its outcome
+	if err == errLeaseLost {
+		return err
+	}
+
+	if job.State == JobDead && job.CallbackURL != "" {
+		job.deliver(callbackPayload{JobId: job.Id.Hex(), Error: job.Error})
+	}
+
+	if job.State == JobDead && job.BatchId.Valid() {
+		if err := finishBatch(job.BatchId); err != nil {
+			log.Println("Error finishing batch", err)
+		}
+	}
+
+	return err
+}
+
+// Backoff is the wait before the next attempt, doubling after each failure.
+func (job *Job) Backoff() time.Duration {
+	attempts := job.Attempts
+	if attempts < 1 {
+		attempts = 1
+	}
+
+	return jobRetryBackoff << uint(attempts-1)
+}
+
+// Run performs the job. Steps already completed by an earlier attempt are
+// skipped.
+func (job *Job) Run() (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("%v", r)
+		}
+	}()
+
+	if job.CallbackURL != "" {
+		return job.runText()
+	}
+
+	return job.runArticle()
+}
+
+// runText synthesizes the job's text into a Post and POSTs the audio URL to
+// its callback.
+func (job *Job) runText() error {
+	if job.AudioURL == "" {
+		post, err := job.textPost()
+		if err != nil {
+			return err
+		}
+
+		job.AudioURL = post.AudioURL
+
+		if err = job.update(bson.M{"$set": bson.M{"audiourl": job.AudioURL}}); err != nil {
+			return err
+		}
+	}
+
+	if err := job.SetState(JobNotifying); err != nil {
+		return err
+	}
+
+	if err := job.deliver(callbackPayload{JobId: job.Id.Hex(), URL: job.AudioURL}); err != nil {
+		return err
+	}
+
+	return job.SetState(JobDone)
+}
+
+// textPost returns the Post holding the audio of the job's text, made by an
+// earlier attempt or else synthesized now. The post's ID is stored on the
+// job before uploading, so a retry uploads to the same key and skips audio
+// that is already there.
+func (job *Job) textPost() (*Post, error) {
+	if job.PostId.Valid() {
+		post, err := GetPostById(job.PostId)
+		if err != mgo.ErrNotFound {
+			return post, err
+		}
+	}
+
+	if err := job.SetState(JobSynthesizing); err != nil {
+		return nil, err
+	}
+
+	speech, err := CreateTTS(job.Text, services.SpeechOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = job.SetState(JobUploading); err != nil {
+		return nil, err
+	}
+
+	post := &Post{
+		Id:        job.PostId,
+		Text:      strings.TrimSpace(job.Text),
+		APIKeyId:  job.APIKeyId,
+		CreatedAt: time.Now(),
+	}
+
+	if !post.Id.Valid() {
+		post.Id = bson.NewObjectId()
+		if err = job.setPost(post); err != nil {
+			return nil, err
+		}
+	}
+
+	if err = post.SetSpeech(speech); err != nil {
+		return nil, err
+	}
+
+	if err = post.Save(); err != nil {
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// deliver POSTs payload to the job's callback and stores every attempt.
+func (job *Job) deliver(payload callbackPayload) error {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	return DeliverCallback(job.CallbackURL, body, func(delivery Delivery) {
+		job.Deliveries = append(job.Deliveries, delivery)
+
+		if err := job.update(bson.M{"$push": bson.M{"deliveries": delivery}}); err != nil {
+			log.Println("Error recording delivery", err)
+		}
+	})
+}
+
+// runArticle converts the job's URL into a Post, records a Request for the
+// phone and notifies it.
+func (job *Job) runArticle() error {
+	post, err := job.findPost()
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+
+	if err == mgo.ErrNotFound {
+		if err = job.SetState(JobExtracting); err != nil {
+			return err
+		}
+
+		post, err = ExtractPost(job.URL)
+		if err == services.ErrNoText {
+			// Retrying won't make text appear
+			return permanentError{err}
+		}
+		if err != nil {
+			return err
+		}
+
+		// Record the post's ID before anything is stored under it, so that
+		// retries find the post once it is saved
+		if job.PostId.Valid() {
+			post.Id = job.PostId
+		} else if err = job.setPost(post); err != nil {
+			return err
+		}
+
+		if err = job.SetState(JobSynthesizing); err != nil {
+			return err
+		}
+
+		// Retries after a failed synthesis have already been counted
+		if !job.QuotaCharged {
+			if !consume(PhoneQuota, "phone", job.Phone, len([]rune(post.Text))) {
+				services.SendSMS(job.Phone, "Sorry, you've reached today's reading limit. Send the link again tomorrow and we'll read it to you.")
+				return permanentError{errQuotaExceeded}
+			}
+
+			job.QuotaCharged = true
+			if err = job.update(bson.M{"$set": bson.M{"quota_charged": true}}); err != nil {
+				return err
+			}
+		}
+
+		options, err := speechOptionsForPhone(job.Phone)
+		if err != nil {
+			return err
+		}
+
+		speech, err := CreateTTS(post.Text, options)
+		if err != nil {
+			return err
+		}
+
+		if err = job.SetState(JobUploading); err != nil {
+			return err
+		}
+
+		if err = post.SetSpeech(speech); err != nil {
+			return err
+		}
+
+		if err = post.Save(); err != nil {
+			return err
+		}
+	}
+
+	if job.PostId != post.Id {
+		if err = job.setPost(post); err != nil {
+			return err
+		}
+	}
+
+	request, err := job.request(post)
+	if err != nil {
+		return err
+	}
+
+	if err = job.SetState(JobNotifying); err != nil {
+		return err
+	}
+
+	// Batched jobs are summarized in a single SMS once all are finished
+	if job.BatchId.Valid() {
+		if err = job.SetState(JobDone); err != nil {
+			return err
+		}
+
+		return finishBatch(job.BatchId)
+	}
+
+	if err = request.Notify(); err != nil {
+		return err
+	}
+
+	return job.SetState(JobDone)
+}
+
+// findPost returns the post saved by an earlier attempt, or else one made
+// for the same URL by another job.
+func (job *Job) findPost() (*Post, error) {
+	if job.PostId.Valid() {
+		return GetPostById(job.PostId)
+	}
+
+	return GetPostByURL(job.URL)
+}
+
+func (job *Job) setPost(post *Post) error {
+	job.PostId = post.Id
+	return job.update(bson.M{"$set": bson.M{"post_id": post.Id}})
+}
+
+// request returns the Request created by an earlier attempt, or creates it.
+func (job *Job) request(post *Post) (*Request, error) {
+	if job.RequestId.Valid() {
+		request, err := GetRequestById(job.RequestId.Hex())
+		if err == nil {
+			return request, nil
+		}
+	}
+
+	request, err := CreateRequest(post, job.Phone, job.APIKeyId)
+	if err != nil {
+		return nil, err
+	}
+
+	job.RequestId = request.Id
+	err = job.update(bson.M{"$set": bson.M{"request_id": request.Id}})
+
+	return request, err
+}
+
+func jobMaxAttempts() int {
+	if n, err := strconv.Atoi(os.Getenv("JOB_MAX_ATTEMPTS")); err == nil && n > 0 {
+		return n
+	}
+
+	return defaultJobMaxAttempts
+}
@@ -0,0 +1,364 @@
+package main
+
+import (
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/jpadilla/rttm/ratelimit"
+	"github.com/jpadilla/rttm/services"
+	"github.com/jpadilla/rttm/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestJobBackoff(t *testing.T) {
+	expected := []time.Duration{30 * time.Second, 30 * time.Second, time.Minute, 2 * time.Minute, 4 * time.Minute}
+
+	for attempts, backoff := range expected {
+		job := &Job{Attempts: attempts}
+
+		if job.Backoff() != backoff {
+			t.Errorf("Attempt %d: expected %v, got %v", attempts, backoff, job.Backoff())
+		}
+	}
+}
+
+type failingSynthesizer struct {
+	fakeSynthesizer
+}
+
+func (s *failingSynthesizer) Synthesize(text string, options services.SpeechOptions) ([]byte, error) {
+	return nil, errors.New("Synthesis failed")
+}
+
+func TestRunArticleChargesQuotaOnce(t *testing.T) {
+	defer withTestDB(t)()
+
+	Extractor = fakeExtractor{&services.Article{Title: "A", Text: "Hello"}}
+	Synthesizer = &failingSynthesizer{}
+	PhoneQuota = &ratelimit.Quota{Counters: JobCollection.Database.C("quotas"), Limit: 8}
+	defer func() { Extractor, Synthesizer, PhoneQuota = nil, nil, nil }()
+
+	job, err := EnqueueJob("http://example.com/a", "+15555555555")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// Both attempts fail to synthesize; only the first counts the text
+	for attempt := 1; attempt <= 2; attempt++ {
+		if err := job.runArticle(); err == nil {
+			t.Fatalf("Attempt %d: expected the synthesis error, got %v", attempt, err)
+		}
+	}
+
+	stored := &Job{}
+	if err := JobCollection.FindId(job.Id).One(stored); err != nil {
+		t.Fatal(err)
+	}
+
+	if !stored.QuotaCharged {
+		t.Error("Expected the charge to be recorded on the job")
+	}
+
+	if ok, _ := PhoneQuota.Consume("phone:+15555555555", 3); !ok {
+		t.Error("Expected 3 characters left in the quota")
+	}
+}
+
+func TestClaimJob(t *testing.T) {
+	defer withTestDB(t)()
+
+	job, err := EnqueueJob("http://example.com/a", "+15555550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err := ClaimJob("worker-1", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed.Id != job.Id || claimed.State != JobRunning || claimed.Attempts != 1 || claimed.LeaseOwner != "worker-1" {
+		t.Errorf("Unexpected claimed job %+v", claimed)
+	}
+
+	// The lease keeps other workers off the job
+	if _, err = ClaimJob("worker-2", time.Minute); err != mgo.ErrNotFound {
+		t.Errorf("Expected no job while the lease holds, got %v", err)
+	}
+
+	// Until the worker dies and the lease runs out
+	if err = JobCollection.UpdateId(job.Id, bson.M{"$set": bson.M{"leaseexpires": time.Now().Add(-time.Second)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	claimed, err = ClaimJob("worker-2", time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if claimed.Id != job.Id || claimed.Attempts != 2 || claimed.LeaseOwner != "worker-2" {
+		t.Errorf("Expected worker-2 to take over the job, got %+v", claimed)
+	}
+
+	// The first worker can no longer touch the job
+	stale := &Job{Id: job.Id, LeaseOwner: "worker-1", Attempts: 1, MaxAttempts: 5}
+
+	if err = stale.SetState(JobSynthesizing); err != errLeaseLost {
+		t.Errorf("Expected the stale worker to lose its lease, got %v", err)
+	}
+
+	if err = stale.Fail(errors.New("Timeout")); err != errLeaseLost {
+		t.Errorf("Expected the stale worker's failure to be ignored, got %v", err)
+	}
+
+	if stored, _ := GetJobById(job.Id.Hex()); stored == nil || stored.State != JobRunning {
+		t.Errorf("Expected worker-2's job to be untouched, got %+v", stored)
+	}
+
+	// Finished jobs and jobs waiting to be retried are left alone
+	if err = claimed.SetState(JobDone); err != nil {
+		t.Fatal(err)
+	}
+
+	later, err := EnqueueJob("http://example.com/b", "+15555550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = JobCollection.UpdateId(later.Id, bson.M{"$set": bson.M{"state": JobFailed, "runafter": time.Now().Add(time.Minute)}}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = ClaimJob("worker-3", time.Minute); err != mgo.ErrNotFound {
+		t.Errorf("Expected no job to be claimed, got %v", err)
+	}
+}
+
+func TestJobHoldLease(t *testing.T) {
+	defer withTestDB(t)()
+
+	if _, err := EnqueueJob("http://example.com/a", "+15555550100"); err != nil {
+		t.Fatal(err)
+	}
+
+	lease := 150 * time.Millisecond
+
+	job, err := ClaimJob("worker-1", lease)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A step outlasting the lease keeps the job while the heartbeat runs
+	release := job.holdLease(lease)
+	time.Sleep(3 * lease)
+
+	if _, err = ClaimJob("worker-2", lease); err != mgo.ErrNotFound {
+		t.Errorf("Expected the renewed lease to hold, got %v", err)
+	}
+
+	release()
+	time.Sleep(2 * lease)
+
+	if _, err = ClaimJob("worker-2", lease); err != nil {
+		t.Errorf("Expected the job to be claimable once released, got %v", err)
+	}
+}
+
+func TestJobFail(t *testing.T) {
+	defer withTestDB(t)()
+
+	tests := []struct {
+		attempts int
+		err      error
+		state    string
+	}{
+		{1, errors.New("Timeout"), JobFailed},
+		{2, errors.New("Timeout"), JobFailed},
+		{3, errors.New("Timeout"), JobDead},
+		{1, permanentError{errors.New("No text")}, JobDead},
+	}
+
+	for _, test := range tests {
+		job, err := EnqueueJob("http://example.com/a", "+15555550100")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		job.Attempts = test.attempts
+		job.MaxAttempts = 3
+
+		if err = job.Fail(test.err); err != nil {
+			t.Fatal(err)
+		}
+
+		stored := &Job{}
+		if err = JobCollection.FindId(job.Id).One(stored); err != nil {
+			t.Fatal(err)
+		}
+
+		if stored.State != test.state || stored.Error != test.err.Error() {
+			t.Errorf("Attempt %d, %v: expected %s, got %s %q", test.attempts, test.err, test.state, stored.State, stored.Error)
+		}
+
+		// Retries wait for the backoff
+		if test.state == JobFailed && stored.RunAfter.Before(time.Now().Add(job.Backoff()-time.Second)) {
+			t.Errorf("Attempt %d: expected a retry after %v, got %v", test.attempts, job.Backoff(), stored.RunAfter)
+		}
+	}
+}
+
+// breakCollection makes every operation on *c panic, as a dropped
+// connection would, until the returned func restores it.
+func breakCollection(c **mgo.Collection) func() {
+	saved := *c
+	session := saved.Database.Session.Copy()
+	session.Close()
+	*c = saved.With(session)
+
+	return func() { *c = saved }
+}
+
+func TestRunArticleRetryAfterSave(t *testing.T) {
+	defer withTestDB(t)()
+
+	store, err := storage.NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	synth := &fakeSynthesizer{}
+	Store, Synthesizer = store, synth
+	Extractor = fakeExtractor{&services.Article{URL: "http://example.com/canonical", Title: "A", Text: "Hello"}}
+	defer func() { Store, Synthesizer, Extractor = nil, nil, nil }()
+
+	phone := "+15555550100"
+	if err = SetSubscriber(phone, bson.M{"optedout": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	job, err := EnqueueJob("http://example.com/a?utm_source=sms", phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// The first attempt fails recording the request, after the post is saved
+	restore := breakCollection(&RequestCollection)
+	err = job.Run()
+	restore()
+
+	if err == nil {
+		t.Fatal("Expected the first attempt to fail")
+	}
+
+	if err = job.Run(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := PostCollection.Count(); n != 1 {
+		t.Errorf("Expected a single post, got %d", n)
+	}
+
+	if len(synth.calls) != 1 {
+		t.Errorf("Expected the text to be synthesized once, got %d calls", len(synth.calls))
+	}
+
+	if post, err := GetPostById(job.PostId); err != nil || post.OriginalURL != job.URL {
+		t.Errorf("Expected the job to point at its post, got %v %v", post, err)
+	}
+
+	// Another job for the same link reuses the post by its original URL
+	if post, err := GetPostByURL(job.URL); err != nil || post.Id != job.PostId {
+		t.Errorf("Expected the post for %s, got %v %v", job.URL, post, err)
+	}
+}
+
+// flakyStore fails to store audio the first failures times. Metadata is
+// written before the audio, so a failed upload leaves it behind.
+type flakyStore struct {
+	storage.BlobStore
+	failures int
+}
+
+func (s *flakyStore) Put(key string, data []byte, contentType string) error {
+	if s.failures > 0 && !strings.HasSuffix(key, ".json") {
+		s.failures--
+		return errors.New("Upload failed")
+	}
+
+	return s.BlobStore.Put(key, data, contentType)
+}
+
+func TestJobRetryReusesUpload(t *testing.T) {
+	defer withTestDB(t)()
+
+	os.Setenv("CALLBACK_SECRET", "secret")
+	defer os.Setenv("CALLBACK_SECRET", "")
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	defer server.Close()
+	defer useTestServer(server)()
+
+	Synthesizer = &fakeSynthesizer{}
+	Extractor = fakeExtractor{&services.Article{URL: "http://example.com/a", Title: "A", Text: "Hello"}}
+	defer func() { Store, Synthesizer, Extractor = nil, nil, nil }()
+
+	phone := "+15555550100"
+	if err := SetSubscriber(phone, bson.M{"optedout": true}); err != nil {
+		t.Fatal(err)
+	}
+
+	article, err := EnqueueJob("http://example.com/a", phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	text, err := EnqueueTextJob("Hello", server.URL, &APIKey{Id: bson.NewObjectId()})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for _, job := range []*Job{article, text} {
+		store, err := storage.NewMemoryStore()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer store.Close()
+
+		Store = &flakyStore{BlobStore: store, failures: 1}
+
+		if err = job.Run(); err == nil {
+			t.Fatal("Expected the first upload to fail")
+		}
+
+		if err = job.Run(); err != nil {
+			t.Fatal(err)
+		}
+
+		// The retry uploads under the same post, so nothing is orphaned
+		list, err := store.Bucket.List("posts/", "", "", 100)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if len(list.Contents) != 2 {
+			t.Errorf("Expected the audio and its metadata, got %d objects", len(list.Contents))
+		}
+
+		for _, object := range list.Contents {
+			if !strings.HasPrefix(object.Key, "posts/"+job.PostId.Hex()+"/") {
+				t.Errorf("Unexpected object %s", object.Key)
+			}
+		}
+	}
+
+	if n, _ := PostCollection.Count(); n != 2 {
+		t.Errorf("Expected a post per job, got %d", n)
+	}
+}
@@ -4,15 +4,27 @@ import (
 	"log"
 	"net/http"
 	"os"
+	"time"
 
 	"github.com/gorilla/mux"
 	_ "github.com/joho/godotenv/autoload"
+	"github.com/jpadilla/rttm/services"
+	"github.com/jpadilla/rttm/storage"
 	"gopkg.in/mgo.v2"
 )
 
 var (
-	PostCollection    *mgo.Collection
-	RequestCollection *mgo.Collection
+	PostCollection       *mgo.Collection
+	RequestCollection    *mgo.Collection
+	JobCollection        *mgo.Collection
+	APIKeyCollection     *mgo.Collection
+	SubscriberCollection *mgo.Collection
+	BatchCollection      *mgo.Collection
+	UserCollection       *mgo.Collection
+	LoginCodeCollection  *mgo.Collection
+	Synthesizer          services.Synthesizer
+	Extractor            services.Extractor
+	Store                storage.BlobStore
 )
 
 func main() {
@@ -28,19 +40,116 @@ func main() {
 
 	PostCollection = session.DB("").C("posts")
 	RequestCollection = session.DB("").C("requests")
+	JobCollection = session.DB("").C("jobs")
+	APIKeyCollection = session.DB("").C("apikeys")
+	SubscriberCollection = session.DB("").C("subscribers")
+	BatchCollection = session.DB("").C("batches")
+	UserCollection = session.DB("").C("users")
+	LoginCodeCollection = session.DB("").C("logincodes")
+
+	if err = JobCollection.EnsureIndexKey("state", "runafter"); err != nil {
+		panic(err)
+	}
+
+	if err = JobCollection.EnsureIndexKey("batch_id"); err != nil {
+		panic(err)
+	}
+
+	if err = APIKeyCollection.EnsureIndex(mgo.Index{Key: []string{"hash"}, Unique: true}); err != nil {
+		panic(err)
+	}
+
+	if err = UserCollection.EnsureIndex(mgo.Index{Key: []string{"phones.number"}, Unique: true, Sparse: true}); err != nil {
+		panic(err)
+	}
+
+	if err = UserCollection.EnsureIndex(mgo.Index{Key: []string{"feedtoken"}, Unique: true, Sparse: true}); err != nil {
+		panic(err)
+	}
+
+	if err = RequestCollection.EnsureIndexKey("user_id", "-createdat"); err != nil {
+		panic(err)
+	}
+
+	if err = RequestCollection.EnsureIndexKey("phone", "-createdat"); err != nil {
+		panic(err)
+	}
+
+	if err = LoginCodeCollection.EnsureIndexKey("phone"); err != nil {
+		panic(err)
+	}
+
+	if err = LoginCodeCollection.EnsureIndex(mgo.Index{Key: []string{"expiresat"}, ExpireAfter: time.Second}); err != nil {
+		panic(err)
+	}
+
+	if err = ConfigureRateLimits(session.DB("")); err != nil {
+		panic(err)
+	}
+
+	// Configure text-to-speech engine
+	Synthesizer, err = services.NewSynthesizer(os.Getenv("TTS_ENGINE"))
+	if err != nil {
+		panic(err)
+	}
+
+	// Configure article extraction
+	Extractor, err = services.NewExtractor(os.Getenv("EXTRACTORS"))
+	if err != nil {
+		panic(err)
+	}
+
+	// Configure audio storage
+	if backend := os.Getenv("STORAGE_BACKEND"); backend == "gridfs" {
+		gridfs := storage.NewGridFSStore(session.DB(""), siteURL()+"/audio")
+		if err = gridfs.EnsureIndexes(); err != nil {
+			panic(err)
+		}
+		Store = gridfs
+	} else {
+		Store, err = storage.New(backend, siteURL()+"/media")
+		if err != nil {
+			panic(err)
+		}
+	}
+
+	// Run background worker or admin command instead of the web server
+	if len(os.Args) > 1 {
+		if err = RunCommand(os.Args[1:]); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
 
 	// Configure router
 	router := mux.NewRouter()
-	router.HandleFunc("/api/rttm", APIHandler).Methods("POST")
-	router.HandleFunc("/feed/{phone}", FeedHandler).Methods("GET")
+	router.HandleFunc("/api/rttm", RateLimitIP(RequireAPIKey(ScopeTTS, RateLimitAPIKey(APIHandler)))).Methods("POST")
+	router.HandleFunc("/api/jobs/{id}", RequireAPIKey(ScopeTTS, APIJobHandler)).Methods("GET")
+	router.HandleFunc("/jobs/{id}", JobStatusHandler).Methods("GET")
+	router.HandleFunc("/feed/{token}", FeedHandler).Methods("GET")
+	router.HandleFunc("/listen/{id}", ListenHandler).Methods("GET", "HEAD")
 	router.HandleFunc("/submit", SubmitHandler).Methods("GET", "POST")
-	router.HandleFunc("/twilio/callback", TwilioCallbackHandler).Methods("POST")
+	router.HandleFunc("/signin", SignInHandler).Methods("GET", "POST")
+	router.HandleFunc("/signout", RequireCSRF(SignOutHandler)).Methods("POST")
+	router.HandleFunc("/account", RequireUser(AccountHandler)).Methods("GET", "POST")
+	router.HandleFunc("/account/phones", RequireUser(AccountPhoneHandler)).Methods("POST")
+	router.HandleFunc("/account/feed", RequireUser(AccountFeedHandler)).Methods("POST")
+	router.HandleFunc("/twilio/callback", RequireTwilioSignature(TwilioCallbackHandler)).Methods("POST")
+	if local, ok := Store.(*storage.LocalStore); ok {
+		router.PathPrefix("/media/").Handler(http.StripPrefix("/media", local.Handler()))
+	}
+	if gridfs, ok := Store.(*storage.GridFSStore); ok {
+		router.PathPrefix("/audio/").Handler(http.StripPrefix("/audio", gridfs.Handler())).Methods("GET", "HEAD")
+	}
+
 	router.HandleFunc("/favicon.ico", IconHandler).Methods("GET")
 	router.HandleFunc("/{id}", ViewHandler).Methods("GET")
 
-	http.Handle("/", router)
+	serveMetrics()
 
-	if err = http.ListenAndServe(getPort(), nil); err != nil {
+	// Serve the router itself rather than http.DefaultServeMux, which expvar
+	// registers /debug/vars on
+	if err = http.ListenAndServe(getPort(), router); err != nil {
 		log.Fatal("ListenAndServe: ", err)
 		return
 	}
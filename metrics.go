@@ -0,0 +1,29 @@
+package main
+
+import (
+	"expvar"
+	"log"
+	"net/http"
+	"os"
+)
+
+// Counters are published as JSON on METRICS_ADDR.
+var (
+	twilioSignatureFailures = expvar.NewInt("twilio_signature_failures")
+)
+
+// serveMetrics serves the counters on METRICS_ADDR, such as
+// 127.0.0.1:9090, which should not be reachable from the internet. Nothing
+// is served when it is empty.
+func serveMetrics() {
+	addr := os.Getenv("METRICS_ADDR")
+	if addr == "" {
+		return
+	}
+
+	go func() {
+		if err := http.ListenAndServe(addr, expvar.Handler()); err != nil {
+			log.Println("Error serving metrics", err)
+		}
+	}()
+}
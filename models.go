@@ -1,29 +1,35 @@
 package main
 
 import (
-	"encoding/json"
+	"crypto/sha256"
+	"encoding/hex"
 	"fmt"
 	"html/template"
 	"log"
-	"os"
 	"strings"
 	"time"
 
-	alchemyapi "github.com/jpadilla/alchemyapi-go"
 	"github.com/jpadilla/rttm/services"
+	"github.com/jpadilla/rttm/storage"
+	"gopkg.in/mgo.v2"
 	"gopkg.in/mgo.v2/bson"
 )
 
 type Post struct {
 	Id        bson.ObjectId `bson:"_id"`
 	AudioURL  string
+	AudioKey  string `bson:"audiokey,omitempty"`
 	Length    int
+	Duration  time.Duration
 	Text      string
+	APIKeyId  bson.ObjectId `bson:"apikey_id,omitempty"`
 	CreatedAt time.Time
 
 	OriginalURL     string    `json:"original_url"`
 	URL             string    `json:"url"`
 	Type            string    `json:"type"`
+	SourceType      string    `json:"source_type"`
+	PageCount       int       `json:"page_count,omitempty"`
 	Safe            bool      `json:"safe"`
 	SafeType        string    `json:"safe_type,omitempty"`
 	SafeMessage     string    `json:"safe_message,omitempty"`
@@ -33,6 +39,7 @@ type Post struct {
 	ProviderDisplay string    `json:"provider_display"`
 	FaviconURL      string    `json:"favicon_url"`
 	Title           string    `json:"title"`
+	Language        string    `json:"language,omitempty"`
 	Description     string    `json:"description"`
 	Authors         []Author  `json:"authors"`
 	Media           Media     `json:"media"`
@@ -88,6 +95,9 @@ type Request struct {
 	PostId    bson.ObjectId `bson:"post_id"`
 	Post      *Post         `bson:"-"`
 	Phone     string
+	UserId    bson.ObjectId `bson:"user_id,omitempty"`
+	APIKeyId  bson.ObjectId `bson:"apikey_id,omitempty"`
+	Downloads DownloadStats `bson:"downloads"`
 	CreatedAt time.Time
 }
 
@@ -102,9 +112,11 @@ func GetPostById(id bson.ObjectId) (*Post, error) {
 	return post, err
 }
 
+// GetPostByURL returns the post for url, which is either the URL the article
+// was requested by or its canonical one.
 func GetPostByURL(url string) (*Post, error) {
 	post := &Post{}
-	err := PostCollection.Find(bson.M{"url": url}).One(&post)
+	err := PostCollection.Find(bson.M{"$or": []bson.M{{"url": url}, {"originalurl": url}}}).One(&post)
 
 	if err != nil {
 		return nil, err
@@ -122,36 +134,122 @@ func (p Post) GetShortDescription() string {
 	return p.Description
 }
 
+// FindRequestsByPhone returns the requests made by phone, newest first.
 func FindRequestsByPhone(phone string) ([]Request, error) {
+	return findRequests(bson.M{"phone": phone}, 0, 0)
+}
+
+// FindRequestsByUser returns up to limit requests made from any of a user's
+// phones, newest first, after skipping the first skip.
+func FindRequestsByUser(userId bson.ObjectId, skip int, limit int) ([]Request, error) {
+	return findRequests(bson.M{"user_id": userId}, skip, limit)
+}
+
+// RequestStats returns how many articles a user has requested and when the
+// newest request was made, which is enough to tell whether their feed
+// changed.
+func RequestStats(userId bson.ObjectId) (int, time.Time, error) {
+	var stats struct {
+		Count  int
+		Newest time.Time
+	}
+
+	pipeline := append(latestRequestsPipeline(bson.M{"user_id": userId}), bson.M{
+		"$group": bson.M{
+			"_id":    nil,
+			"count":  bson.M{"$sum": 1},
+			"newest": bson.M{"$max": "$createdat"},
+		},
+	})
+
+	err := RequestCollection.Pipe(pipeline).One(&stats)
+	if err == mgo.ErrNotFound {
+		return 0, time.Time{}, nil
+	}
+
+	return stats.Count, stats.Newest, err
+}
+
+// latestRequestsPipeline aggregates the requests matching query into the
+// latest one for each post, newest first. Requesting an article again
+// thereby moves it back to the top of the feed.
+func latestRequestsPipeline(query bson.M) []bson.M {
+	return []bson.M{
+		{"$match": query},
+		{"$sort": bson.D{{Name: "createdat", Value: -1}, {Name: "_id", Value: -1}}},
+		{"$group": bson.M{
+			"_id":        "$post_id",
+			"request_id": bson.M{"$first": "$_id"},
+			"phone":      bson.M{"$first": "$phone"},
+			"user_id":    bson.M{"$first": "$user_id"},
+			"apikey_id":  bson.M{"$first": "$apikey_id"},
+			"createdat":  bson.M{"$first": "$createdat"},
+		}},
+		{"$sort": bson.D{{Name: "createdat", Value: -1}, {Name: "request_id", Value: -1}}},
+		{"$project": bson.M{
+			"_id":       "$request_id",
+			"post_id":   "$_id",
+			"phone":     1,
+			"user_id":   1,
+			"apikey_id": 1,
+			"createdat": 1,
+		}},
+	}
+}
+
+func findRequests(query bson.M, skip int, limit int) ([]Request, error) {
 	var requests []Request
 	var results []Request
 
-	err := RequestCollection.Find(bson.M{"phone": phone}).All(&requests)
+	pipeline := append(latestRequestsPipeline(query), bson.M{"$skip": skip})
+	if limit > 0 {
+		pipeline = append(pipeline, bson.M{"$limit": limit})
+	}
+
+	err := RequestCollection.Pipe(pipeline).All(&requests)
 
 	if err != nil {
 		return nil, err
 	}
 
-	postIds := map[bson.ObjectId]bson.ObjectId{}
+	if err = loadPosts(requests); err != nil {
+		return nil, err
+	}
 
 	for i := range requests {
-		postId := requests[i].PostId
+		if requests[i].Post != nil {
+			results = append(results, requests[i])
+		}
+	}
 
-		if _, ok := postIds[postId]; !ok {
-			post, err := GetPostById(postId)
+	return results, nil
+}
 
-			if err != nil {
-				return nil, err
-			}
+// loadPosts sets the Post of every request with a single query. Requests
+// whose post no longer exists are left with a nil Post.
+func loadPosts(requests []Request) error {
+	ids := make([]bson.ObjectId, 0, len(requests))
 
-			requests[i].Post = post
+	for _, request := range requests {
+		ids = append(ids, request.PostId)
+	}
 
-			postIds[postId] = postId
-			results = append(results, requests[i])
-		}
+	var posts []Post
+	if err := PostCollection.Find(bson.M{"_id": bson.M{"$in": ids}}).All(&posts); err != nil {
+		return err
 	}
 
-	return results, nil
+	byId := make(map[bson.ObjectId]*Post, len(posts))
+
+	for i := range posts {
+		byId[posts[i].Id] = &posts[i]
+	}
+
+	for i := range requests {
+		requests[i].Post = byId[requests[i].PostId]
+	}
+
+	return nil
 }
 
 func GetRequestById(id string) (*Request, error) {
@@ -177,102 +275,193 @@ func GetRequestById(id string) (*Request, error) {
 	return request, err
 }
 
-func CreateTTS(text string) ([]byte, error) {
+func CreateTTS(text string, options services.SpeechOptions) (*services.Speech, error) {
 	log.Println("Getting playlist...")
-	playlist, err := services.TextToSpeech(text)
+	speech, err := services.TextToSpeech(Synthesizer, text, options)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
-	return playlist, nil
-}
-
-func UploadPlaylist(playlist []byte) string {
-	path := fmt.Sprintf("%d.mp3", int32(time.Now().Unix()))
-	return services.UploadPublicFile(path, playlist, "audio/mpeg")
+	return speech, nil
 }
 
-func CreatePost(url string) (*Post, error) {
-	alchemyClient := alchemyapi.New(os.Getenv("ALCHEMY_API_KEY"))
+// UploadPlaylist stores speech for postId and returns its key. Keys
+// are derived from the audio itself, e.g. posts/{postId}/{sha256}.mp3, so
+// uploading the same audio again is skipped.
+func UploadPlaylist(postId bson.ObjectId, speech *services.Speech) (string, error) {
+	key := audioKey(postId, speech)
 
-	log.Println("Getting text...")
-	textResponse, err := alchemyClient.GetText(url, alchemyapi.GetTextOptions{})
+	exists, err := Store.Exists(key)
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return "", err
 	}
 
-	log.Println("Extracting...")
-	extractResponse, err := services.Extract(url)
-	if err != nil {
-		log.Println(extractResponse.ErrorMessage)
-		log.Println(extractResponse.ErrorCode)
-		return nil, err
+	if exists {
+		log.Println("Audio already uploaded to", key)
+		return key, nil
 	}
 
-	playlist, err := CreateTTS(textResponse.Text)
+	voice := speech.Options.Voice
+	if voice == "" {
+		voice = "default"
+	}
+
+	err = storage.PutMetadata(Store, key, storage.Metadata{
+		"post_id":      postId.Hex(),
+		"voice":        voice,
+		"duration":     speech.Duration.String(),
+		"content_type": speech.Format.ContentType,
+	})
+
 	if err != nil {
 		log.Println(err)
-		return nil, err
+		return "", err
+	}
+
+	// The audio goes last so that its presence means the upload finished
+	if err = Store.Put(key, speech.Audio, speech.Format.ContentType); err != nil {
+		log.Println(err)
+		return "", err
 	}
 
-	mp3Url := UploadPlaylist(playlist)
-	log.Println("Uploaded public file to ", mp3Url)
+	return key, nil
+}
 
-	log.Println("Creating Post...")
-	b, err := json.Marshal(extractResponse)
+func audioKey(postId bson.ObjectId, speech *services.Speech) string {
+	sum := sha256.Sum256(speech.Audio)
+	return fmt.Sprintf("posts/%s/%s.%s", postId.Hex(), hex.EncodeToString(sum[:]), speech.Format.Extension)
+}
+
+// ExtractPost fetches the article at url with the configured Extractor and
+// returns an unsaved Post with its text and metadata.
+func ExtractPost(url string) (*Post, error) {
+	log.Println("Extracting...")
+	article, err := Extractor.Extract(url)
 	if err != nil {
 		log.Println(err)
 		return nil, err
 	}
 
 	post := &Post{
-		Id:        bson.NewObjectId(),
-		AudioURL:  mp3Url,
-		Length:    len(playlist),
-		Text:      strings.TrimSpace(textResponse.Text),
-		CreatedAt: time.Now(),
+		Id:           bson.NewObjectId(),
+		Text:         strings.TrimSpace(article.Text),
+		OriginalURL:  url,
+		URL:          article.URL,
+		Type:         article.SourceType,
+		SourceType:   article.SourceType,
+		PageCount:    article.PageCount,
+		Title:        article.Title,
+		Description:  article.Description,
+		ProviderName: article.SiteName,
+		FaviconURL:   article.FaviconURL,
+		Language:     article.Language,
+		CreatedAt:    time.Now(),
 	}
 
-	if err = json.Unmarshal(b, post); err != nil {
-		log.Println(err)
-		return nil, err
+	if post.SourceType == "" {
+		post.Type, post.SourceType = "html", "html"
 	}
 
-	if err = PostCollection.Insert(post); err != nil {
-		log.Println(err)
-		return nil, err
+	for _, name := range article.Authors {
+		post.Authors = append(post.Authors, Author{Name: name})
+	}
+
+	if article.ImageURL != "" {
+		post.Images = []Image{{URL: article.ImageURL}}
+	}
+
+	if !article.Published.IsZero() {
+		post.Published = article.Published.UnixNano() / int64(time.Millisecond)
 	}
 
 	return post, nil
 }
 
-func CreateRequest(url string, phone string) {
-	post, err := GetPostByURL(url)
+// SetSpeech uploads speech and points the post at the resulting file.
+func (p *Post) SetSpeech(speech *services.Speech) error {
+	key, err := UploadPlaylist(p.Id, speech)
+	if err != nil {
+		return err
+	}
+
+	p.AudioKey = key
+	p.AudioURL = Store.PublicURL(key)
+	p.Length = len(speech.Audio)
+	p.Duration = speech.Duration
+
+	log.Println("Uploaded public file to ", p.AudioURL)
+	return nil
+}
+
+func (p *Post) Save() error {
+	log.Println("Creating Post...")
+	return PostCollection.Insert(p)
+}
 
+func CreatePost(url string) (*Post, error) {
+	post, err := ExtractPost(url)
 	if err != nil {
-		post, err = CreatePost(url)
+		return nil, err
+	}
 
-		if err != nil {
-			return
-		}
+	speech, err := CreateTTS(post.Text, services.SpeechOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	if err = post.SetSpeech(speech); err != nil {
+		return nil, err
 	}
 
+	if err = post.Save(); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// CreateRequest records that phone asked for post. apiKeyId is empty unless
+// the request came through the API.
+func CreateRequest(post *Post, phone string, apiKeyId bson.ObjectId) (*Request, error) {
 	log.Println("Creating Request...")
 	request := &Request{
 		Id:        bson.NewObjectId(),
 		PostId:    post.Id,
+		Post:      post,
 		Phone:     phone,
+		APIKeyId:  apiKeyId,
 		CreatedAt: time.Now(),
 	}
 
-	if err = RequestCollection.Insert(request); err != nil {
+	if user, err := GetUserByPhone(phone); err == nil {
+		request.UserId = user.Id
+	}
+
+	if err := RequestCollection.Insert(request); err != nil {
 		log.Println(err)
-		return
+		return nil, err
+	}
+
+	return request, nil
+}
+
+// Notify sends the requester an SMS with a link to the audio, unless they
+// replied STOP.
+func (r *Request) Notify() error {
+	subscriber, err := GetSubscriber(r.Phone)
+	if err != nil {
+		return err
+	}
+
+	if subscriber.OptedOut {
+		log.Println("Not notifying unsubscribed", r.Phone)
+		return nil
 	}
 
 	log.Println("Sending SMS...")
-	message := post.Title + "\n" + post.AudioURL
-	go services.SendSMS(phone, message)
+	message := r.Post.Title + "\n" + r.ListenURL()
+	return services.SendSMS(r.Phone, message)
 }
@@ -0,0 +1,241 @@
+package main
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"github.com/jpadilla/rttm/services"
+	"github.com/jpadilla/rttm/storage"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+type fakeSynthesizer struct {
+	calls []string
+}
+
+func (s *fakeSynthesizer) Synthesize(text string, options services.SpeechOptions) ([]byte, error) {
+	s.calls = append(s.calls, text)
+
+	// A single silent MPEG-2 Layer III frame
+	frame := make([]byte, 104)
+	copy(frame, []byte{0xff, 0xf3, 0x40, 0xc0})
+
+	return frame, nil
+}
+
+func (s *fakeSynthesizer) Format() services.AudioFormat {
+	return services.MP3
+}
+
+func (s *fakeSynthesizer) Limits() services.Limits {
+	return services.Limits{MaxChunkSize: 20, Concurrency: 1}
+}
+
+func (s *fakeSynthesizer) Voices() []string {
+	return []string{"Salli", "Joey"}
+}
+
+type fakeExtractor struct {
+	article *services.Article
+}
+
+func (e fakeExtractor) Extract(url string) (*services.Article, error) {
+	return e.article, nil
+}
+
+func TestExtractPost(t *testing.T) {
+	defer func() { Extractor = nil }()
+
+	tests := []struct {
+		article    services.Article
+		sourceType string
+		pages      int
+	}{
+		{services.Article{Text: "A page", SourceType: "html"}, "html", 0},
+		{services.Article{Text: "A paper", SourceType: "pdf", PageCount: 12}, "pdf", 12},
+		{services.Article{Text: "Unknown"}, "html", 0},
+	}
+
+	for _, test := range tests {
+		article := test.article
+		Extractor = fakeExtractor{&article}
+
+		post, err := ExtractPost("http://example.com/a")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if post.Type != test.sourceType || post.SourceType != test.sourceType || post.PageCount != test.pages {
+			t.Errorf("%s: expected type %s and %d pages, got %s %s %d", article.Text, test.sourceType, test.pages, post.Type, post.SourceType, post.PageCount)
+		}
+	}
+}
+
+func TestCreateTTS(t *testing.T) {
+	synth := &fakeSynthesizer{}
+	Synthesizer = synth
+	defer func() { Synthesizer = nil }()
+
+	speech, err := CreateTTS("Hello World", services.SpeechOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if speech.Format != services.MP3 || speech.Duration <= 0 {
+		t.Errorf("Unexpected speech %v %v", speech.Format, speech.Duration)
+	}
+
+	if len(synth.calls) != 1 || synth.calls[0] != "Hello World" {
+		t.Errorf("Unexpected synthesizer calls %q", synth.calls)
+	}
+}
+
+func TestSetSpeech(t *testing.T) {
+	store, err := storage.NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	Store = store
+	defer func() { Store = nil }()
+
+	speech := &services.Speech{
+		Audio:    []byte("audio"),
+		Duration: time.Second,
+		Format:   services.MP3,
+		Options:  services.SpeechOptions{Voice: "Joey"},
+	}
+	post := &Post{Id: bson.NewObjectId()}
+
+	if err = post.SetSpeech(speech); err != nil {
+		t.Fatal(err)
+	}
+
+	// sha256("audio")
+	key := "posts/" + post.Id.Hex() + "/6ed8919ce20490a5e3ad8630a4fab69475297abd07db73918dd5f36fcfaeb11b.mp3"
+
+	if post.Length != 5 || post.Duration != time.Second || post.AudioURL != store.PublicURL(key) {
+		t.Errorf("Unexpected post %+v", post)
+	}
+
+	metadata, err := storage.GetMetadata(store, key)
+	if err != nil || metadata["post_id"] != post.Id.Hex() || metadata["voice"] != "Joey" || metadata["duration"] != "1s" {
+		t.Errorf("Unexpected metadata %v %v", metadata, err)
+	}
+
+	// Uploading the same audio again is a no-op with the same URL
+	audioURL := post.AudioURL
+	if err = post.SetSpeech(speech); err != nil || post.AudioURL != audioURL {
+		t.Errorf("Expected the same URL, got %s %v", post.AudioURL, err)
+	}
+
+	store.Close()
+
+	if err = post.SetSpeech(speech); err == nil {
+		t.Error("Expected upload errors to be returned")
+	}
+}
+
+// withTestDB points the collections at a scratch database on the Mongo
+// server at MONGO_TEST_URL, e.g. mongodb://localhost/rttm_test, and drops it
+// afterwards. Tests using it are skipped when the variable is unset.
+func withTestDB(t *testing.T) func() {
+	url := os.Getenv("MONGO_TEST_URL")
+	if url == "" {
+		t.Skip("MONGO_TEST_URL not set")
+	}
+
+	session, err := mgo.DialWithTimeout(url, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := session.DB("")
+	PostCollection = db.C("posts")
+	RequestCollection = db.C("requests")
+	JobCollection = db.C("jobs")
+	APIKeyCollection = db.C("apikeys")
+	SubscriberCollection = db.C("subscribers")
+	BatchCollection = db.C("batches")
+	UserCollection = db.C("users")
+	LoginCodeCollection = db.C("logincodes")
+
+	return func() {
+		db.DropDatabase()
+		session.Close()
+	}
+}
+
+func TestFindRequestsLatestWins(t *testing.T) {
+	defer withTestDB(t)()
+
+	userId := bson.NewObjectId()
+	posts := []bson.ObjectId{bson.NewObjectId(), bson.NewObjectId(), bson.NewObjectId()}
+	start := time.Date(2014, 8, 1, 0, 0, 0, 0, time.UTC)
+
+	for _, id := range posts {
+		if err := PostCollection.Insert(&Post{Id: id}); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	// Requests are given as post index and hours after start
+	type request struct{ post, hour int }
+
+	tests := []struct {
+		name     string
+		requests []request
+		skip     int
+		limit    int
+		expected []request
+	}{
+		{"no requests", nil, 0, 0, nil},
+		{"distinct posts newest first", []request{{0, 1}, {1, 2}, {2, 3}}, 0, 0, []request{{2, 3}, {1, 2}, {0, 1}}},
+		{"re-request moves to top", []request{{0, 1}, {1, 2}, {0, 3}}, 0, 0, []request{{0, 3}, {1, 2}}},
+		{"insertion order does not matter", []request{{0, 3}, {1, 2}, {0, 1}}, 0, 0, []request{{0, 3}, {1, 2}}},
+		{"pages count posts, not requests", []request{{0, 1}, {0, 2}, {1, 3}, {2, 4}, {2, 5}}, 1, 1, []request{{1, 3}}},
+		{"limit", []request{{0, 1}, {1, 2}, {2, 3}, {1, 4}}, 0, 2, []request{{1, 4}, {2, 3}}},
+	}
+
+	for _, test := range tests {
+		RequestCollection.RemoveAll(nil)
+
+		for _, r := range test.requests {
+			err := RequestCollection.Insert(&Request{
+				Id:        bson.NewObjectId(),
+				PostId:    posts[r.post],
+				UserId:    userId,
+				CreatedAt: start.Add(time.Duration(r.hour) * time.Hour),
+			})
+			if err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		requests, err := FindRequestsByUser(userId, test.skip, test.limit)
+		if err != nil {
+			t.Fatalf("%s: %v", test.name, err)
+		}
+
+		if count, _, err := RequestStats(userId); err != nil || (test.limit == 0 && count != len(test.expected)) {
+			t.Errorf("%s: expected %d posts, got %d %v", test.name, len(test.expected), count, err)
+		}
+
+		if len(requests) != len(test.expected) {
+			t.Errorf("%s: expected %d requests, got %d", test.name, len(test.expected), len(requests))
+			continue
+		}
+
+		for i, expected := range test.expected {
+			actual := requests[i]
+
+			if actual.PostId != posts[expected.post] || !actual.CreatedAt.Equal(start.Add(time.Duration(expected.hour)*time.Hour)) || actual.Post == nil || actual.UserId != userId {
+				t.Errorf("%s: request %d is post %s at %s", test.name, i, actual.PostId.Hex(), actual.CreatedAt)
+			}
+		}
+	}
+}
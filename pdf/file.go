@@ -0,0 +1,455 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/flate"
+	"compress/zlib"
+	"encoding/ascii85"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"regexp"
+	"strconv"
+)
+
+var (
+	// ErrNotPDF is returned for data without a PDF header.
+	ErrNotPDF = errors.New("pdf: not a PDF file")
+
+	// ErrEncrypted is returned for password protected or otherwise
+	// encrypted files, which are not supported.
+	ErrEncrypted = errors.New("pdf: encrypted files are not supported")
+
+	// ErrTooLarge is returned for files whose streams decompress to more
+	// than maxDecodedSize, such as compression bombs.
+	ErrTooLarge = errors.New("pdf: decompressed data is too large")
+
+	// ErrMalformed is returned for files the parser can't make sense of.
+	ErrMalformed = errors.New("pdf: malformed file")
+)
+
+// maxDecodedSize caps the total size of the streams decoded from a file.
+var maxDecodedSize = 64 << 20
+
+// file holds the objects of a PDF file. Rather than trusting the
+// cross-reference table, which is often broken, objects are found by
+// scanning the file.
+type file struct {
+	objects map[int]interface{}
+	trailer Dict
+
+	// decoded caches stream data by stream, so a content stream or font
+	// shared by many pages is only decompressed once. budget is what is
+	// left of maxDecodedSize, and err is set once it runs out.
+	decoded map[*Stream][]byte
+	budget  int
+	err     error
+}
+
+var objectHeader = regexp.MustCompile(`(\d+)\s+(\d+)\s+obj\b`)
+
+// IsPDF reports whether data starts like a PDF file.
+func IsPDF(data []byte) bool {
+	i := bytes.Index(data, []byte("%PDF-"))
+	return i >= 0 && i < 1024
+}
+
+func parseFile(data []byte) (*file, error) {
+	if !IsPDF(data) {
+		return nil, ErrNotPDF
+	}
+
+	f := &file{
+		objects: map[int]interface{}{},
+		trailer: Dict{},
+		decoded: map[*Stream][]byte{},
+		budget:  maxDecodedSize,
+	}
+	var compressed []*Stream
+
+	for pos := 0; pos < len(data); {
+		loc := objectHeader.FindSubmatchIndex(data[pos:])
+		if loc == nil {
+			break
+		}
+
+		num, _ := strconv.Atoi(string(data[pos+loc[2] : pos+loc[3]]))
+		l := &lexer{data: data, pos: pos + loc[1]}
+		pos += loc[1]
+
+		value, ok := l.object()
+		if !ok {
+			break
+		}
+
+		if dict, ok := value.(Dict); ok {
+			if stream, end, ok := readStream(l, dict); ok {
+				value = stream
+				pos = end
+
+				switch dict["Type"] {
+				case Name("ObjStm"):
+					compressed = append(compressed, stream)
+				case Name("XRef"):
+					f.mergeTrailer(dict)
+				}
+			}
+		}
+
+		// Later objects are incremental updates of earlier ones
+		f.objects[num] = value
+	}
+
+	// Trailers, of which the last one is the latest
+	for pos := 0; ; {
+		i := bytes.Index(data[pos:], []byte("trailer"))
+		if i < 0 {
+			break
+		}
+
+		l := &lexer{data: data, pos: pos + i + len("trailer")}
+		if dict, ok := l.objectFrom(mustNext(l)).(Dict); ok {
+			f.mergeTrailer(dict)
+		}
+
+		pos += i + len("trailer")
+	}
+
+	if _, ok := f.trailer["Encrypt"]; ok {
+		return nil, ErrEncrypted
+	}
+
+	for _, stream := range compressed {
+		f.readObjectStream(stream)
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	if f.trailer["Root"] == nil {
+		for num, value := range f.objects {
+			if dict, ok := value.(Dict); ok && dict["Type"] == Name("Catalog") {
+				f.trailer["Root"] = Ref{Num: num}
+			}
+		}
+	}
+
+	if f.trailer["Root"] == nil {
+		return nil, errors.New("pdf: no document catalog found")
+	}
+
+	return f, nil
+}
+
+func mustNext(l *lexer) token {
+	t, _ := l.next()
+	return t
+}
+
+func (f *file) mergeTrailer(dict Dict) {
+	for _, key := range []Name{"Root", "Info", "Encrypt"} {
+		if v, ok := dict[key]; ok {
+			f.trailer[key] = v
+		}
+	}
+}
+
+// readStream reads the data of a stream object whose dictionary l has just
+// read, returning the position after "endstream".
+func readStream(l *lexer, dict Dict) (*Stream, int, bool) {
+	saved := l.pos
+	t, ok := l.next()
+	if !ok || t.kind != 'k' || t.value != Keyword("stream") {
+		l.pos = saved
+		return nil, 0, false
+	}
+
+	start := l.pos
+	if start < len(l.data) && l.data[start] == '\r' {
+		start++
+	}
+	if start < len(l.data) && l.data[start] == '\n' {
+		start++
+	}
+
+	// Trust /Length only if it is direct, fits in the file and ends where
+	// "endstream" is. The comparison also rules out NaN and infinities.
+	if length, ok := dict["Length"].(float64); ok && length >= 0 && length <= float64(len(l.data)-start) {
+		end := start + int(length)
+		rest := bytes.TrimLeft(l.data[end:minInt(end+32, len(l.data))], "\r\n \t")
+		if bytes.HasPrefix(rest, []byte("endstream")) {
+			return &Stream{Dict: dict, Data: l.data[start:end]}, end, true
+		}
+	}
+
+	i := bytes.Index(l.data[start:], []byte("endstream"))
+	if i < 0 {
+		return &Stream{Dict: dict, Data: l.data[start:]}, len(l.data), true
+	}
+
+	end := start + i
+	data := bytes.TrimSuffix(l.data[start:end], []byte("\n"))
+	data = bytes.TrimSuffix(data, []byte("\r"))
+
+	return &Stream{Dict: dict, Data: data}, end + len("endstream"), true
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// readObjectStream adds the objects compressed into an object stream. Those
+// also written out directly are left alone.
+func (f *file) readObjectStream(stream *Stream) {
+	data, err := f.decode(stream)
+	if err != nil {
+		return
+	}
+
+	n := int(f.number(stream.Dict["N"]))
+	first := f.number(stream.Dict["First"])
+	if !(first >= 0 && first <= float64(len(data))) {
+		return
+	}
+	header := &lexer{data: data}
+
+	for i := 0; i < n; i++ {
+		num, ok1 := header.next()
+		offset, ok2 := header.next()
+		if !ok1 || !ok2 || num.kind != 'n' || offset.kind != 'n' {
+			return
+		}
+
+		// Offsets are relative to First and must land inside the data
+		off := offset.value.(float64)
+		if !(off >= 0 && off < float64(len(data))-first) {
+			continue
+		}
+
+		l := &lexer{data: data, pos: int(first + off)}
+		value, ok := l.object()
+
+		if _, exists := f.objects[int(num.value.(float64))]; ok && !exists {
+			f.objects[int(num.value.(float64))] = value
+		}
+	}
+}
+
+// resolve follows indirect references.
+func (f *file) resolve(v interface{}) interface{} {
+	for i := 0; i < 32; i++ {
+		ref, ok := v.(Ref)
+		if !ok {
+			return v
+		}
+		v = f.objects[ref.Num]
+	}
+
+	return nil
+}
+
+func (f *file) dict(v interface{}) Dict {
+	switch v := f.resolve(v).(type) {
+	case Dict:
+		return v
+	case *Stream:
+		return v.Dict
+	}
+
+	return nil
+}
+
+func (f *file) array(v interface{}) Array {
+	a, _ := f.resolve(v).(Array)
+	return a
+}
+
+func (f *file) number(v interface{}) float64 {
+	n, _ := f.resolve(v).(float64)
+	return n
+}
+
+func (f *file) name(v interface{}) Name {
+	n, _ := f.resolve(v).(Name)
+	return n
+}
+
+// decode returns the data of stream with its filters undone. Every filter's
+// output counts against the file's budget.
+func (f *file) decode(stream *Stream) ([]byte, error) {
+	if data, ok := f.decoded[stream]; ok {
+		return data, nil
+	}
+
+	if f.err != nil {
+		return nil, f.err
+	}
+
+	data := stream.Data
+
+	filters := f.array(stream.Dict["Filter"])
+	if name := f.name(stream.Dict["Filter"]); name != "" {
+		filters = Array{name}
+	}
+
+	for _, filter := range filters {
+		var err error
+
+		switch f.name(filter) {
+		case "FlateDecode", "Fl":
+			data, err = inflate(data, f.budget)
+		case "ASCIIHexDecode", "AHx":
+			// Copy, as appending to data could write into the file
+			data = (&lexer{data: append(append([]byte(nil), data...), '>')}).hexString()
+		case "ASCII85Decode", "A85":
+			data, err = decodeASCII85(data)
+		default:
+			err = fmt.Errorf("pdf: unsupported filter %v", filter)
+		}
+
+		if err == nil && len(data) > f.budget {
+			err = ErrTooLarge
+		}
+
+		if err == ErrTooLarge {
+			f.err = err
+		}
+
+		if err != nil {
+			return nil, err
+		}
+
+		f.budget -= len(data)
+	}
+
+	f.decoded[stream] = data
+
+	return data, nil
+}
+
+// inflate decompresses zlib data, keeping what it can of truncated or
+// corrupt streams. It fails with ErrTooLarge rather than return more than
+// limit bytes.
+func inflate(data []byte, limit int) ([]byte, error) {
+	r, err := zlib.NewReader(bytes.NewReader(data))
+	if err != nil {
+		// Some writers leave out the zlib header
+		out, rawErr := readLimited(flate.NewReader(bytes.NewReader(data)), limit)
+		if rawErr == ErrTooLarge || len(out) > 0 {
+			return out, rawErr
+		}
+		if rawErr != nil {
+			return nil, err
+		}
+		return out, nil
+	}
+	defer r.Close()
+
+	out, err := readLimited(r, limit)
+	if err != ErrTooLarge && len(out) > 0 {
+		return out, nil
+	}
+
+	return out, err
+}
+
+func readLimited(r io.Reader, limit int) ([]byte, error) {
+	out, err := ioutil.ReadAll(io.LimitReader(r, int64(limit)+1))
+	if len(out) > limit {
+		return nil, ErrTooLarge
+	}
+
+	return out, err
+}
+
+func decodeASCII85(data []byte) ([]byte, error) {
+	data = bytes.TrimPrefix(bytes.TrimSpace(data), []byte("<~"))
+	if i := bytes.Index(data, []byte("~>")); i >= 0 {
+		data = data[:i]
+	}
+
+	out := make([]byte, len(data))
+	n, _, err := ascii85.Decode(out, data, true)
+
+	return out[:n], err
+}
+
+// pages returns the page dictionaries in order, with inherited resources
+// filled in.
+func (f *file) pages() []Dict {
+	var pages []Dict
+	seen := map[interface{}]bool{}
+
+	var walk func(node interface{}, resources interface{})
+	walk = func(node interface{}, resources interface{}) {
+		if ref, ok := node.(Ref); ok {
+			if seen[ref] {
+				return
+			}
+			seen[ref] = true
+		}
+
+		dict := f.dict(node)
+		if dict == nil {
+			return
+		}
+
+		if r, ok := dict["Resources"]; ok {
+			resources = r
+		}
+
+		if kids, ok := dict["Kids"]; ok && dict["Type"] != Name("Page") {
+			for _, kid := range f.array(kids) {
+				walk(kid, resources)
+			}
+			return
+		}
+
+		page := Dict{}
+		for k, v := range dict {
+			page[k] = v
+		}
+		page["Resources"] = resources
+
+		pages = append(pages, page)
+	}
+
+	walk(f.dict(f.trailer["Root"])["Pages"], nil)
+
+	return pages
+}
+
+// contents returns the decoded content streams of page, concatenated.
+func (f *file) contents(page Dict) []byte {
+	var streams []interface{}
+
+	switch v := f.resolve(page["Contents"]).(type) {
+	case *Stream:
+		streams = append(streams, v)
+	case Array:
+		streams = v
+	}
+
+	var data []byte
+	for _, s := range streams {
+		stream, ok := f.resolve(s).(*Stream)
+		if !ok {
+			continue
+		}
+
+		decoded, err := f.decode(stream)
+		if err != nil {
+			continue
+		}
+
+		data = append(data, decoded...)
+		data = append(data, '\n')
+	}
+
+	return data
+}
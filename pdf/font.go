@@ -0,0 +1,349 @@
+package pdf
+
+import (
+	"strconv"
+	"strings"
+	"unicode/utf16"
+)
+
+// font maps the codes in shown strings to text and glyph widths.
+type font struct {
+	// codeLengths are the byte lengths codes may have, from the ToUnicode
+	// codespace ranges, shortest first.
+	codeLengths []int
+	toUnicode   map[uint32]string
+	encoding    *[256]rune
+	widths      map[uint32]float64
+	missing     float64
+}
+
+// glyph is one code of a shown string.
+type glyph struct {
+	text  string
+	width float64 // in text space, thousandths of the font size
+	space bool    // single byte code 32, which word spacing applies to
+}
+
+var winAnsi [256]rune
+var macRoman [256]rune
+
+func init() {
+	for i := range winAnsi {
+		winAnsi[i] = rune(i)
+		macRoman[i] = rune(i)
+	}
+
+	for i, r := range []rune("€\x81‚ƒ„…†‡ˆ‰Š‹Œ\x8dŽ\x8f\x90‘’“”•–—˜™š›œ\x9džŸ") {
+		winAnsi[0x80+i] = r
+	}
+
+	for i, r := range []rune("ÄÅÇÉÑÖÜáàâäãåçéèêëíìîïñóòôöõúùûü†°¢£§•¶ß®©™´¨≠ÆØ∞±≤≥¥µ∂∑∏π∫ªºΩæø¿¡¬√ƒ≈∆«»…\u00a0ÀÃÕŒœ–—“”‘’÷◊ÿŸ⁄€‹›ﬁﬂ‡·‚„‰ÂÊÁËÈÍÎÏÌÓÔÒÚÛÙıˆ˜¯˘˙˚¸˝˛ˇ") {
+		macRoman[0x80+i] = r
+	}
+}
+
+// glyphNames maps the glyph names commonly used in /Differences to text.
+// Single letters and uniXXXX names are handled by glyphText.
+var glyphNames = map[string]string{
+	"space": " ", "exclam": "!", "quotedbl": "\"", "numbersign": "#",
+	"dollar": "$", "percent": "%", "ampersand": "&", "quotesingle": "'",
+	"quoteright": "’", "quoteleft": "‘", "parenleft": "(", "parenright": ")",
+	"asterisk": "*", "plus": "+", "comma": ",", "hyphen": "-", "period": ".",
+	"slash": "/", "zero": "0", "one": "1", "two": "2", "three": "3",
+	"four": "4", "five": "5", "six": "6", "seven": "7", "eight": "8",
+	"nine": "9", "colon": ":", "semicolon": ";", "less": "<", "equal": "=",
+	"greater": ">", "question": "?", "at": "@", "bracketleft": "[",
+	"backslash": "\\", "bracketright": "]", "underscore": "_",
+	"braceleft": "{", "bar": "|", "braceright": "}", "asciitilde": "~",
+	"bullet": "•", "endash": "–", "emdash": "—", "quotedblleft": "“",
+	"quotedblright": "”", "quotesinglbase": "‚", "quotedblbase": "„",
+	"ellipsis": "…", "fi": "fi", "fl": "fl", "ff": "ff", "ffi": "ffi",
+	"ffl": "ffl", "dagger": "†", "daggerdbl": "‡", "degree": "°",
+	"copyright": "©", "registered": "®", "trademark": "™", "minus": "−",
+	"multiply": "×", "divide": "÷", "section": "§", "paragraph": "¶",
+	"eacute": "é", "egrave": "è", "ecircumflex": "ê", "edieresis": "ë",
+	"aacute": "á", "agrave": "à", "acircumflex": "â", "adieresis": "ä",
+	"iacute": "í", "oacute": "ó", "ocircumflex": "ô", "odieresis": "ö",
+	"uacute": "ú", "udieresis": "ü", "ntilde": "ñ", "ccedilla": "ç",
+	"germandbls": "ß", "nbspace": "\u00a0", "nonbreakingspace": "\u00a0",
+}
+
+func glyphText(name string) string {
+	if text, ok := glyphNames[name]; ok {
+		return text
+	}
+
+	if len(name) == 1 {
+		return name
+	}
+
+	if strings.HasPrefix(name, "uni") && len(name) >= 7 {
+		if v, err := strconv.ParseUint(name[3:7], 16, 32); err == nil {
+			return string(rune(v))
+		}
+	}
+
+	return ""
+}
+
+// loadFont reads the font dictionary referred to by v.
+func (f *file) loadFont(v interface{}) *font {
+	dict := f.dict(v)
+	ft := &font{codeLengths: []int{1}, widths: map[uint32]float64{}, missing: 500}
+
+	if dict == nil {
+		ft.encoding = &winAnsi
+		return ft
+	}
+
+	if f.name(dict["Subtype"]) == "Type0" {
+		// Composite fonts use two byte codes unless their CMap says otherwise
+		ft.codeLengths = []int{2}
+		ft.missing = 1000
+
+		if descendants := f.array(dict["DescendantFonts"]); len(descendants) > 0 {
+			descendant := f.dict(descendants[0])
+			if dw, ok := f.resolve(descendant["DW"]).(float64); ok {
+				ft.missing = dw
+			}
+			f.readCIDWidths(ft, f.array(descendant["W"]))
+		}
+	} else {
+		ft.encoding = f.simpleEncoding(dict["Encoding"])
+
+		firstChar := int(f.number(dict["FirstChar"]))
+		for i, w := range f.array(dict["Widths"]) {
+			ft.widths[uint32(firstChar+i)] = f.number(w)
+		}
+
+		if descriptor := f.dict(dict["FontDescriptor"]); descriptor != nil {
+			if mw, ok := f.resolve(descriptor["MissingWidth"]).(float64); ok && mw > 0 {
+				ft.missing = mw
+			}
+		}
+	}
+
+	if stream, ok := f.resolve(dict["ToUnicode"]).(*Stream); ok {
+		if data, err := f.decode(stream); err == nil {
+			ft.readCMap(data)
+		}
+	}
+
+	return ft
+}
+
+// simpleEncoding returns the byte to rune table of a simple font.
+func (f *file) simpleEncoding(v interface{}) *[256]rune {
+	table := winAnsi
+
+	v = f.resolve(v)
+	if dict, ok := v.(Dict); ok {
+		v = dict["BaseEncoding"]
+		if f.name(v) == "MacRomanEncoding" {
+			table = macRoman
+		}
+
+		code := 0
+		for _, item := range f.array(dict["Differences"]) {
+			switch item := f.resolve(item).(type) {
+			case float64:
+				code = int(item)
+			case Name:
+				if text := []rune(glyphText(string(item))); len(text) == 1 && code >= 0 && code < 256 {
+					table[code] = text[0]
+				}
+				code++
+			}
+		}
+
+		return &table
+	}
+
+	if f.name(v) == "MacRomanEncoding" {
+		table = macRoman
+	}
+
+	return &table
+}
+
+// readCIDWidths reads the /W array of a CID font, made of "c [w1 w2 ...]"
+// and "cFirst cLast w" entries.
+func (f *file) readCIDWidths(ft *font, w Array) {
+	for i := 0; i < len(w); {
+		first, ok := f.resolve(w[i]).(float64)
+		if !ok || i+1 >= len(w) {
+			return
+		}
+
+		if list, ok := f.resolve(w[i+1]).(Array); ok {
+			for j, width := range list {
+				ft.widths[uint32(first)+uint32(j)] = f.number(width)
+			}
+			i += 2
+			continue
+		}
+
+		if i+2 >= len(w) {
+			return
+		}
+
+		last := f.number(w[i+1])
+		width := f.number(w[i+2])
+		for c := first; c <= last && c-first < 65536; c++ {
+			ft.widths[uint32(c)] = width
+		}
+		i += 3
+	}
+}
+
+// readCMap reads a ToUnicode CMap's codespace ranges and its bfchar and
+// bfrange mappings.
+func (ft *font) readCMap(data []byte) {
+	ft.toUnicode = map[uint32]string{}
+	l := &lexer{data: data}
+	var lengths []int
+	var operands []interface{}
+
+	for {
+		t, ok := l.next()
+		if !ok {
+			break
+		}
+
+		if t.kind != 'k' {
+			operands = append(operands, l.objectFrom(t))
+			continue
+		}
+
+		switch t.value.(Keyword) {
+		case "endcodespacerange":
+			for i := 0; i+1 < len(operands); i += 2 {
+				if lo, ok := operands[i].(String); ok {
+					lengths = appendLength(lengths, len(lo))
+				}
+			}
+		case "endbfchar":
+			for i := 0; i+1 < len(operands); i += 2 {
+				src, ok1 := operands[i].(String)
+				dst, ok2 := operands[i+1].(String)
+				if ok1 && ok2 {
+					ft.toUnicode[codeOf(src)] = utf16Text(dst)
+				}
+			}
+		case "endbfrange":
+			for i := 0; i+2 < len(operands); i += 3 {
+				lo, ok1 := operands[i].(String)
+				hi, ok2 := operands[i+1].(String)
+				if !ok1 || !ok2 {
+					continue
+				}
+
+				start, end := codeOf(lo), codeOf(hi)
+				if end < start || end-start > 65535 {
+					continue
+				}
+
+				switch dst := operands[i+2].(type) {
+				case String:
+					// Consecutive codes map to consecutive characters
+					units := utf16Units(dst)
+					for c := start; c <= end && len(units) > 0; c++ {
+						ft.toUnicode[c] = string(utf16.Decode(units))
+						units = append([]uint16(nil), units...)
+						units[len(units)-1] += 1
+					}
+				case Array:
+					for j, item := range dst {
+						if s, ok := item.(String); ok && start+uint32(j) <= end {
+							ft.toUnicode[start+uint32(j)] = utf16Text(s)
+						}
+					}
+				}
+			}
+		}
+
+		operands = operands[:0]
+	}
+
+	if len(lengths) > 0 {
+		ft.codeLengths = lengths
+	}
+}
+
+func appendLength(lengths []int, n int) []int {
+	for i, l := range lengths {
+		if l == n {
+			return lengths
+		}
+		if l > n {
+			return append(lengths[:i], append([]int{n}, lengths[i:]...)...)
+		}
+	}
+
+	return append(lengths, n)
+}
+
+func codeOf(s String) uint32 {
+	var code uint32
+	for i := 0; i < len(s); i++ {
+		code = code<<8 | uint32(s[i])
+	}
+	return code
+}
+
+func utf16Units(s String) []uint16 {
+	units := make([]uint16, len(s)/2)
+	for i := range units {
+		units[i] = uint16(s[2*i])<<8 | uint16(s[2*i+1])
+	}
+	return units
+}
+
+func utf16Text(s String) string {
+	return string(utf16.Decode(utf16Units(s)))
+}
+
+// decode splits a shown string into glyphs.
+func (ft *font) decode(s String) []glyph {
+	var glyphs []glyph
+
+	for i := 0; i < len(s); {
+		n := ft.codeLength(s[i:])
+		code := codeOf(s[i : i+n])
+		i += n
+
+		g := glyph{width: ft.missing, space: n == 1 && code == 32}
+		if w, ok := ft.widths[code]; ok {
+			g.width = w
+		}
+
+		if text, ok := ft.toUnicode[code]; ok {
+			g.text = text
+		} else if ft.encoding != nil && code < 256 {
+			g.text = string(ft.encoding[code])
+		}
+
+		glyphs = append(glyphs, g)
+	}
+
+	return glyphs
+}
+
+// codeLength returns the length of the code at the start of s, the shortest
+// one that is mapped, or else the longest codespace.
+func (ft *font) codeLength(s String) int {
+	longest := 1
+
+	for _, n := range ft.codeLengths {
+		if n > len(s) {
+			break
+		}
+
+		longest = n
+		if _, ok := ft.toUnicode[codeOf(s[:n])]; ok {
+			return n
+		}
+	}
+
+	return longest
+}
@@ -0,0 +1,343 @@
+// Package pdf extracts the text of PDF documents in reading order so it can
+// be read out, leaving out running headers, footers and page numbers.
+package pdf
+
+import (
+	"math"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+	"unicode"
+	"unicode/utf8"
+)
+
+// Document is the text and metadata of a PDF file.
+type Document struct {
+	Title    string
+	Authors  []string
+	Language string
+	Created  time.Time
+	Pages    int
+	Text     string
+}
+
+// marginLines is how many lines at the top and bottom of each page are
+// checked for running headers, footers and page numbers.
+const marginLines = 3
+
+var (
+	digits     = regexp.MustCompile(`\d+`)
+	pageNumber = regexp.MustCompile(`(?i)^[-–—\s]*(page\s*)?(#|[ivxlc]+)(\s*(of|/)\s*#)?[-–—\s]*$`)
+	authorSep  = regexp.MustCompile(`\s*(?:[,;&]|\band\b)\s*`)
+)
+
+// Extract reads a PDF file and returns its text, one paragraph per block
+// separated by blank lines.
+func Extract(data []byte) (doc *Document, err error) {
+	// The input is untrusted, so a parser bug fails the file, not the caller
+	defer func() {
+		if r := recover(); r != nil {
+			doc, err = nil, ErrMalformed
+		}
+	}()
+
+	f, err := parseFile(data)
+	if err != nil {
+		return nil, err
+	}
+
+	pages := f.pages()
+	text := make([][]line, len(pages))
+	for i, page := range pages {
+		text[i] = lines(f.pageSpans(page))
+
+		if f.err != nil {
+			return nil, f.err
+		}
+	}
+
+	removeMargins(text)
+
+	doc = &Document{Pages: len(pages)}
+	f.readInfo(doc)
+
+	if doc.Title == "" {
+		doc.Title = firstHeading(text)
+	}
+
+	doc.Text = paragraphs(text, doc.Title)
+
+	return doc, nil
+}
+
+// readInfo fills in doc's metadata from the Info dictionary and catalog.
+func (f *file) readInfo(doc *Document) {
+	info := f.dict(f.trailer["Info"])
+
+	doc.Title = textString(f.resolve(info["Title"]))
+
+	if author := textString(f.resolve(info["Author"])); author != "" {
+		for _, name := range authorSep.Split(author, -1) {
+			if name != "" {
+				doc.Authors = append(doc.Authors, name)
+			}
+		}
+	}
+
+	doc.Created = parseDate(textString(f.resolve(info["CreationDate"])))
+	doc.Language = textString(f.resolve(f.dict(f.trailer["Root"])["Lang"]))
+}
+
+// textString decodes a string from the document's metadata, which is
+// UTF-16 when it starts with a byte order mark.
+func textString(v interface{}) string {
+	s, ok := v.(String)
+	if !ok {
+		return ""
+	}
+
+	var text string
+	if len(s) >= 2 && s[0] == 0xfe && s[1] == 0xff {
+		text = utf16Text(s[2:])
+	} else {
+		runes := make([]rune, len(s))
+		for i := 0; i < len(s); i++ {
+			runes[i] = winAnsi[s[i]]
+		}
+		text = string(runes)
+	}
+
+	return strings.Join(strings.Fields(text), " ")
+}
+
+// parseDate parses dates like D:20140812133000+02'00'.
+func parseDate(s string) time.Time {
+	s = strings.TrimPrefix(s, "D:")
+	s = strings.Replace(s, "'", "", -1)
+
+	if len(s) < 4 {
+		return time.Time{}
+	}
+
+	// Pad the missing fields with the start of the period
+	layout := "20060102150405"
+	value := s
+	if len(value) > len(layout) {
+		value = s[:len(layout)]
+	}
+	value += "0101000000"[len(value)-4:]
+
+	t, err := time.Parse(layout, value)
+	if err != nil {
+		return time.Time{}
+	}
+
+	if zone := s[minInt(len(s), len(layout)):]; len(zone) == 5 && (zone[0] == '+' || zone[0] == '-') {
+		if offset, err := time.Parse("-0700", zone); err == nil {
+			_, seconds := offset.Zone()
+			t = t.Add(-time.Duration(seconds) * time.Second)
+		}
+	}
+
+	return t.UTC()
+}
+
+// removeMargins drops lines at the top or bottom of pages that repeat on
+// most pages, ignoring numbers, and lines that are just page numbers.
+func removeMargins(pages [][]line) {
+	counts := map[string]int{}
+
+	for _, page := range pages {
+		seen := map[string]bool{}
+		for _, i := range marginIndexes(page) {
+			key := normalize(page[i].text)
+			if !seen[key] {
+				seen[key] = true
+				counts[key]++
+			}
+		}
+	}
+
+	repeated := func(key string) bool {
+		return len(pages) >= 2 && counts[key] >= 2 && counts[key]*2 >= len(pages)
+	}
+
+	for p, page := range pages {
+		drop := map[int]bool{}
+		for _, i := range marginIndexes(page) {
+			key := normalize(page[i].text)
+			if repeated(key) || pageNumber.MatchString(key) {
+				drop[i] = true
+			}
+		}
+
+		kept := page[:0]
+		for i, l := range page {
+			if !drop[i] {
+				kept = append(kept, l)
+			}
+		}
+		pages[p] = kept
+	}
+}
+
+// marginIndexes returns the indexes of the highest and lowest lines of page.
+func marginIndexes(page []line) []int {
+	order := make([]int, len(page))
+	for i := range order {
+		order[i] = i
+	}
+
+	sort.SliceStable(order, func(a, b int) bool {
+		return page[order[a]].y > page[order[b]].y
+	})
+
+	if len(order) <= 2*marginLines {
+		return order
+	}
+
+	return append(order[:marginLines:marginLines], order[len(order)-marginLines:]...)
+}
+
+func normalize(text string) string {
+	return digits.ReplaceAllString(strings.ToLower(strings.TrimSpace(text)), "#")
+}
+
+// firstHeading returns the first line set in the largest type on the first
+// page, when it stands out from the body text.
+func firstHeading(pages [][]line) string {
+	if len(pages) == 0 || len(pages[0]) == 0 {
+		return ""
+	}
+
+	sizes := make([]float64, len(pages[0]))
+	best := 0
+	for i, l := range pages[0] {
+		sizes[i] = l.size
+		if l.size > pages[0][best].size {
+			best = i
+		}
+	}
+
+	if pages[0][best].size < median(sizes)*1.3 {
+		return ""
+	}
+
+	return pages[0][best].text
+}
+
+// paragraphs joins lines into paragraphs, separated by blank lines. A new
+// paragraph starts after a gap wider than the usual line spacing, at a
+// change of type size, or at an indented line. Words hyphenated across
+// lines are joined back together.
+func paragraphs(pages [][]line, title string) string {
+	var gaps, sizes []float64
+	for _, page := range pages {
+		for i, l := range page {
+			sizes = append(sizes, l.size)
+			if i > 0 && page[i-1].y > l.y {
+				gaps = append(gaps, page[i-1].y-l.y)
+			}
+		}
+	}
+
+	spacing := mostCommon(gaps)
+	if spacing == 0 {
+		spacing = median(sizes) * 1.2
+	}
+
+	var texts []string
+	var current string
+	var prev *line
+
+	flush := func() {
+		if current != "" && !strings.EqualFold(current, title) {
+			texts = append(texts, current)
+		}
+		current = ""
+	}
+
+	for p, page := range pages {
+		for i := range page {
+			l := &page[i]
+
+			switch {
+			case prev == nil:
+			case i == 0:
+				// Paragraphs carry over to the next page unless the last
+				// one ended a sentence
+				if p > 0 && endsSentence(current) {
+					flush()
+				}
+			case prev.y-l.y > spacing*1.4 || prev.y < l.y:
+				flush()
+			case math.Abs(l.size-prev.size) > math.Max(1, prev.size*0.15):
+				flush()
+			case l.x-prev.x > l.size && endsSentence(current):
+				flush()
+			}
+
+			current = join(current, l.text)
+			prev = l
+		}
+	}
+	flush()
+
+	return strings.Join(texts, "\n\n")
+}
+
+func endsSentence(text string) bool {
+	text = strings.TrimRight(text, `"'”’)`)
+	return strings.HasSuffix(text, ".") || strings.HasSuffix(text, "!") ||
+		strings.HasSuffix(text, "?") || strings.HasSuffix(text, ":")
+}
+
+// join appends a line to a paragraph, undoing hyphenation when the line
+// ends a word part and the next one starts in lowercase.
+func join(paragraph, text string) string {
+	if paragraph == "" {
+		return text
+	}
+
+	if strings.HasSuffix(paragraph, "-") {
+		before, _ := utf8.DecodeLastRuneInString(paragraph[:len(paragraph)-1])
+		after, _ := utf8.DecodeRuneInString(text)
+
+		if unicode.IsLetter(before) && unicode.IsLower(after) {
+			return paragraph[:len(paragraph)-1] + text
+		}
+	}
+
+	return paragraph + " " + text
+}
+
+// mostCommon returns the most frequent of values to the nearest half
+// point, the smallest one on ties. Line spacing is the gap that most lines
+// have, which the median misses on pages of short paragraphs.
+func mostCommon(values []float64) float64 {
+	counts := map[float64]int{}
+	best := 0.0
+
+	for _, v := range values {
+		v = math.Floor(v*2+0.5) / 2
+		counts[v]++
+
+		if counts[v] > counts[best] || counts[v] == counts[best] && v < best {
+			best = v
+		}
+	}
+
+	return best
+}
+
+func median(values []float64) float64 {
+	if len(values) == 0 {
+		return 0
+	}
+
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+
+	return sorted[len(sorted)/2]
+}
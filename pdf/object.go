@@ -0,0 +1,312 @@
+package pdf
+
+import (
+	"bytes"
+	"strconv"
+)
+
+// The PDF object types. Numbers are float64, strings are the raw bytes as a
+// String and booleans are bool; null is nil.
+type (
+	Name    string
+	String  string
+	Keyword string
+	Array   []interface{}
+	Dict    map[Name]interface{}
+)
+
+// Ref refers to an indirect object.
+type Ref struct {
+	Num, Gen int
+}
+
+// Stream is a dictionary followed by still encoded data.
+type Stream struct {
+	Dict Dict
+	Data []byte
+}
+
+type token struct {
+	kind  byte // n(umber), /, (, <, k(eyword), or a delimiter: [ ] { } d(ict start) e(nd)
+	value interface{}
+}
+
+// lexer reads tokens from PDF files and content streams.
+type lexer struct {
+	data []byte
+	pos  int
+}
+
+func isWhite(c byte) bool {
+	return c == 0 || c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+func isDelimiter(c byte) bool {
+	return bytes.IndexByte([]byte("()<>[]{}/%"), c) >= 0
+}
+
+func (l *lexer) skipSpace() {
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+
+		if c == '%' {
+			for l.pos < len(l.data) && l.data[l.pos] != '\n' && l.data[l.pos] != '\r' {
+				l.pos++
+			}
+			continue
+		}
+
+		if !isWhite(c) {
+			return
+		}
+
+		l.pos++
+	}
+}
+
+// next returns the next token, or false at the end of the data.
+func (l *lexer) next() (token, bool) {
+	l.skipSpace()
+	if l.pos >= len(l.data) {
+		return token{}, false
+	}
+
+	c := l.data[l.pos]
+
+	switch {
+	case c == '/':
+		l.pos++
+		return token{'/', Name(l.regular(true))}, true
+	case c == '(':
+		l.pos++
+		return token{'(', String(l.literalString())}, true
+	case c == '<' && l.peek(1) == '<':
+		l.pos += 2
+		return token{'d', nil}, true
+	case c == '>' && l.peek(1) == '>':
+		l.pos += 2
+		return token{'e', nil}, true
+	case c == '<':
+		l.pos++
+		return token{'<', String(l.hexString())}, true
+	case c == '[' || c == ']' || c == '{' || c == '}':
+		l.pos++
+		return token{c, nil}, true
+	case c == ')' || c == '>':
+		// Stray delimiter, skip it
+		l.pos++
+		return l.next()
+	}
+
+	word := l.regular(false)
+	if n, err := strconv.ParseFloat(word, 64); err == nil {
+		return token{'n', n}, true
+	}
+
+	return token{'k', Keyword(word)}, true
+}
+
+func (l *lexer) peek(offset int) byte {
+	if l.pos+offset < len(l.data) {
+		return l.data[l.pos+offset]
+	}
+	return 0
+}
+
+// regular reads a run of regular characters, decoding #xx escapes in names.
+func (l *lexer) regular(name bool) string {
+	var b []byte
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		if isWhite(c) || isDelimiter(c) {
+			break
+		}
+
+		if name && c == '#' && l.pos+2 < len(l.data) {
+			if v, err := strconv.ParseUint(string(l.data[l.pos+1:l.pos+3]), 16, 8); err == nil {
+				b = append(b, byte(v))
+				l.pos += 3
+				continue
+			}
+		}
+
+		b = append(b, c)
+		l.pos++
+	}
+
+	if len(b) == 0 && !name {
+		// Never return an empty keyword, which would loop forever
+		b = append(b, l.data[l.pos])
+		l.pos++
+	}
+
+	return string(b)
+}
+
+func (l *lexer) literalString() []byte {
+	var b []byte
+	depth := 1
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+			if depth == 0 {
+				return b
+			}
+		case '\\':
+			if l.pos >= len(l.data) {
+				return b
+			}
+
+			c = l.data[l.pos]
+			l.pos++
+
+			switch c {
+			case 'n':
+				c = '\n'
+			case 'r':
+				c = '\r'
+			case 't':
+				c = '\t'
+			case 'b':
+				c = '\b'
+			case 'f':
+				c = '\f'
+			case '\r':
+				// Line continuation
+				if l.peek(0) == '\n' {
+					l.pos++
+				}
+				continue
+			case '\n':
+				continue
+			default:
+				if c >= '0' && c <= '7' {
+					v := int(c - '0')
+					for i := 0; i < 2 && l.pos < len(l.data) && l.data[l.pos] >= '0' && l.data[l.pos] <= '7'; i++ {
+						v = v*8 + int(l.data[l.pos]-'0')
+						l.pos++
+					}
+					c = byte(v)
+				}
+			}
+		}
+
+		b = append(b, c)
+	}
+
+	return b
+}
+
+func (l *lexer) hexString() []byte {
+	var b []byte
+	var digits []byte
+
+	for l.pos < len(l.data) {
+		c := l.data[l.pos]
+		l.pos++
+
+		if c == '>' {
+			break
+		}
+
+		if isWhite(c) {
+			continue
+		}
+
+		digits = append(digits, c)
+	}
+
+	if len(digits)%2 == 1 {
+		digits = append(digits, '0')
+	}
+
+	for i := 0; i < len(digits); i += 2 {
+		if v, err := strconv.ParseUint(string(digits[i:i+2]), 16, 8); err == nil {
+			b = append(b, byte(v))
+		}
+	}
+
+	return b
+}
+
+// object reads the next object, resolving "n g R" into a Ref. Keywords other
+// than true, false and null are returned as a Keyword, e.g. content stream
+// operators or "endobj".
+func (l *lexer) object() (interface{}, bool) {
+	t, ok := l.next()
+	if !ok {
+		return nil, false
+	}
+
+	return l.objectFrom(t), true
+}
+
+func (l *lexer) objectFrom(t token) interface{} {
+	switch t.kind {
+	case 'n':
+		// Look ahead for an indirect reference
+		saved := l.pos
+		if gen, ok := l.next(); ok && gen.kind == 'n' {
+			if r, ok := l.next(); ok && r.kind == 'k' && r.value == Keyword("R") {
+				return Ref{int(t.value.(float64)), int(gen.value.(float64))}
+			}
+		}
+		l.pos = saved
+		return t.value
+	case 'd':
+		dict := Dict{}
+		for {
+			key, ok := l.next()
+			if !ok || key.kind == 'e' {
+				return dict
+			}
+
+			if key.kind != '/' {
+				continue
+			}
+
+			value, ok := l.object()
+			if !ok {
+				return dict
+			}
+
+			if k, isKeyword := value.(Keyword); isKeyword && k == ">>" {
+				return dict
+			}
+
+			dict[key.value.(Name)] = value
+		}
+	case '[':
+		array := Array{}
+		for {
+			item, ok := l.next()
+			if !ok || item.kind == ']' {
+				return array
+			}
+			array = append(array, l.objectFrom(item))
+		}
+	case 'k':
+		switch t.value.(Keyword) {
+		case "true":
+			return true
+		case "false":
+			return false
+		case "null":
+			return nil
+		}
+	case 'e':
+		return Keyword(">>")
+	case ']', '{', '}':
+		return Keyword(string(t.kind))
+	}
+
+	return t.value
+}
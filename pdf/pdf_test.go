@@ -0,0 +1,355 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// build writes a PDF file with the given objects, numbered from 1, and a
+// trailer dictionary. Empty objects are left out. There is no xref table,
+// as the reader doesn't need one.
+func build(trailer string, objects ...string) []byte {
+	var b bytes.Buffer
+	b.WriteString("%PDF-1.5\n%\xe2\xe3\xcf\xd3\n")
+
+	for i, object := range objects {
+		if object == "" {
+			continue
+		}
+		fmt.Fprintf(&b, "%d 0 obj\n%s\nendobj\n", i+1, object)
+	}
+
+	if trailer != "" {
+		fmt.Fprintf(&b, "trailer\n%s\n", trailer)
+	}
+	b.WriteString("startxref\n0\n%%EOF\n")
+
+	return b.Bytes()
+}
+
+func stream(dict, data string) string {
+	return fmt.Sprintf("<< %s /Length %d >>\nstream\n%s\nendstream", dict, len(data), data)
+}
+
+func deflate(data string) string {
+	var b bytes.Buffer
+	w := zlib.NewWriter(&b)
+	w.Write([]byte(data))
+	w.Close()
+	return b.String()
+}
+
+// document builds a file of simple pages set in Helvetica, one content
+// stream per page.
+func document(info string, contents ...string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R /Lang (en-GB) >>",
+		"",
+		"<< /Type /Font /Subtype /Type1 /BaseFont /Helvetica >>",
+	}
+
+	var kids string
+	for _, content := range contents {
+		objects = append(objects, stream("", content))
+		objects = append(objects, fmt.Sprintf("<< /Type /Page /Parent 2 0 R /Contents %d 0 R >>", len(objects)))
+		kids += fmt.Sprintf("%d 0 R ", len(objects))
+	}
+
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d /Resources << /Font << /F1 3 0 R >> >> >>", kids, len(contents))
+
+	trailer := "<< /Root 1 0 R >>"
+	if info != "" {
+		objects = append(objects, info)
+		trailer = fmt.Sprintf("<< /Root 1 0 R /Info %d 0 R >>", len(objects))
+	}
+
+	return build(trailer, objects...)
+}
+
+func page(number int, body string) string {
+	return fmt.Sprintf(`BT /F1 9 Tf 72 770 Td (Annual Report 2014) Tj ET
+%s
+BT /F1 9 Tf 280 40 Td (Page %d of 3) Tj ET`, body, number)
+}
+
+func TestExtract(t *testing.T) {
+	data := document("",
+		page(1, `BT /F1 20 Tf 72 720 Td (A Report on Bridges) Tj ET
+BT /F1 11 Tf 14 TL 72 690 Td
+(Bridges need regular care. Most of the) Tj T*
+(money goes to infra-) Tj T*
+(structure built long ago.) Tj
+0 -28 Td (Inspections happen every two years and) Tj
+T* (find most problems early, before) Tj ET`),
+		page(2, `BT /F1 11 Tf 14 TL 72 720 Td
+(they become expensive.) Tj
+0 -28 Td (Repairs are planned) Tj ( a year ahead.) Tj ET`),
+		page(3, `BT /F1 11 Tf 72 720 Td (The end.) Tj ET`),
+	)
+
+	doc, err := Extract(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := "Bridges need regular care. Most of the money goes to infrastructure built long ago.\n\n" +
+		"Inspections happen every two years and find most problems early, before they become expensive.\n\n" +
+		"Repairs are planned a year ahead.\n\n" +
+		"The end."
+
+	if doc.Text != expected {
+		t.Errorf("Expected text\n%q\ngot\n%q", expected, doc.Text)
+	}
+
+	if doc.Pages != 3 {
+		t.Errorf("Expected 3 pages, got %d", doc.Pages)
+	}
+
+	if doc.Title != "A Report on Bridges" {
+		t.Errorf("Expected the heading as title, got %q", doc.Title)
+	}
+
+	if doc.Language != "en-GB" {
+		t.Errorf("Expected language en-GB, got %q", doc.Language)
+	}
+}
+
+func TestExtractMetadata(t *testing.T) {
+	data := document(`<< /Title <FEFF0043006C00E9002000E0002000740069> /Author (Ana Ruiz and Bo Chen)
+/CreationDate (D:20140812133000+02'00') >>`,
+		`BT /F1 11 Tf 72 700 Td (Some text.) Tj ET`)
+
+	doc, err := Extract(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := &Document{
+		Title:    "Clé à ti",
+		Authors:  []string{"Ana Ruiz", "Bo Chen"},
+		Language: "en-GB",
+		Created:  time.Date(2014, 8, 12, 11, 30, 0, 0, time.UTC),
+		Pages:    1,
+		Text:     "Some text.",
+	}
+
+	if !reflect.DeepEqual(doc, expected) {
+		t.Errorf("Expected\n%+v\ngot\n%+v", expected, doc)
+	}
+}
+
+// TestExtractCompressed reads a file written the way newer tools do, with
+// compressed content, an object stream, a cross-reference stream instead of
+// a trailer and a composite font that only a ToUnicode CMap can decode.
+func TestExtractCompressed(t *testing.T) {
+	cmap := `/CIDInit /ProcSet findresource begin
+12 dict begin
+begincmap
+1 begincodespacerange
+<0000> <FFFF>
+endcodespacerange
+4 beginbfchar
+<0001> <0048>
+<0005> <0057>
+<0006> <0072>
+<0007> <0064>
+endbfchar
+1 beginbfrange
+<0002> <0004> [<0065> <006C> <006F>]
+endbfrange
+1 beginbfrange
+<0010> <0012> <0061>
+endbfrange
+endcmap
+CMapName currentdict /CMap defineresource pop
+end
+end`
+
+	content := `q 1 0 0 1 72 700 cm
+BT /F1 12 Tf 0 0 Td
+[<00010002> -20 <000300030004> -300 <00050004> 10 <000600030007>] TJ
+0 -16 Td <001000110012> Tj
+ET Q`
+
+	// Objects 5 and 6 only exist inside the object stream
+	fonts := "<< /Type /Font /Subtype /Type0 /BaseFont /ABCDEF+Font /Encoding /Identity-H /DescendantFonts [6 0 R] /ToUnicode 7 0 R >>"
+	cidFont := "<< /Type /Font /Subtype /CIDFontType2 /BaseFont /ABCDEF+Font /DW 600 /W [1 [700 500] 5 7 550] >>"
+	header := fmt.Sprintf("5 0 6 %d ", len(fonts)+1)
+	objects := header + fonts + "\n" + cidFont
+
+	data := build("",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Parent 2 0 R /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+		stream("/Filter /FlateDecode", deflate(content)),
+		"",
+		"",
+		stream("/Filter [/FlateDecode]", deflate(cmap)),
+		stream(fmt.Sprintf("/Type /ObjStm /N 2 /First %d /Filter /FlateDecode", len(header)), deflate(objects)),
+		stream("/Type /XRef /Size 10 /Root 1 0 R /W [1 2 1]", ""),
+	)
+
+	doc, err := Extract(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Text != "Hello World abc" {
+		t.Errorf("Expected %q, got %q", "Hello World abc", doc.Text)
+	}
+}
+
+func TestExtractEncoding(t *testing.T) {
+	data := build("<< /Root 1 0 R >>",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+		"<< /Type /Page /Resources << /Font << /F1 5 0 R /F2 6 0 R >> >> /Contents 4 0 R >>",
+		stream("/Filter /ASCIIHexDecode", fmt.Sprintf("%x>", "BT /F1 12 Tf 72 700 Td (Caf\x8e \xd2ok\xd3) Tj /F2 12 Tf ( \x01 ) Tj ET")),
+		"<< /Type /Font /Subtype /Type1 /Encoding /MacRomanEncoding >>",
+		"<< /Type /Font /Subtype /Type1 /Encoding << /BaseEncoding /WinAnsiEncoding /Differences [1 /uni263A] >> >>",
+	)
+
+	doc, err := Extract(data)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if expected := "Café “ok” ☺"; doc.Text != expected {
+		t.Errorf("Expected %q, got %q", expected, doc.Text)
+	}
+}
+
+func TestExtractErrors(t *testing.T) {
+	if _, err := Extract([]byte("<html><body>Not a PDF</body></html>")); err != ErrNotPDF {
+		t.Errorf("Expected ErrNotPDF, got %v", err)
+	}
+
+	encrypted := build("<< /Root 1 0 R /Encrypt 3 0 R >>",
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"<< /Type /Pages /Kids [] /Count 0 >>",
+		"<< /Filter /Standard /V 2 /R 3 /O (x) /U (y) /P -4 >>",
+	)
+
+	if _, err := Extract(encrypted); err != ErrEncrypted {
+		t.Errorf("Expected ErrEncrypted, got %v", err)
+	}
+}
+
+func TestParseDate(t *testing.T) {
+	tests := map[string]time.Time{
+		"D:20140812133000+02'00'": time.Date(2014, 8, 12, 11, 30, 0, 0, time.UTC),
+		"D:20140812133000Z":       time.Date(2014, 8, 12, 13, 30, 0, 0, time.UTC),
+		"D:201408":                time.Date(2014, 8, 1, 0, 0, 0, 0, time.UTC),
+		"20031205":                time.Date(2003, 12, 5, 0, 0, 0, 0, time.UTC),
+		"yesterday":               time.Time{},
+	}
+
+	for input, expected := range tests {
+		if actual := parseDate(input); !actual.Equal(expected) {
+			t.Errorf("parseDate(%q): expected %v, got %v", input, expected, actual)
+		}
+	}
+}
+
+// shared builds a file of pages that all show the same content stream.
+func shared(pages int, content string) []byte {
+	objects := []string{
+		"<< /Type /Catalog /Pages 2 0 R >>",
+		"",
+		stream("/Filter /FlateDecode", deflate(content)),
+	}
+
+	var kids string
+	for i := 0; i < pages; i++ {
+		objects = append(objects, "<< /Type /Page /Parent 2 0 R /Contents 3 0 R >>")
+		kids += fmt.Sprintf("%d 0 R ", len(objects))
+	}
+	objects[1] = fmt.Sprintf("<< /Type /Pages /Kids [%s] /Count %d >>", kids, pages)
+
+	return build("<< /Root 1 0 R >>", objects...)
+}
+
+func TestExtractTooLarge(t *testing.T) {
+	defer func(size int) { maxDecodedSize = size }(maxDecodedSize)
+	maxDecodedSize = 1 << 20
+
+	// A small stream that inflates past the limit
+	bomb := "BT 72 700 Td (Boom) Tj ET\n" + string(make([]byte, 2<<20))
+
+	if _, err := Extract(shared(1, bomb)); err != ErrTooLarge {
+		t.Errorf("Expected ErrTooLarge, got %v", err)
+	}
+
+	// A stream shared by many pages is only decoded once, so it counts once
+	content := "BT 72 700 Td (Shared.) Tj ET\n" + string(make([]byte, 300<<10))
+
+	doc, err := Extract(shared(5, content))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if doc.Pages != 5 {
+		t.Errorf("Expected 5 pages, got %d", doc.Pages)
+	}
+}
+
+func TestExtractBadLength(t *testing.T) {
+	content := "BT /F1 12 Tf 72 700 Td (Still here.) Tj ET"
+
+	for _, length := range []string{"1e308", "-1e308", "Inf", "NaN", "99999"} {
+		data := build("<< /Root 1 0 R >>",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Contents 4 0 R >>",
+			fmt.Sprintf("<< /Length %s >>\nstream\n%s\nendstream", length, content),
+		)
+
+		doc, err := Extract(data)
+		if err != nil {
+			t.Errorf("/Length %s: %v", length, err)
+			continue
+		}
+
+		if doc.Text != "Still here." {
+			t.Errorf("/Length %s: expected the text, got %q", length, doc.Text)
+		}
+	}
+}
+
+func TestExtractBadObjectStream(t *testing.T) {
+	content := "BT /F1 12 Tf 72 700 Td (Still here.) Tj ET"
+	objects := "<< /Type /Font /Subtype /Type1 >>"
+
+	tests := map[string]string{
+		"negative First":  stream("/Type /ObjStm /N 1 /First -44", "5 0 "+objects),
+		"huge First":      stream("/Type /ObjStm /N 1 /First 1e308", "5 0 "+objects),
+		"negative offset": stream("/Type /ObjStm /N 2 /First 8", "5 -44 6 -1e308 "+objects),
+		"offset past end": stream("/Type /ObjStm /N 1 /First 4", "5 1e308 "+objects),
+	}
+
+	for name, objStm := range tests {
+		data := build("<< /Root 1 0 R >>",
+			"<< /Type /Catalog /Pages 2 0 R >>",
+			"<< /Type /Pages /Kids [3 0 R] /Count 1 >>",
+			"<< /Type /Page /Resources << /Font << /F1 5 0 R >> >> /Contents 4 0 R >>",
+			stream("", content),
+			"",
+			"",
+			objStm,
+		)
+
+		doc, err := Extract(data)
+		if err != nil {
+			t.Errorf("%s: %v", name, err)
+			continue
+		}
+
+		if doc.Text != "Still here." {
+			t.Errorf("%s: expected the text, got %q", name, doc.Text)
+		}
+	}
+}
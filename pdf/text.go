@@ -0,0 +1,344 @@
+package pdf
+
+import (
+	"bytes"
+	"math"
+	"strings"
+	"unicode"
+)
+
+// matrix is an affine transform [a b c d e f], as used by cm and Tm.
+type matrix [6]float64
+
+var identity = matrix{1, 0, 0, 1, 0, 0}
+
+// mul returns m followed by n.
+func (m matrix) mul(n matrix) matrix {
+	return matrix{
+		m[0]*n[0] + m[1]*n[2],
+		m[0]*n[1] + m[1]*n[3],
+		m[2]*n[0] + m[3]*n[2],
+		m[2]*n[1] + m[3]*n[3],
+		m[4]*n[0] + m[5]*n[2] + n[4],
+		m[4]*n[1] + m[5]*n[3] + n[5],
+	}
+}
+
+// span is a run of text shown by one operator, in page space.
+type span struct {
+	x, y, endX float64
+	size       float64
+	text       string
+}
+
+// line is a row of spans sharing a baseline.
+type line struct {
+	x, y, size float64
+	endX       float64
+	text       string
+}
+
+type graphicsState struct {
+	ctm      matrix
+	font     *font
+	size     float64
+	charSp   float64
+	wordSp   float64
+	scale    float64
+	leading  float64
+	rise     float64
+	fontName Name
+}
+
+// textState interprets content streams, collecting the text they show.
+type textState struct {
+	f     *file
+	gs    graphicsState
+	stack []graphicsState
+	tm    matrix
+	tlm   matrix
+	spans []span
+	fonts map[*Stream]map[Name]*font
+	depth int
+}
+
+// pageSpans returns the text shown on page, in content stream order.
+func (f *file) pageSpans(page Dict) []span {
+	s := &textState{f: f, fonts: map[*Stream]map[Name]*font{}}
+	s.gs = graphicsState{ctm: identity, scale: 1}
+	s.run(f.contents(page), f.dict(page["Resources"]), nil)
+
+	return s.spans
+}
+
+// run interprets one content stream. key identifies the stream for caching
+// its fonts, nil for the page itself.
+func (s *textState) run(data []byte, resources Dict, key *Stream) {
+	if s.fonts[key] == nil {
+		s.fonts[key] = map[Name]*font{}
+	}
+	fonts := s.fonts[key]
+
+	l := &lexer{data: data}
+	var operands []interface{}
+
+	for {
+		t, ok := l.next()
+		if !ok {
+			return
+		}
+
+		if t.kind != 'k' {
+			operands = append(operands, l.objectFrom(t))
+			continue
+		}
+
+		op := string(t.value.(Keyword))
+		n := numbers(operands)
+
+		switch op {
+		case "q":
+			s.stack = append(s.stack, s.gs)
+		case "Q":
+			if len(s.stack) > 0 {
+				s.gs = s.stack[len(s.stack)-1]
+				s.stack = s.stack[:len(s.stack)-1]
+			}
+		case "cm":
+			if len(n) == 6 {
+				s.gs.ctm = matrix{n[0], n[1], n[2], n[3], n[4], n[5]}.mul(s.gs.ctm)
+			}
+		case "BT":
+			s.tm, s.tlm = identity, identity
+		case "Tf":
+			if len(operands) == 2 {
+				name, _ := operands[0].(Name)
+				if fonts[name] == nil {
+					fonts[name] = s.f.loadFont(s.f.dict(resources["Font"])[name])
+				}
+				s.gs.font, s.gs.fontName = fonts[name], name
+				s.gs.size, _ = operands[1].(float64)
+			}
+		case "Tc":
+			if len(n) == 1 {
+				s.gs.charSp = n[0]
+			}
+		case "Tw":
+			if len(n) == 1 {
+				s.gs.wordSp = n[0]
+			}
+		case "Tz":
+			if len(n) == 1 {
+				s.gs.scale = n[0] / 100
+			}
+		case "TL":
+			if len(n) == 1 {
+				s.gs.leading = n[0]
+			}
+		case "Ts":
+			if len(n) == 1 {
+				s.gs.rise = n[0]
+			}
+		case "Td":
+			if len(n) == 2 {
+				s.moveLine(n[0], n[1])
+			}
+		case "TD":
+			if len(n) == 2 {
+				s.gs.leading = -n[1]
+				s.moveLine(n[0], n[1])
+			}
+		case "Tm":
+			if len(n) == 6 {
+				s.tm = matrix{n[0], n[1], n[2], n[3], n[4], n[5]}
+				s.tlm = s.tm
+			}
+		case "T*":
+			s.moveLine(0, -s.gs.leading)
+		case "Tj":
+			if len(operands) == 1 {
+				s.show(Array{operands[0]})
+			}
+		case "TJ":
+			if len(operands) == 1 {
+				a, _ := operands[0].(Array)
+				s.show(a)
+			}
+		case "'":
+			if len(operands) == 1 {
+				s.moveLine(0, -s.gs.leading)
+				s.show(Array{operands[0]})
+			}
+		case "\"":
+			if len(operands) == 3 {
+				s.gs.wordSp, _ = operands[0].(float64)
+				s.gs.charSp, _ = operands[1].(float64)
+				s.moveLine(0, -s.gs.leading)
+				s.show(Array{operands[2]})
+			}
+		case "Do":
+			if len(operands) == 1 {
+				name, _ := operands[0].(Name)
+				s.form(s.f.dict(resources["XObject"])[name])
+			}
+		case "ID":
+			skipInlineImage(l)
+		}
+
+		operands = operands[:0]
+	}
+}
+
+// form runs a form XObject, which may hold text of its own.
+func (s *textState) form(v interface{}) {
+	stream, ok := s.f.resolve(v).(*Stream)
+	if !ok || s.f.name(stream.Dict["Subtype"]) != "Form" || s.depth >= 8 {
+		return
+	}
+
+	data, err := s.f.decode(stream)
+	if err != nil {
+		return
+	}
+
+	saved, tm, tlm := s.gs, s.tm, s.tlm
+	if n := numbers(s.f.array(stream.Dict["Matrix"])); len(n) == 6 {
+		s.gs.ctm = matrix{n[0], n[1], n[2], n[3], n[4], n[5]}.mul(s.gs.ctm)
+	}
+
+	resources := s.f.dict(stream.Dict["Resources"])
+	if resources == nil {
+		resources = Dict{}
+	}
+
+	s.depth++
+	s.run(data, resources, stream)
+	s.depth--
+
+	s.gs, s.tm, s.tlm = saved, tm, tlm
+}
+
+// skipInlineImage moves l past the binary data of an inline image.
+func skipInlineImage(l *lexer) {
+	for i := l.pos; i+2 <= len(l.data); i++ {
+		if l.data[i] == 'E' && l.data[i+1] == 'I' && (i == 0 || isWhite(l.data[i-1])) &&
+			(i+2 == len(l.data) || isWhite(l.data[i+2])) {
+			l.pos = i + 2
+			return
+		}
+	}
+
+	l.pos = len(l.data)
+}
+
+func numbers(operands []interface{}) []float64 {
+	n := make([]float64, 0, len(operands))
+	for _, o := range operands {
+		if v, ok := o.(float64); ok {
+			n = append(n, v)
+		}
+	}
+	return n
+}
+
+func (s *textState) moveLine(tx, ty float64) {
+	s.tlm = matrix{1, 0, 0, 1, tx, ty}.mul(s.tlm)
+	s.tm = s.tlm
+}
+
+// show shows the strings of a TJ array, moving the text matrix along.
+// Large negative adjustments stand for spaces between words.
+func (s *textState) show(items Array) {
+	ft := s.gs.font
+	if ft == nil {
+		ft = s.f.loadFont(nil)
+		s.gs.font = ft
+	}
+
+	start := s.position()
+	var text bytes.Buffer
+
+	for _, item := range items {
+		switch item := item.(type) {
+		case float64:
+			s.advance(-item / 1000 * s.gs.size * s.gs.scale)
+			if item < -200 && text.Len() > 0 {
+				text.WriteByte(' ')
+			}
+		case String:
+			for _, g := range ft.decode(item) {
+				text.WriteString(g.text)
+
+				tx := g.width/1000*s.gs.size + s.gs.charSp
+				if g.space {
+					tx += s.gs.wordSp
+				}
+				s.advance(tx * s.gs.scale)
+			}
+		}
+	}
+
+	str := strings.Map(func(r rune) rune {
+		if r == 0 || unicode.IsControl(r) && r != '\t' {
+			return -1
+		}
+		return r
+	}, text.String())
+
+	if strings.TrimSpace(str) == "" {
+		return
+	}
+
+	end := s.position()
+	trm := matrix{s.gs.size, 0, 0, s.gs.size, 0, 0}.mul(s.tm).mul(s.gs.ctm)
+
+	s.spans = append(s.spans, span{
+		x:    start[0],
+		y:    start[1],
+		endX: end[0],
+		size: math.Hypot(trm[2], trm[3]),
+		text: str,
+	})
+}
+
+func (s *textState) advance(tx float64) {
+	s.tm = matrix{1, 0, 0, 1, tx, 0}.mul(s.tm)
+}
+
+// position is the current point of the text matrix in page space.
+func (s *textState) position() [2]float64 {
+	m := matrix{1, 0, 0, 1, 0, s.gs.rise}.mul(s.tm).mul(s.gs.ctm)
+	return [2]float64{m[4], m[5]}
+}
+
+// lines groups spans into lines. Spans that continue on the same baseline
+// join the current line, with a space where there is a gap between them.
+func lines(spans []span) []line {
+	var result []line
+
+	for _, sp := range spans {
+		if len(result) > 0 {
+			last := &result[len(result)-1]
+			tolerance := math.Max(last.size, sp.size) * 0.5
+
+			if math.Abs(sp.y-last.y) <= tolerance && sp.x >= last.endX-sp.size {
+				if sp.x-last.endX > sp.size*0.15 && !strings.HasSuffix(last.text, " ") && !strings.HasPrefix(sp.text, " ") {
+					last.text += " "
+				}
+
+				last.text += sp.text
+				last.endX = math.Max(last.endX, sp.endX)
+				last.size = math.Max(last.size, sp.size)
+				continue
+			}
+		}
+
+		result = append(result, line{x: sp.x, y: sp.y, size: sp.size, endX: sp.endX, text: sp.text})
+	}
+
+	for i := range result {
+		result[i].text = strings.Join(strings.Fields(result[i].text), " ")
+	}
+
+	return result
+}
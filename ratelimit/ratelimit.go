@@ -0,0 +1,168 @@
+// Package ratelimit implements token bucket rate limits and daily quotas
+// stored in Mongo so that they survive restarts and are shared by every
+// process.
+package ratelimit
+
+import (
+	"math"
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// maxConflicts is the number of times Allow retries when another process
+// updates the same bucket concurrently.
+const maxConflicts = 5
+
+type bucket struct {
+	Key       string `bson:"_id"`
+	Tokens    float64
+	UpdatedAt time.Time
+}
+
+// Limiter is a token bucket per key holding at most Burst tokens and
+// refilling at Rate tokens per second.
+type Limiter struct {
+	Buckets *mgo.Collection
+	Rate    float64
+	Burst   int
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+// NewLimiter returns a Limiter allowing perHour events per key on average,
+// with bursts of up to burst events.
+func NewLimiter(buckets *mgo.Collection, perHour int, burst int) *Limiter {
+	return &Limiter{
+		Buckets: buckets,
+		Rate:    float64(perHour) / time.Hour.Seconds(),
+		Burst:   burst,
+	}
+}
+
+func (l *Limiter) now() time.Time {
+	if l.Now != nil {
+		return l.Now()
+	}
+
+	// Mongo stores milliseconds, so keep comparisons exact
+	return time.Now().Truncate(time.Millisecond)
+}
+
+// Allow takes a token from key's bucket and reports whether one was
+// available.
+func (l *Limiter) Allow(key string) (bool, error) {
+	for i := 0; i < maxConflicts; i++ {
+		now := l.now()
+		b := bucket{}
+
+		err := l.Buckets.FindId(key).One(&b)
+
+		if err == mgo.ErrNotFound {
+			err = l.Buckets.Insert(bucket{Key: key, Tokens: float64(l.Burst) - 1, UpdatedAt: now})
+
+			if mgo.IsDup(err) {
+				continue
+			}
+
+			return err == nil && l.Burst >= 1, err
+		}
+
+		if err != nil {
+			return false, err
+		}
+
+		tokens := Refill(b.Tokens, now.Sub(b.UpdatedAt), l.Rate, l.Burst)
+
+		if tokens < 1 {
+			return false, nil
+		}
+
+		err = l.Buckets.Update(
+			bson.M{"_id": key, "updatedat": b.UpdatedAt},
+			bson.M{"$set": bson.M{"tokens": tokens - 1, "updatedat": now}},
+		)
+
+		if err == mgo.ErrNotFound {
+			continue
+		}
+
+		return err == nil, err
+	}
+
+	return false, nil
+}
+
+// Refill returns the tokens in a bucket elapsed after it held tokens.
+func Refill(tokens float64, elapsed time.Duration, rate float64, burst int) float64 {
+	if elapsed > 0 {
+		tokens += elapsed.Seconds() * rate
+	}
+
+	return math.Min(tokens, float64(burst))
+}
+
+type counter struct {
+	Key       string `bson:"_id"`
+	Used      int
+	ExpiresAt time.Time
+}
+
+// Quota limits the amount of something, such as synthesized characters,
+// each key may use per UTC day.
+type Quota struct {
+	Counters *mgo.Collection
+	Limit    int
+
+	// Now returns the current time. It defaults to time.Now.
+	Now func() time.Time
+}
+
+func (q *Quota) now() time.Time {
+	if q.Now != nil {
+		return q.Now().UTC()
+	}
+
+	return time.Now().UTC()
+}
+
+// EnsureIndexes lets Mongo expire old daily counters.
+func (q *Quota) EnsureIndexes() error {
+	return q.Counters.EnsureIndex(mgo.Index{Key: []string{"expiresat"}, ExpireAfter: time.Second})
+}
+
+// Consume adds n to key's usage for today and reports whether it stayed
+// within the limit. Usage that would exceed the limit is not recorded.
+func (q *Quota) Consume(key string, n int) (bool, error) {
+	if q.Limit <= 0 {
+		return true, nil
+	}
+
+	now := q.now()
+	id := key + ":" + now.Format("2006-01-02")
+	c := counter{}
+
+	_, err := q.Counters.Find(bson.M{"_id": id}).Apply(mgo.Change{
+		Update: bson.M{
+			"$inc": bson.M{"used": n},
+			"$set": bson.M{"expiresat": now.Truncate(24 * time.Hour).Add(48 * time.Hour)},
+		},
+		Upsert:    true,
+		ReturnNew: true,
+	}, &c)
+
+	if err != nil {
+		return false, err
+	}
+
+	if c.Used <= q.Limit {
+		return true, nil
+	}
+
+	// Give back what we could not use
+	err = q.Counters.UpdateId(id, bson.M{"$inc": bson.M{"used": -n}})
+
+	return false, err
+}
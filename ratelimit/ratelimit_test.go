@@ -0,0 +1,152 @@
+package ratelimit
+
+import (
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+func TestRefill(t *testing.T) {
+	tests := []struct {
+		tokens   float64
+		elapsed  time.Duration
+		rate     float64
+		burst    int
+		expected float64
+	}{
+		{0, 0, 1, 5, 0},
+		{0, 2 * time.Second, 1, 5, 2},
+		{4, 10 * time.Second, 1, 5, 5},
+		{1, time.Hour, 10.0 / 3600, 5, 5},
+		{0, 30 * time.Minute, 10.0 / 3600, 10, 5},
+		{3, -time.Second, 1, 5, 3},
+	}
+
+	for _, test := range tests {
+		tokens := Refill(test.tokens, test.elapsed, test.rate, test.burst)
+
+		if tokens < test.expected-1e-9 || tokens > test.expected+1e-9 {
+			t.Errorf("Refill(%v, %v, %v, %v) = %v, expected %v", test.tokens, test.elapsed, test.rate, test.burst, tokens, test.expected)
+		}
+	}
+}
+
+func TestNewLimiterRate(t *testing.T) {
+	l := NewLimiter(nil, 3600, 10)
+
+	if l.Rate != 1 || l.Burst != 10 {
+		t.Errorf("Unexpected limiter %+v", l)
+	}
+}
+
+// withTestDB returns a database for tests that need Mongo, which are
+// skipped unless MONGO_TEST_URL is set.
+func withTestDB(t *testing.T) (*mgo.Database, func()) {
+	url := os.Getenv("MONGO_TEST_URL")
+	if url == "" {
+		t.Skip("MONGO_TEST_URL not set")
+	}
+
+	session, err := mgo.DialWithTimeout(url, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := session.DB("")
+
+	return db, func() {
+		db.DropDatabase()
+		session.Close()
+	}
+}
+
+// clock is a fake time source that tests move forward by hand.
+type clock struct {
+	now time.Time
+}
+
+func (c *clock) Now() time.Time {
+	return c.now
+}
+
+func TestLimiterAllow(t *testing.T) {
+	db, done := withTestDB(t)
+	defer done()
+
+	tests := []struct {
+		after    time.Duration
+		expected bool
+	}{
+		// A full bucket allows a burst of 3
+		{0, true},
+		{0, true},
+		{0, true},
+		{0, false},
+		// One token refills every 10 minutes
+		{5 * time.Minute, false},
+		{5 * time.Minute, true},
+		{0, false},
+		// Refilling stops at the burst size
+		{24 * time.Hour, true},
+		{0, true},
+		{0, true},
+		{0, false},
+	}
+
+	c := &clock{now: time.Date(2014, 8, 12, 13, 30, 0, 0, time.UTC)}
+	l := NewLimiter(db.C("ratelimits"), 6, 3)
+	l.Now = c.Now
+
+	for i, test := range tests {
+		c.now = c.now.Add(test.after)
+
+		ok, err := l.Allow("phone:+15555555555")
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != test.expected {
+			t.Errorf("Request %d: expected %v, got %v", i, test.expected, ok)
+		}
+	}
+}
+
+func TestQuotaConsume(t *testing.T) {
+	db, done := withTestDB(t)
+	defer done()
+
+	tests := []struct {
+		at       time.Time
+		n        int
+		expected bool
+	}{
+		{time.Date(2014, 8, 12, 9, 0, 0, 0, time.UTC), 60, true},
+		{time.Date(2014, 8, 12, 12, 0, 0, 0, time.UTC), 40, true},
+		// Over the limit, and not counted against it
+		{time.Date(2014, 8, 12, 18, 0, 0, 0, time.UTC), 1, false},
+		{time.Date(2014, 8, 12, 23, 59, 0, 0, time.UTC), 1, false},
+		// A new UTC day starts from zero, even from another time zone
+		{time.Date(2014, 8, 13, 0, 0, 0, 0, time.UTC), 100, true},
+		{time.Date(2014, 8, 12, 21, 0, 0, 0, time.FixedZone("EDT", -4*3600)), 1, false},
+		{time.Date(2014, 8, 14, 0, 30, 0, 0, time.UTC), 101, false},
+		{time.Date(2014, 8, 14, 0, 30, 0, 0, time.UTC), 100, true},
+	}
+
+	var now time.Time
+	q := &Quota{Counters: db.C("quotas"), Limit: 100, Now: func() time.Time { return now }}
+
+	for i, test := range tests {
+		now = test.at
+
+		ok, err := q.Consume("phone:+15555555555", test.n)
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if ok != test.expected {
+			t.Errorf("Consume %d: expected %v, got %v", i, test.expected, ok)
+		}
+	}
+}
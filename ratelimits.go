@@ -0,0 +1,148 @@
+package main
+
+import (
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jpadilla/rttm/ratelimit"
+	"gopkg.in/mgo.v2"
+)
+
+var (
+	PhoneLimiter  *ratelimit.Limiter
+	APIKeyLimiter *ratelimit.Limiter
+	IPLimiter     *ratelimit.Limiter
+	PhoneQuota    *ratelimit.Quota
+	APIKeyQuota   *ratelimit.Quota
+)
+
+const rateLimitMessage = "Too many requests, please try again later."
+
+// ConfigureRateLimits sets up the limiters from the environment, e.g.
+// RATE_LIMIT_PHONE_PER_HOUR, RATE_LIMIT_PHONE_BURST and
+// QUOTA_PHONE_DAILY_CHARS.
+func ConfigureRateLimits(db *mgo.Database) error {
+	buckets := db.C("ratelimits")
+	counters := db.C("quotas")
+
+	PhoneLimiter = ratelimit.NewLimiter(buckets, envInt("RATE_LIMIT_PHONE_PER_HOUR", 10), envInt("RATE_LIMIT_PHONE_BURST", 5))
+	APIKeyLimiter = ratelimit.NewLimiter(buckets, envInt("RATE_LIMIT_APIKEY_PER_HOUR", 120), envInt("RATE_LIMIT_APIKEY_BURST", 20))
+	IPLimiter = ratelimit.NewLimiter(buckets, envInt("RATE_LIMIT_IP_PER_HOUR", 30), envInt("RATE_LIMIT_IP_BURST", 10))
+
+	PhoneQuota = &ratelimit.Quota{Counters: counters, Limit: envInt("QUOTA_PHONE_DAILY_CHARS", 200000)}
+	APIKeyQuota = &ratelimit.Quota{Counters: counters, Limit: envInt("QUOTA_APIKEY_DAILY_CHARS", 1000000)}
+
+	return PhoneQuota.EnsureIndexes()
+}
+
+// allow reports whether key is within limiter's rate. Limits fail open so
+// that a database hiccup does not take the site down.
+func allow(limiter *ratelimit.Limiter, kind string, key string) bool {
+	if limiter == nil {
+		return true
+	}
+
+	ok, err := limiter.Allow(kind + ":" + key)
+	if err != nil {
+		log.Println("Error checking rate limit", err)
+		return true
+	}
+
+	if !ok {
+		log.Printf("Rate limit exceeded for %s %s", kind, key)
+	}
+
+	return ok
+}
+
+// consume charges n characters against key's daily quota.
+func consume(quota *ratelimit.Quota, kind string, key string, n int) bool {
+	if quota == nil {
+		return true
+	}
+
+	ok, err := quota.Consume(kind+":"+key, n)
+	if err != nil {
+		log.Println("Error checking quota", err)
+		return true
+	}
+
+	if !ok {
+		log.Printf("Daily quota exceeded for %s %s", kind, key)
+	}
+
+	return ok
+}
+
+// RateLimitIP rejects requests from clients exceeding IPLimiter.
+func RateLimitIP(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if !allow(IPLimiter, "ip", ClientIP(r)) {
+			renderTooManyRequests(w, r)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+// RateLimitAPIKey rejects requests whose API key exceeds APIKeyLimiter. It
+// must wrap a handler already protected by RequireAPIKey.
+func RateLimitAPIKey(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if apiKey := RequestAPIKey(r); apiKey != nil && !allow(APIKeyLimiter, "apikey", apiKey.Id.Hex()) {
+			renderTooManyRequests(w, r)
+			return
+		}
+
+		h(w, r)
+	}
+}
+
+func renderTooManyRequests(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Retry-After", "3600")
+
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		renderJSONError(w, http.StatusTooManyRequests, rateLimitMessage)
+		return
+	}
+
+	http.Error(w, rateLimitMessage, http.StatusTooManyRequests)
+}
+
+// ClientIP returns the address of the client. Proxies append the address
+// they were connected from to X-Forwarded-For, so with TRUSTED_PROXY_DEPTH
+// proxies in front of us (1, the Heroku router, by default) the client is
+// that many entries from the right. Anything further left was sent by the
+// client and can't be trusted.
+func ClientIP(r *http.Request) string {
+	depth := envInt("TRUSTED_PROXY_DEPTH", 1)
+
+	if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" && depth > 0 {
+		entries := strings.Split(forwarded, ",")
+		if len(entries) >= depth {
+			return strings.TrimSpace(entries[len(entries)-depth])
+		}
+
+		return strings.TrimSpace(entries[0])
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+
+	return host
+}
+
+func envInt(name string, fallback int) int {
+	if n, err := strconv.Atoi(os.Getenv(name)); err == nil && n >= 0 {
+		return n
+	}
+
+	return fallback
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+)
+
+func TestClientIP(t *testing.T) {
+	defer os.Setenv("TRUSTED_PROXY_DEPTH", "")
+
+	tests := []struct {
+		depth     string
+		forwarded string
+		expected  string
+	}{
+		{"", "", "10.0.0.1"},
+		{"", "203.0.113.7", "203.0.113.7"},
+		// The client sent its own header, which the router appended to
+		{"", "1.2.3.4, 203.0.113.7", "203.0.113.7"},
+		{"2", "1.2.3.4, 203.0.113.7, 10.0.0.2", "203.0.113.7"},
+		{"2", "203.0.113.7", "203.0.113.7"},
+		{"0", "203.0.113.7", "10.0.0.1"},
+	}
+
+	for _, test := range tests {
+		os.Setenv("TRUSTED_PROXY_DEPTH", test.depth)
+
+		r, _ := http.NewRequest("GET", "/submit", nil)
+		r.RemoteAddr = "10.0.0.1:1234"
+		if test.forwarded != "" {
+			r.Header.Set("X-Forwarded-For", test.forwarded)
+		}
+
+		if ip := ClientIP(r); ip != test.expected {
+			t.Errorf("Depth %q, X-Forwarded-For %q: expected %s, got %s", test.depth, test.forwarded, test.expected, ip)
+		}
+	}
+}
+
+func TestRenderTooManyRequests(t *testing.T) {
+	r, _ := http.NewRequest("POST", "/api/rttm", nil)
+	w := httptest.NewRecorder()
+
+	renderTooManyRequests(w, r)
+
+	if w.Code != http.StatusTooManyRequests || w.Header().Get("Content-Type") != "application/json" {
+		t.Errorf("Expected JSON 429, got %d %s", w.Code, w.Header().Get("Content-Type"))
+	}
+}
@@ -0,0 +1,393 @@
+package readability
+
+import (
+	"math"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	// unlikelyCandidates are removed before scoring unless they also look
+	// like content.
+	unlikelyCandidates = regexp.MustCompile(`(?i)-ad-|\bads?\b|advert|agegate|banner|breadcrumb|byline|combx|comment|community|cookie|disqus|extra|footer|gdpr|header|legends|menu|\bmeta\b|modal|nav|newsletter|outbrain|pager|pagination|popup|promo|related|remark|replies|rss|share|shoutbox|sidebar|skyscraper|social|sponsor|subscribe|taboola|tags|tool|widget`)
+	maybeCandidates    = regexp.MustCompile(`(?i)and|article|body|column|content|main|shadow`)
+
+	positiveWeight = regexp.MustCompile(`(?i)article|body|content|entry|hentry|h-entry|main|page|post|story|text|blog`)
+	negativeWeight = regexp.MustCompile(`(?i)\bads?\b|banner|combx|comment|com-|contact|foot|footnote|masthead|media|meta|outbrain|promo|related|scroll|share|shoutbox|sidebar|skyscraper|sponsor|shopping|social|tags|tool|widget`)
+
+	// unlikelyRoles are ARIA landmarks that are never the article.
+	unlikelyRoles = map[string]bool{
+		"navigation": true, "complementary": true, "banner": true, "contentinfo": true,
+		"menu": true, "menubar": true, "dialog": true, "alertdialog": true, "search": true,
+	}
+)
+
+// inlineElements are kept within paragraphs; all other elements start a
+// new one.
+var inlineElements = map[string]bool{
+	"a": true, "abbr": true, "b": true, "bdi": true, "bdo": true, "big": true,
+	"cite": true, "code": true, "data": true, "del": true, "dfn": true,
+	"em": true, "font": true, "i": true, "img": true, "ins": true, "kbd": true,
+	"label": true, "mark": true, "q": true, "s": true, "samp": true,
+	"small": true, "span": true, "strike": true, "strong": true, "sub": true,
+	"sup": true, "time": true, "tt": true, "u": true, "var": true,
+}
+
+// prune removes elements that never hold the article, such as navigation,
+// comments, share buttons and ads.
+func prune(n *Node) {
+	children := n.Children[:0]
+
+	for _, c := range n.Children {
+		if c.Tag != "" && unlikely(c) {
+			continue
+		}
+
+		prune(c)
+		children = append(children, c)
+	}
+
+	n.Children = children
+}
+
+func unlikely(n *Node) bool {
+	if skippedElements[n.Tag] || unlikelyRoles[n.Attr("role")] {
+		return true
+	}
+
+	if _, hidden := n.Attrs["hidden"]; hidden || n.Attr("aria-hidden") == "true" {
+		return true
+	}
+
+	switch n.Tag {
+	case "html", "body", "article", "main", "a":
+		return false
+	}
+
+	match := n.Attr("class") + " " + n.Attr("id")
+
+	return unlikelyCandidates.MatchString(match) && !maybeCandidates.MatchString(match)
+}
+
+// classWeight scores an element by whether its class and id suggest content
+// or page furniture.
+func classWeight(n *Node) float64 {
+	weight := 0.0
+
+	for _, attr := range []string{n.Attr("class"), n.Attr("id")} {
+		if attr == "" {
+			continue
+		}
+
+		if negativeWeight.MatchString(attr) {
+			weight -= 25
+		}
+
+		if positiveWeight.MatchString(attr) {
+			weight += 25
+		}
+	}
+
+	return weight
+}
+
+// tagWeight is the starting score of a candidate by its tag.
+func tagWeight(n *Node) float64 {
+	switch n.Tag {
+	case "article", "main":
+		return 10
+	case "div", "section":
+		return 5
+	case "pre", "td", "blockquote":
+		return 3
+	case "address", "ol", "ul", "dl", "dd", "dt", "li", "form":
+		return -3
+	case "h1", "h2", "h3", "h4", "h5", "h6", "th":
+		return -5
+	}
+
+	return 0
+}
+
+// textStats summarizes the text under a node as InnerText would return it,
+// without building the string.
+type textStats struct {
+	length int  // of the collapsed text
+	words  bool // whether there is any text besides whitespace
+	lead   bool // starts with whitespace
+	trail  bool // ends with whitespace
+	space  bool // is only whitespace, and not empty
+	commas int
+}
+
+func textStatsOf(text string) textStats {
+	fields := strings.Fields(text)
+	if len(fields) == 0 {
+		return textStats{space: text != ""}
+	}
+
+	first, _ := utf8.DecodeRuneInString(text)
+	last, _ := utf8.DecodeLastRuneInString(text)
+
+	return textStats{
+		length: len(strings.Join(fields, " ")),
+		words:  true,
+		lead:   unicode.IsSpace(first),
+		trail:  unicode.IsSpace(last),
+		commas: strings.Count(text, ","),
+	}
+}
+
+// add returns the stats of a's text followed by b's.
+func (a textStats) add(b textStats) textStats {
+	switch {
+	case !a.words && !b.words:
+		return textStats{space: a.space || b.space}
+	case !a.words:
+		b.lead = b.lead || a.space
+		return b
+	case !b.words:
+		a.trail = a.trail || b.space
+		return a
+	}
+
+	sum := textStats{length: a.length + b.length, words: true, lead: a.lead, trail: b.trail, commas: a.commas + b.commas}
+	if a.trail || b.lead {
+		sum.length++
+	}
+
+	return sum
+}
+
+// nodeStats are what scoring needs to know about an element's subtree.
+type nodeStats struct {
+	text  textStats
+	links int  // length of the text inside links
+	block bool // has children that start their own paragraph
+}
+
+// measure computes the stats of every node under n in one pass, so scoring
+// doesn't walk the same subtrees over and over.
+func measure(n *Node) map[*Node]*nodeStats {
+	stats := map[*Node]*nodeStats{}
+
+	var walk func(*Node) *nodeStats
+	walk = func(n *Node) *nodeStats {
+		s := &nodeStats{}
+		stats[n] = s
+
+		if n.Tag == "" {
+			s.text = textStatsOf(n.Text)
+			return s
+		}
+
+		for _, c := range n.Children {
+			cs := walk(c)
+
+			if n.Tag != "script" && n.Tag != "style" {
+				s.text = s.text.add(cs.text)
+			}
+
+			s.links += cs.links
+			if c.Tag == "a" {
+				s.links += cs.text.length
+			}
+
+			if c.Tag != "" && (!inlineElements[c.Tag] || cs.block) {
+				s.block = true
+			}
+		}
+
+		if n.Tag == "script" || n.Tag == "style" {
+			s.text = textStats{}
+		} else if n.Tag == "br" || blockElements[n.Tag] {
+			s.text = s.text.add(textStats{space: true})
+		}
+
+		return s
+	}
+	walk(n)
+
+	return stats
+}
+
+// linkDensity is the share of n's text that is inside links.
+func linkDensity(s *nodeStats) float64 {
+	if s.text.length == 0 {
+		return 0
+	}
+
+	return float64(s.links) / float64(s.text.length)
+}
+
+// topCandidate scores the containers of every paragraph by the amount of
+// text they hold, with commas as a hint of prose, and returns the best one
+// after discounting link-heavy containers. It returns nil if n holds no
+// paragraphs of prose.
+func topCandidate(n *Node) *Node {
+	stats := measure(n)
+	scores := map[*Node]float64{}
+	var candidates []*Node
+
+	// Candidates and their siblings may lie just outside n
+	statsOf := func(c *Node) *nodeStats {
+		if _, ok := stats[c]; !ok {
+			for k, v := range measure(c) {
+				stats[k] = v
+			}
+		}
+		return stats[c]
+	}
+
+	addScore := func(c *Node, score float64) {
+		if c == nil || c.Tag == "" || c.Tag == "#document" {
+			return
+		}
+
+		if _, ok := scores[c]; !ok {
+			scores[c] = tagWeight(c) + classWeight(c)
+			candidates = append(candidates, c)
+		}
+
+		scores[c] += score
+	}
+
+	paragraphs := n.Find(func(c *Node) bool {
+		switch c.Tag {
+		case "p", "pre", "td", "blockquote":
+			return true
+		case "div", "section":
+			// Text laid out with <br>s instead of <p>s
+			return !stats[c].block
+		}
+		return false
+	})
+
+	for _, p := range paragraphs {
+		text := stats[p].text
+		if text.length < 25 {
+			continue
+		}
+
+		score := 1 + float64(text.commas) + math.Min(float64(text.length/100), 3)
+
+		addScore(p.Parent, score)
+		if p.Parent != nil {
+			addScore(p.Parent.Parent, score/2)
+		}
+	}
+
+	var top *Node
+	topScore := 0.0
+
+	for _, c := range candidates {
+		scores[c] *= 1 - linkDensity(statsOf(c))
+
+		if top == nil || scores[c] > topScore {
+			top, topScore = c, scores[c]
+		}
+	}
+
+	if top == nil {
+		return nil
+	}
+
+	// Siblings that score well enough, or read like prose, belong to the
+	// article too, e.g. when a page splits it across several divs.
+	threshold := math.Max(10, topScore*0.2)
+	article := &Node{Tag: "div"}
+
+	if top.Parent == nil {
+		article.Children = []*Node{top}
+		return article
+	}
+
+	for _, sibling := range top.Parent.Children {
+		include := sibling == top
+
+		if score, ok := scores[sibling]; ok && score >= threshold {
+			include = true
+		}
+
+		if sibling.Tag == "p" {
+			text := sibling.InnerText()
+			density := linkDensity(statsOf(sibling))
+
+			if len(text) > 80 && density < 0.25 {
+				include = true
+			} else if len(text) > 0 && density == 0 && strings.ContainsAny(text[len(text)-1:], ".!?") {
+				include = true
+			}
+		}
+
+		if include {
+			article.Children = append(article.Children, sibling)
+		}
+	}
+
+	return article
+}
+
+// paragraphs joins the text of n's paragraphs with blank lines. Runs of
+// text and inline elements form a paragraph, as do headings and list items,
+// while link-heavy lists such as "related articles" and the title, which
+// is read separately, are dropped.
+func paragraphs(n *Node, title string) string {
+	stats := measure(n)
+	var texts []string
+	var run []*Node
+
+	flush := func() {
+		if text := (&Node{Tag: "#run", Children: run}).InnerText(); text != "" && !strings.EqualFold(text, title) {
+			texts = append(texts, text)
+		}
+		run = nil
+	}
+
+	var walk func(*Node)
+	walk = func(n *Node) {
+		for _, c := range n.Children {
+			switch {
+			case c.Tag == "":
+				run = append(run, c)
+			case skippedElements[c.Tag]:
+			case c.Tag == "br":
+				// Two <br>s in a row separate paragraphs
+				if endsWithBreak(run) {
+					flush()
+				} else {
+					run = append(run, c)
+				}
+			case inlineElements[c.Tag] && !stats[c].block:
+				run = append(run, c)
+			case (c.Tag == "ul" || c.Tag == "ol") && linkDensity(stats[c]) > 0.5:
+				flush()
+			default:
+				flush()
+				walk(c)
+				flush()
+			}
+		}
+	}
+	walk(n)
+	flush()
+
+	return strings.Join(texts, "\n\n")
+}
+
+// endsWithBreak reports whether run ends in a <br>, ignoring whitespace.
+func endsWithBreak(run []*Node) bool {
+	for i := len(run) - 1; i >= 0; i-- {
+		if run[i].Tag == "br" {
+			return true
+		}
+
+		if run[i].Tag != "" || strings.TrimSpace(run[i].Text) != "" {
+			return false
+		}
+	}
+
+	return false
+}
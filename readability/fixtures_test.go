@@ -0,0 +1,149 @@
+package readability
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+// fixtures are saved pages in testdata with the article expected from each.
+// Text is checked for its first paragraph and for phrases that must or must
+// not be read out.
+var fixtures = []struct {
+	file     string
+	url      string
+	expected Article
+	first    string
+	contains []string
+	excludes []string
+}{
+	{
+		file: "news-jsonld.html",
+		url:  "https://news.example.com/2014/08/city-council-bike-lanes?utm_source=twitter",
+		expected: Article{
+			URL:         "https://news.example.com/2014/08/city-council-bike-lanes",
+			Title:       "City council approves 40 miles of new bike lanes",
+			Description: "The plan adds 40 miles of protected lanes by 2016, the largest expansion in the city's history.",
+			Authors:     []string{"Maria Lopez", "Tom Baker"},
+			Published:   time.Date(2014, 8, 12, 13, 30, 0, 0, time.UTC),
+			ImageURL:    "https://cdn.example.com/photos/bike-lanes-large.jpg",
+			FaviconURL:  "https://news.example.com/static/favicon-32.png",
+			SiteName:    "The Daily Example",
+			Language:    "en-US",
+		},
+		first:    "The city council voted 7-2 on Tuesday",
+		contains: []string{"city’s history", "“This is about safety, first and foremost,”", "begin in October."},
+		excludes: []string{"Advertisement", "Share on Facebook", "Comments", "parking? Nobody", "Most read", "Heat wave", "cookies", "Bike share comes", "Photo: Staff", "Subscribe now", "All rights reserved"},
+	},
+	{
+		file: "blog-opengraph.html",
+		url:  "https://garage.example.org/2014/03/standing-desk/",
+		expected: Article{
+			URL:         "https://garage.example.org/2014/03/standing-desk/",
+			Title:       "Why I switched to a standing desk",
+			Description: "Six months in, here's what changed.",
+			Authors:     []string{"Sam Carter"},
+			Published:   time.Date(2014, 3, 5, 18, 4, 11, 0, time.UTC),
+			ImageURL:    "https://garage.example.org/wp-content/uploads/desk.jpg",
+			FaviconURL:  "https://garage.example.org/wp-content/uploads/icon.ico",
+			SiteName:    "Notes from the Garage",
+			Language:    "en",
+		},
+		first:    "Six months ago I built a standing desk",
+		contains: []string{"What changed", "I take more breaks", "Not a chance."},
+		excludes: []string{"Posted on", "Share this", "Building a workbench", "thoughts on", "gave up after a week", "Recent Posts", "WordPress", "Archive"},
+	},
+	{
+		file: "graph-jsonld.html",
+		url:  "https://kueche.example.de/sauerteig/",
+		expected: Article{
+			URL:         "https://kueche.example.de/sauerteig/",
+			Title:       "Brot backen mit Sauerteig",
+			Description: "Ein Einstieg in das Backen mit Sauerteig.",
+			Authors:     []string{"Lena Schmidt"},
+			Published:   time.Date(2019, 11, 2, 7, 15, 0, 0, time.UTC),
+			ImageURL:    "https://kueche.example.de/img/brot.jpg",
+			FaviconURL:  "https://kueche.example.de/favicon.ico",
+			SiteName:    "Küchenwerkstatt",
+			Language:    "de-DE",
+		},
+		first:    "Sauerteig ist nichts anderes als Mehl und Wasser",
+		contains: []string{"Roggenmehl", "bereit für das erste Brot."},
+		excludes: []string{"Zum Inhalt", "Rezepte", "Newsletter", "Impressum"},
+	},
+	{
+		file: "legacy-table.html",
+		url:  "http://www.example.co.uk/~rjw/castiron.html",
+		expected: Article{
+			URL:         "http://www.example.co.uk/~rjw/castiron.html",
+			Title:       "On the Care of Cast Iron Pans",
+			Description: "A short guide to seasoning and cleaning cast iron.",
+			Authors:     []string{"R. J. Whitfield"},
+			Published:   time.Date(2003, 6, 21, 0, 0, 0, 0, time.UTC),
+			FaviconURL:  "http://www.example.co.uk/favicon.ico",
+			Language:    "en-GB",
+		},
+		first:    "A well seasoned cast iron pan will outlast its owner",
+		contains: []string{"Repeat this three or four times.", "rust will set in within a day."},
+		excludes: []string{"Guestbook", "Recipes", "visited"},
+	},
+	{
+		file: "div-soup.html",
+		url:  "https://science.example.net/tides",
+		expected: Article{
+			URL:         "https://science.example.net/tides",
+			Title:       "Why are there two high tides a day?",
+			Description: "The moon, the sun and a bulge on the far side of the Earth.",
+			Published:   time.Date(2021, 2, 14, 10, 0, 0, 0, time.UTC),
+			ImageURL:    "https://static.example.net/tides.png",
+			FaviconURL:  "https://science.example.net/apple-touch-icon.png",
+			SiteName:    "Science Explained",
+		},
+		first:    "Most coasts see two high tides",
+		contains: []string{"leaving a second bulge there.", "spring tides."},
+		excludes: []string{"Updated", "Topics", "free for thirty days", "Share this article"},
+	},
+}
+
+func TestFixtures(t *testing.T) {
+	for _, fixture := range fixtures {
+		f, err := os.Open(filepath.Join("testdata", fixture.file))
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		article, err := Extract(f, fixture.url)
+		f.Close()
+
+		if err != nil {
+			t.Errorf("%s: %v", fixture.file, err)
+			continue
+		}
+
+		text := article.Text
+		article.Text = ""
+
+		if !reflect.DeepEqual(*article, fixture.expected) {
+			t.Errorf("%s: expected\n%+v\ngot\n%+v", fixture.file, fixture.expected, *article)
+		}
+
+		if !strings.HasPrefix(text, fixture.first) {
+			t.Errorf("%s: expected text to start with %q, got %q", fixture.file, fixture.first, text)
+		}
+
+		for _, phrase := range fixture.contains {
+			if !strings.Contains(text, phrase) {
+				t.Errorf("%s: expected text to contain %q", fixture.file, phrase)
+			}
+		}
+
+		for _, phrase := range fixture.excludes {
+			if strings.Contains(text, phrase) {
+				t.Errorf("%s: expected text not to contain %q", fixture.file, phrase)
+			}
+		}
+	}
+}
@@ -0,0 +1,375 @@
+package readability
+
+import (
+	"html"
+	"io"
+	"io/ioutil"
+	"strings"
+)
+
+// Node is an element or text node of a parsed HTML document. Text nodes have
+// an empty Tag.
+type Node struct {
+	Tag      string
+	Attrs    map[string]string
+	Text     string
+	Parent   *Node
+	Children []*Node
+}
+
+var voidElements = map[string]bool{
+	"area": true, "base": true, "br": true, "col": true, "embed": true,
+	"hr": true, "img": true, "input": true, "link": true, "meta": true,
+	"param": true, "source": true, "track": true, "wbr": true,
+}
+
+// rawTextElements hold text that is not parsed for tags.
+var rawTextElements = map[string]bool{
+	"script": true, "style": true, "textarea": true, "title": true,
+	"noscript": true, "iframe": true,
+}
+
+// closedBy lists the open elements a start tag implicitly closes, as in
+// <p>one<p>two or <li>one<li>two.
+var closedBy = map[string][]string{
+	"p":  {"p"},
+	"li": {"li"},
+	"dt": {"dt", "dd"},
+	"dd": {"dt", "dd"},
+	"tr": {"tr", "td", "th"},
+	"td": {"td", "th"},
+	"th": {"td", "th"},
+}
+
+var blockElements = map[string]bool{
+	"address": true, "article": true, "aside": true, "blockquote": true,
+	"div": true, "dl": true, "fieldset": true, "figure": true, "footer": true,
+	"form": true, "h1": true, "h2": true, "h3": true, "h4": true, "h5": true,
+	"h6": true, "header": true, "hr": true, "main": true, "nav": true,
+	"ol": true, "pre": true, "section": true, "table": true, "ul": true,
+}
+
+// Parse reads an HTML document into a tree. It is forgiving in the way
+// browsers are: unclosed and stray tags don't fail the parse.
+func Parse(r io.Reader) (*Node, error) {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	root := &Node{Tag: "#document"}
+	p := &parser{src: string(b), current: root}
+	p.parse()
+
+	return root, nil
+}
+
+// maxDepth caps how deeply elements nest. Deeper start tags are kept as
+// empty elements and their contents go to the innermost open element, so
+// pathological pages can't make parsing and scoring slow.
+const maxDepth = 256
+
+type parser struct {
+	src     string
+	pos     int
+	current *Node
+	depth   int
+}
+
+func (p *parser) parse() {
+	for p.pos < len(p.src) {
+		lt := strings.IndexByte(p.src[p.pos:], '<')
+		if lt < 0 {
+			p.text(p.src[p.pos:])
+			return
+		}
+
+		p.text(p.src[p.pos : p.pos+lt])
+		p.pos += lt
+
+		rest := p.src[p.pos:]
+
+		switch {
+		case strings.HasPrefix(rest, "<!--"):
+			p.skipPast("-->")
+		case strings.HasPrefix(rest, "<!") || strings.HasPrefix(rest, "<?"):
+			p.skipPast(">")
+		case strings.HasPrefix(rest, "</"):
+			p.endTag()
+		case len(rest) > 1 && isLetter(rest[1]):
+			p.startTag()
+		default:
+			p.text("<")
+			p.pos++
+		}
+	}
+}
+
+func (p *parser) skipPast(marker string) {
+	end := strings.Index(p.src[p.pos:], marker)
+	if end < 0 {
+		p.pos = len(p.src)
+		return
+	}
+
+	p.pos += end + len(marker)
+}
+
+func (p *parser) text(s string) {
+	if s == "" {
+		return
+	}
+
+	p.current.Children = append(p.current.Children, &Node{Text: html.UnescapeString(s), Parent: p.current})
+}
+
+func (p *parser) endTag() {
+	end := strings.IndexByte(p.src[p.pos:], '>')
+	if end < 0 {
+		p.pos = len(p.src)
+		return
+	}
+
+	name := strings.ToLower(strings.TrimSpace(p.src[p.pos+2 : p.pos+end]))
+	p.pos += end + 1
+
+	// Close the nearest matching element, ignoring stray end tags
+	depth := p.depth
+	for n := p.current; n.Parent != nil; n = n.Parent {
+		depth--
+		if n.Tag == name {
+			p.current, p.depth = n.Parent, depth
+			return
+		}
+	}
+}
+
+func (p *parser) startTag() {
+	i := p.pos + 1
+	for i < len(p.src) && !isSpace(p.src[i]) && p.src[i] != '>' && p.src[i] != '/' {
+		i++
+	}
+
+	name := strings.ToLower(p.src[p.pos+1 : i])
+	attrs, end, selfClosing := parseAttrs(p.src, i)
+	p.pos = end
+
+	p.implicitlyClose(name)
+
+	n := &Node{Tag: name, Attrs: attrs, Parent: p.current}
+	p.current.Children = append(p.current.Children, n)
+
+	if voidElements[name] || selfClosing {
+		return
+	}
+
+	if rawTextElements[name] {
+		closing := indexEndTag(p.src[p.pos:], name)
+
+		text := p.src[p.pos : p.pos+closing]
+		if name == "title" || name == "textarea" {
+			text = html.UnescapeString(text)
+		}
+
+		if text != "" {
+			n.Children = append(n.Children, &Node{Text: text, Parent: n})
+		}
+
+		p.pos += closing
+		p.skipPast(">")
+		return
+	}
+
+	if p.depth < maxDepth {
+		p.current = n
+		p.depth++
+	}
+}
+
+// indexEndTag returns the position of the end tag of name in s, in any case,
+// or len(s) if there is none.
+func indexEndTag(s string, name string) int {
+	for i := 0; ; {
+		j := strings.Index(s[i:], "</")
+		if j < 0 {
+			return len(s)
+		}
+
+		i += j
+		if end := i + 2 + len(name); end <= len(s) && strings.EqualFold(s[i+2:end], name) {
+			return i
+		}
+
+		i += 2
+	}
+}
+
+// implicitlyClose ends the open elements a start tag of name cannot be
+// nested in.
+func (p *parser) implicitlyClose(name string) {
+	closes := closedBy[name]
+	if blockElements[name] {
+		closes = []string{"p"}
+	}
+
+	var match *Node
+	depth, matchDepth := p.depth, 0
+
+	for n := p.current; n.Parent != nil; n = n.Parent {
+		depth--
+		for _, tag := range closes {
+			if n.Tag == tag {
+				match, matchDepth = n, depth
+			}
+		}
+
+		// Lists, tables and blocks are a new scope for their contents
+		if n.Tag == "li" || blockElements[n.Tag] {
+			break
+		}
+	}
+
+	if match != nil {
+		p.current, p.depth = match.Parent, matchDepth
+	}
+}
+
+// parseAttrs reads the attributes of a tag starting at i, returning the
+// position after the tag and whether it ended in />.
+func parseAttrs(src string, i int) (map[string]string, int, bool) {
+	attrs := map[string]string{}
+
+	for i < len(src) {
+		for i < len(src) && isSpace(src[i]) {
+			i++
+		}
+
+		if i >= len(src) {
+			break
+		}
+
+		if src[i] == '>' {
+			return attrs, i + 1, false
+		}
+
+		if strings.HasPrefix(src[i:], "/>") {
+			return attrs, i + 2, true
+		}
+
+		if src[i] == '/' {
+			i++
+			continue
+		}
+
+		start := i
+		for i < len(src) && !isSpace(src[i]) && src[i] != '=' && src[i] != '>' && !strings.HasPrefix(src[i:], "/>") {
+			i++
+		}
+		name := strings.ToLower(src[start:i])
+
+		for i < len(src) && isSpace(src[i]) {
+			i++
+		}
+
+		value := ""
+		if i < len(src) && src[i] == '=' {
+			i++
+			for i < len(src) && isSpace(src[i]) {
+				i++
+			}
+
+			if i < len(src) && (src[i] == '"' || src[i] == '\'') {
+				quote := src[i]
+				end := strings.IndexByte(src[i+1:], quote)
+				if end < 0 {
+					end = len(src) - i - 1
+				}
+
+				value = src[i+1 : i+1+end]
+				i += end + 2
+			} else {
+				start := i
+				for i < len(src) && !isSpace(src[i]) && src[i] != '>' {
+					i++
+				}
+				value = src[start:i]
+			}
+		}
+
+		if _, ok := attrs[name]; !ok && name != "" {
+			attrs[name] = html.UnescapeString(value)
+		}
+	}
+
+	return attrs, len(src), false
+}
+
+func isLetter(c byte) bool {
+	return c >= 'a' && c <= 'z' || c >= 'A' && c <= 'Z'
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// Attr returns the value of the attribute name, or "".
+func (n *Node) Attr(name string) string {
+	return n.Attrs[name]
+}
+
+// Find returns the elements under n, in document order, for which match
+// returns true.
+func (n *Node) Find(match func(*Node) bool) []*Node {
+	var found []*Node
+
+	var walk func(*Node)
+	walk = func(n *Node) {
+		for _, c := range n.Children {
+			if c.Tag != "" && match(c) {
+				found = append(found, c)
+			}
+			walk(c)
+		}
+	}
+	walk(n)
+
+	return found
+}
+
+// First returns the first element under n named tag, or nil.
+func (n *Node) First(tag string) *Node {
+	found := n.Find(func(c *Node) bool { return c.Tag == tag })
+	if len(found) == 0 {
+		return nil
+	}
+
+	return found[0]
+}
+
+// InnerText returns the text under n with whitespace collapsed.
+func (n *Node) InnerText() string {
+	var parts []string
+
+	var walk func(*Node)
+	walk = func(n *Node) {
+		if n.Tag == "" {
+			parts = append(parts, n.Text)
+			return
+		}
+
+		if n.Tag == "script" || n.Tag == "style" {
+			return
+		}
+
+		for _, c := range n.Children {
+			walk(c)
+		}
+
+		if n.Tag == "br" || blockElements[n.Tag] {
+			parts = append(parts, " ")
+		}
+	}
+	walk(n)
+
+	return strings.Join(strings.Fields(strings.Join(parts, "")), " ")
+}
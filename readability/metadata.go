@@ -0,0 +1,407 @@
+package readability
+
+import (
+	"encoding/json"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// metadata holds the values each source in a page gives for an article,
+// so the most reliable one can be picked per field.
+type metadata struct {
+	title, description, image, siteName, url, language, published string
+	authors                                                       []string
+}
+
+// readMetadata fills in article from JSON-LD, then OpenGraph and Twitter
+// cards, then plain meta tags and finally the document itself.
+func readMetadata(doc *Node, article *Article) {
+	ld := jsonLD(doc)
+	og, meta := metaTags(doc)
+
+	var title, h1 string
+	if n := doc.First("title"); n != nil {
+		title = n.InnerText()
+	}
+	if n := doc.First("h1"); n != nil {
+		h1 = n.InnerText()
+	}
+
+	var lang string
+	if n := doc.First("html"); n != nil {
+		lang = n.Attr("lang")
+	}
+
+	article.SiteName = first(og.siteName, ld.siteName, meta.siteName)
+	article.Title = first(ld.title, og.title, meta.title, cleanTitle(title, article.SiteName), h1)
+	article.Description = first(ld.description, og.description, meta.description)
+	article.Authors = ld.authors
+	if len(article.Authors) == 0 {
+		article.Authors = og.authors
+	}
+	if len(article.Authors) == 0 {
+		article.Authors = meta.authors
+	}
+	if len(article.Authors) == 0 {
+		article.Authors = byline(doc)
+	}
+
+	article.ImageURL = resolve(article.URL, first(ld.image, og.image, meta.image))
+	article.Language = first(ld.language, lang, og.language, meta.language)
+	article.Published = parseTime(first(ld.published, og.published, meta.published, timeElement(doc)))
+	article.FaviconURL = favicon(doc, article.URL)
+
+	if canonical := first(canonicalLink(doc), og.url, ld.url); canonical != "" {
+		article.URL = resolve(article.URL, canonical)
+	}
+}
+
+// jsonLD reads the first article described by schema.org JSON-LD.
+func jsonLD(doc *Node) metadata {
+	var m metadata
+	var nodes []map[string]interface{}
+
+	scripts := doc.Find(func(n *Node) bool {
+		return n.Tag == "script" && strings.Contains(strings.ToLower(n.Attr("type")), "ld+json")
+	})
+
+	for _, script := range scripts {
+		var v interface{}
+		if err := json.Unmarshal([]byte(rawText(script)), &v); err != nil {
+			continue
+		}
+
+		nodes = append(nodes, flattenLD(v)...)
+	}
+
+	// Objects may refer to others in the @graph by @id
+	byId := map[string]map[string]interface{}{}
+	for _, node := range nodes {
+		if id, ok := node["@id"].(string); ok {
+			byId[id] = node
+		}
+	}
+
+	deref := func(v interface{}) interface{} {
+		if obj, ok := v.(map[string]interface{}); ok {
+			if id, ok := obj["@id"].(string); ok && len(obj) == 1 && byId[id] != nil {
+				return byId[id]
+			}
+		}
+		return v
+	}
+
+	for _, node := range nodes {
+		if hasType(node, "WebSite") && m.siteName == "" {
+			m.siteName = ldString(node["name"])
+		}
+	}
+
+	for _, node := range nodes {
+		if !isArticleType(node) {
+			continue
+		}
+
+		m.title = first(ldString(node["headline"]), ldString(node["name"]))
+		m.description = ldString(node["description"])
+		m.published = ldString(node["datePublished"])
+		m.language = ldString(node["inLanguage"])
+		m.url = ldString(node["url"])
+		m.image = ldURL(deref(node["image"]))
+
+		for _, author := range ldList(node["author"]) {
+			if name := ldName(deref(author)); name != "" {
+				m.authors = append(m.authors, name)
+			}
+		}
+
+		if publisher := ldName(deref(node["publisher"])); publisher != "" {
+			m.siteName = publisher
+		}
+
+		break
+	}
+
+	return m
+}
+
+// flattenLD lists the objects in a JSON-LD document, including those in
+// arrays and @graph.
+func flattenLD(v interface{}) []map[string]interface{} {
+	var nodes []map[string]interface{}
+
+	switch v := v.(type) {
+	case []interface{}:
+		for _, item := range v {
+			nodes = append(nodes, flattenLD(item)...)
+		}
+	case map[string]interface{}:
+		nodes = append(nodes, v)
+		if graph, ok := v["@graph"]; ok {
+			nodes = append(nodes, flattenLD(graph)...)
+		}
+	}
+
+	return nodes
+}
+
+func hasType(node map[string]interface{}, name string) bool {
+	for _, t := range ldList(node["@type"]) {
+		if s, ok := t.(string); ok && s == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// isArticleType matches Article, NewsArticle, BlogPosting and the like.
+func isArticleType(node map[string]interface{}) bool {
+	for _, t := range ldList(node["@type"]) {
+		if s, ok := t.(string); ok && (strings.HasSuffix(s, "Article") || strings.HasSuffix(s, "Posting")) {
+			return true
+		}
+	}
+
+	return false
+}
+
+func ldList(v interface{}) []interface{} {
+	if list, ok := v.([]interface{}); ok {
+		return list
+	}
+
+	if v == nil {
+		return nil
+	}
+
+	return []interface{}{v}
+}
+
+func ldString(v interface{}) string {
+	switch v := v.(type) {
+	case string:
+		return strings.TrimSpace(v)
+	case []interface{}:
+		if len(v) > 0 {
+			return ldString(v[0])
+		}
+	}
+
+	return ""
+}
+
+// ldName returns a person or organization's name, which may be given as
+// plain text.
+func ldName(v interface{}) string {
+	if obj, ok := v.(map[string]interface{}); ok {
+		return ldString(obj["name"])
+	}
+
+	return ldString(v)
+}
+
+// ldURL returns an image's URL, which may be given as plain text, an
+// ImageObject or a list of either.
+func ldURL(v interface{}) string {
+	switch v := v.(type) {
+	case map[string]interface{}:
+		return first(ldString(v["url"]), ldString(v["contentUrl"]))
+	case []interface{}:
+		if len(v) > 0 {
+			return ldURL(v[0])
+		}
+	}
+
+	return ldString(v)
+}
+
+// metaTags reads OpenGraph and article: properties, and separately Twitter
+// cards and named meta tags.
+func metaTags(doc *Node) (og metadata, meta metadata) {
+	for _, n := range doc.Find(func(n *Node) bool { return n.Tag == "meta" }) {
+		content := strings.TrimSpace(n.Attr("content"))
+		if content == "" {
+			continue
+		}
+
+		switch strings.ToLower(n.Attr("property")) {
+		case "og:title":
+			og.title = content
+		case "og:description":
+			og.description = content
+		case "og:image", "og:image:url", "og:image:secure_url":
+			if og.image == "" {
+				og.image = content
+			}
+		case "og:site_name":
+			og.siteName = content
+		case "og:url":
+			og.url = content
+		case "og:locale":
+			og.language = strings.Replace(content, "_", "-", -1)
+		case "article:published_time":
+			og.published = content
+		case "article:author":
+			// Often a profile URL rather than a name
+			if !strings.Contains(content, "://") {
+				og.authors = append(og.authors, content)
+			}
+		}
+
+		switch strings.ToLower(first(n.Attr("name"), n.Attr("itemprop"), n.Attr("http-equiv"))) {
+		case "twitter:title":
+			meta.title = first(meta.title, content)
+		case "description", "twitter:description":
+			meta.description = first(meta.description, content)
+		case "twitter:image", "twitter:image:src", "thumbnail":
+			meta.image = first(meta.image, content)
+		case "application-name", "apple-mobile-web-app-title":
+			meta.siteName = first(meta.siteName, content)
+		case "author", "byl", "sailthru.author":
+			if len(meta.authors) == 0 {
+				meta.authors = []string{strings.TrimPrefix(content, "By ")}
+			}
+		case "date", "pubdate", "publishdate", "datepublished", "dc.date", "dc.date.issued", "sailthru.date", "parsely-pub-date":
+			meta.published = first(meta.published, content)
+		case "content-language", "language", "dc.language":
+			meta.language = first(meta.language, content)
+		}
+	}
+
+	return og, meta
+}
+
+var bylineClass = regexp.MustCompile(`(?i)\b(byline|author)\b`)
+
+// byline finds the author named in the page itself, e.g.
+// <span class="byline">By Jane Doe</span> or <a rel="author">.
+func byline(doc *Node) []string {
+	matches := doc.Find(func(n *Node) bool {
+		return n.Attr("rel") == "author" || n.Attr("itemprop") == "author" || bylineClass.MatchString(n.Attr("class"))
+	})
+
+	for _, n := range matches {
+		text := n.InnerText()
+		text = strings.TrimSpace(strings.TrimPrefix(strings.TrimPrefix(text, "By "), "by "))
+
+		if text != "" && len(text) < 100 {
+			return []string{text}
+		}
+	}
+
+	return nil
+}
+
+// timeElement returns the first <time datetime> in the page.
+func timeElement(doc *Node) string {
+	for _, n := range doc.Find(func(n *Node) bool { return n.Tag == "time" }) {
+		if datetime := n.Attr("datetime"); datetime != "" {
+			return datetime
+		}
+	}
+
+	return ""
+}
+
+func canonicalLink(doc *Node) string {
+	for _, n := range doc.Find(func(n *Node) bool { return n.Tag == "link" }) {
+		if strings.ToLower(n.Attr("rel")) == "canonical" {
+			return n.Attr("href")
+		}
+	}
+
+	return ""
+}
+
+// favicon returns the page's icon, preferring rel="icon" to Apple touch
+// icons and falling back to /favicon.ico.
+func favicon(doc *Node, pageURL string) string {
+	var touch string
+
+	for _, n := range doc.Find(func(n *Node) bool { return n.Tag == "link" && n.Attr("href") != "" }) {
+		rel := strings.Fields(strings.ToLower(n.Attr("rel")))
+
+		for _, r := range rel {
+			if r == "icon" {
+				return resolve(pageURL, n.Attr("href"))
+			}
+
+			if strings.HasPrefix(r, "apple-touch-icon") && touch == "" {
+				touch = n.Attr("href")
+			}
+		}
+	}
+
+	if touch != "" {
+		return resolve(pageURL, touch)
+	}
+
+	return resolve(pageURL, "/favicon.ico")
+}
+
+// cleanTitle strips the site name from titles like "Article | Site".
+func cleanTitle(title string, siteName string) string {
+	for _, separator := range []string{" | ", " - ", " — ", " – ", " :: ", " » "} {
+		i := strings.LastIndex(title, separator)
+		if i < 0 {
+			continue
+		}
+
+		suffix := strings.TrimSpace(title[i+len(separator):])
+		if siteName == "" || strings.EqualFold(suffix, siteName) {
+			return strings.TrimSpace(title[:i])
+		}
+	}
+
+	return title
+}
+
+var timeLayouts = []string{
+	time.RFC3339,
+	"2006-01-02T15:04:05Z0700",
+	"2006-01-02T15:04:05",
+	"2006-01-02T15:04Z07:00",
+	"2006-01-02 15:04:05",
+	"2006-01-02",
+	time.RFC1123Z,
+	time.RFC1123,
+	"January 2, 2006",
+	"Jan 2, 2006",
+}
+
+// parseTime reads the publication dates found in pages, returning the zero
+// time if none of the usual layouts match.
+func parseTime(s string) time.Time {
+	s = strings.TrimSpace(s)
+
+	for _, layout := range timeLayouts {
+		if t, err := time.Parse(layout, s); err == nil {
+			return t.UTC()
+		}
+	}
+
+	return time.Time{}
+}
+
+// rawText returns the unparsed contents of an element like <script>.
+func rawText(n *Node) string {
+	var text string
+	for _, c := range n.Children {
+		text += c.Text
+	}
+
+	return text
+}
+
+// first returns the first non-empty value.
+func first(values ...string) string {
+	for _, v := range values {
+		if v = strings.TrimSpace(v); v != "" {
+			return v
+		}
+	}
+
+	return ""
+}
@@ -0,0 +1,92 @@
+// Package readability finds the article in a web page and turns it into
+// plain text to be read aloud, without calling out to any service.
+package readability
+
+import (
+	"io"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// Article is the content found in a page.
+type Article struct {
+	URL         string
+	Title       string
+	Description string
+	Authors     []string
+	Published   time.Time
+	ImageURL    string
+	FaviconURL  string
+	SiteName    string
+	Language    string
+	Text        string
+}
+
+// skippedElements never contain article text.
+var skippedElements = map[string]bool{
+	"head": true, "script": true, "style": true, "noscript": true,
+	"template": true, "nav": true, "header": true, "footer": true,
+	"aside": true, "iframe": true, "textarea": true, "button": true,
+	"select": true, "input": true, "figure": true, "figcaption": true,
+	"svg": true, "canvas": true, "video": true, "audio": true,
+	"object": true, "embed": true, "dialog": true, "menu": true,
+}
+
+// Extract parses the page at pageURL read from r. The article text is the
+// content of the page's best scoring container, and its metadata comes from
+// JSON-LD, OpenGraph and meta tags.
+func Extract(r io.Reader, pageURL string) (*Article, error) {
+	doc, err := Parse(r)
+	if err != nil {
+		return nil, err
+	}
+
+	article := &Article{URL: pageURL}
+	readMetadata(doc, article)
+
+	body := doc.First("body")
+	if body == nil {
+		body = doc
+	}
+
+	prune(body)
+
+	content := topCandidate(body)
+	if content == nil {
+		content = body
+	}
+
+	article.Text = paragraphs(content, article.Title)
+
+	return article, nil
+}
+
+// Text returns the paragraphs of an HTML fragment as plain text.
+func Text(fragment string) string {
+	doc, err := Parse(strings.NewReader(fragment))
+	if err != nil {
+		return ""
+	}
+
+	return paragraphs(doc, "")
+}
+
+// resolve makes ref absolute against base.
+func resolve(base string, ref string) string {
+	if ref == "" {
+		return ""
+	}
+
+	b, err := url.Parse(base)
+	if err != nil {
+		return ref
+	}
+
+	r, err := url.Parse(ref)
+	if err != nil {
+		return ref
+	}
+
+	return b.ResolveReference(r).String()
+}
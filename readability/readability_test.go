@@ -0,0 +1,163 @@
+package readability
+
+import (
+	"fmt"
+	"io/ioutil"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	doc, err := Parse(strings.NewReader(`<!DOCTYPE html>
+<html><head><title>Fish &amp; Chips</title>
+<script>if (a < b && c) { document.write("<p>no</p>") }</script>
+</head><body>
+<!-- <p>commented out</p> -->
+<ul><li>one<li>two</ul>
+<p>First<p>Second <a href=/x title='a "b"'>link</a><br>
+<div>Block</div></span>
+<img src="a.jpg" alt=x/>
+</body></html>`))
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if title := doc.First("title"); title == nil || title.InnerText() != "Fish & Chips" {
+		t.Errorf("Unexpected title %v", title)
+	}
+
+	if items := doc.Find(func(n *Node) bool { return n.Tag == "li" }); len(items) != 2 || items[1].InnerText() != "two" {
+		t.Errorf("Expected two list items, got %d", len(items))
+	}
+
+	paragraphs := doc.Find(func(n *Node) bool { return n.Tag == "p" })
+	if len(paragraphs) != 2 || paragraphs[0].InnerText() != "First" || paragraphs[1].InnerText() != "Second link" {
+		t.Errorf("Unexpected paragraphs %d", len(paragraphs))
+	}
+
+	if a := doc.First("a"); a == nil || a.Attr("href") != "/x" || a.Attr("title") != `a "b"` {
+		t.Errorf("Unexpected link %v", a)
+	}
+
+	if div := doc.First("div"); div == nil || div.Parent.Tag != "body" {
+		t.Error("Expected the div to close the open paragraph")
+	}
+
+	if img := doc.First("img"); img == nil || img.Attr("src") != "a.jpg" || len(img.Children) != 0 {
+		t.Errorf("Unexpected image %v", img)
+	}
+}
+
+func TestExtract(t *testing.T) {
+	page := `<html lang="es"><head>
+<title>Page title</title>
+<meta property="og:title" content="Article title">
+<meta name="description" content="Short description">
+<meta property="og:image" content="/lead.jpg">
+<meta name="author" content="Jane Doe">
+</head><body>
+<nav><p>Home</p></nav>
+<h1>Heading</h1>
+<p>Paragraph one.</p>
+<p>  Paragraph
+   two. </p>
+<footer><p>Copyright</p></footer>
+</body></html>`
+
+	article, err := Extract(strings.NewReader(page), "http://example.com/posts/1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if article.Title != "Article title" || article.Description != "Short description" || article.Language != "es" {
+		t.Errorf("Unexpected metadata %+v", article)
+	}
+
+	if article.ImageURL != "http://example.com/lead.jpg" || len(article.Authors) != 1 || article.Authors[0] != "Jane Doe" {
+		t.Errorf("Unexpected image or authors %+v", article)
+	}
+
+	if expected := "Heading\n\nParagraph one.\n\nParagraph two."; article.Text != expected {
+		t.Errorf("Expected text %q, got %q", expected, article.Text)
+	}
+}
+
+func TestText(t *testing.T) {
+	if text := Text("<p>One &mdash; <b>two</b></p><p>Three</p>"); text != "One — two\n\nThree" {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
+
+func TestTextBreaks(t *testing.T) {
+	if text := Text("<div>One<br>still one<br>\n <br>Two</div>"); text != "One still one\n\nTwo" {
+		t.Errorf("Unexpected text %q", text)
+	}
+}
+
+func TestMeasure(t *testing.T) {
+	files, _ := filepath.Glob(filepath.Join("testdata", "*.html"))
+	files = append(files, "")
+
+	for _, file := range files {
+		src := "<div> a,<b>b </b>\u00a0<script>x</script><br><i> </i>c<a href=x>d</a> </div>"
+		if file != "" {
+			b, err := ioutil.ReadFile(file)
+			if err != nil {
+				t.Fatal(err)
+			}
+			src = string(b)
+		}
+
+		doc, _ := Parse(strings.NewReader(src))
+
+		for n, stats := range measure(doc) {
+			text := n.InnerText()
+			if n.Tag == "" {
+				text = strings.Join(strings.Fields(n.Text), " ")
+			}
+
+			if stats.text.length != len(text) || stats.text.commas != strings.Count(text, ",") {
+				t.Errorf("%s: %s measured %d chars, %d commas for %q", file, n.Tag, stats.text.length, stats.text.commas, text)
+			}
+		}
+	}
+}
+
+// TestExtractLargePage guards against scoring that rereads nested subtrees,
+// which made pages like these take minutes.
+func TestExtractLargePage(t *testing.T) {
+	n := 32000
+	pages := map[string]string{
+		"nested divs": "<body>" + strings.Repeat("<div><p>hello, world, this is long enough text.</p>", n),
+		"links":       "<body><div>" + strings.Repeat("<p>hello, world, this is long enough <a>x</a> text.</p>", n) + "</div>",
+		"spans":       "<body>" + strings.Repeat("<span>", n) + "<div>hello, world, this is long enough text.</div>",
+		"stray tags":  "<body>" + strings.Repeat("<span>", n) + strings.Repeat("</b><li>", n),
+		"scripts":     "<body>" + strings.Repeat("<script>x</script><p>text</p>", n),
+	}
+
+	for name, page := range pages {
+		start := time.Now()
+		if _, err := Extract(strings.NewReader(page), "http://example.com/"); err != nil {
+			t.Errorf("%s: %v", name, err)
+		}
+
+		if elapsed := time.Since(start); elapsed > 5*time.Second {
+			t.Errorf("%s: extracting %d bytes took %v", name, len(page), elapsed)
+		}
+	}
+}
+
+func BenchmarkExtract(b *testing.B) {
+	for _, n := range []int{1000, 10000} {
+		page := "<body>" + strings.Repeat("<div><p>hello, world, this is long enough <a>text</a>.</p>", n)
+
+		b.Run(fmt.Sprint(n), func(b *testing.B) {
+			for i := 0; i < b.N; i++ {
+				Extract(strings.NewReader(page), "http://example.com/")
+			}
+		})
+	}
+}
@@ -0,0 +1,35 @@
+package services
+
+import (
+	"strings"
+
+	alchemyapi "github.com/jpadilla/alchemyapi-go"
+)
+
+// AlchemyExtractor uses AlchemyAPI's text and title extraction.
+type AlchemyExtractor struct {
+	client *alchemyapi.AlchemyAPI
+}
+
+func NewAlchemyExtractor(apiKey string) *AlchemyExtractor {
+	return &AlchemyExtractor{client: alchemyapi.New(apiKey)}
+}
+
+func (e *AlchemyExtractor) Extract(url string) (*Article, error) {
+	text, err := e.client.GetText(url, alchemyapi.GetTextOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	title, err := e.client.GetTitle(url, alchemyapi.GetTitleOptions{})
+	if err != nil {
+		return nil, err
+	}
+
+	return &Article{
+		URL:        url,
+		Title:      title.Title,
+		Text:       strings.TrimSpace(text.Text),
+		SourceType: "html",
+	}, nil
+}
@@ -0,0 +1,56 @@
+package services
+
+import (
+	"strings"
+	"time"
+
+	"github.com/jpadilla/rttm/readability"
+	"github.com/poptip/embedly"
+)
+
+// EmbedlyExtractor uses the Embedly Extract API.
+type EmbedlyExtractor struct {
+	client *embedly.Client
+}
+
+func NewEmbedlyExtractor(apiKey string) *EmbedlyExtractor {
+	return &EmbedlyExtractor{client: embedly.NewClient(apiKey)}
+}
+
+func (e *EmbedlyExtractor) Extract(url string) (*Article, error) {
+	response, err := e.client.ExtractOne(url, embedly.Options{})
+	if err != nil {
+		return nil, err
+	}
+
+	article := &Article{
+		URL:         response.URL,
+		Title:       response.Title,
+		Description: response.Description,
+		FaviconURL:  response.FaviconURL,
+		SiteName:    response.ProviderName,
+		Text:        readability.Text(response.Content),
+		SourceType:  "html",
+	}
+
+	for _, author := range response.Authors {
+		article.Authors = append(article.Authors, author.Name)
+	}
+
+	if len(response.Images) > 0 {
+		article.ImageURL = response.Images[0].URL
+	}
+
+	// Embedly gives milliseconds since the epoch
+	if response.Published > 0 {
+		article.Published = time.Unix(0, response.Published*int64(time.Millisecond)).UTC()
+	}
+
+	if article.URL == "" {
+		article.URL = url
+	}
+
+	article.Text = strings.TrimSpace(article.Text)
+
+	return article, nil
+}
@@ -0,0 +1,89 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"time"
+)
+
+// Article is the content an Extractor found at a URL.
+type Article struct {
+	URL         string
+	Title       string
+	Description string
+	Authors     []string
+	Published   time.Time
+	ImageURL    string
+	FaviconURL  string
+	SiteName    string
+	Language    string
+	Text        string
+
+	// SourceType is the kind of document the text came from, "html" or
+	// "pdf", and PageCount its number of pages if it has them.
+	SourceType string
+	PageCount  int
+}
+
+// Extractor finds the article at a URL and returns its text and metadata.
+type Extractor interface {
+	Extract(url string) (*Article, error)
+}
+
+// ErrNoText is returned when an Extractor finds no article text.
+var ErrNoText = errors.New("No article text found")
+
+// NewExtractor returns a ChainExtractor of the backends named in names,
+// e.g. "readability,embedly", tried in that order. An empty list means the
+// built-in readability extractor.
+func NewExtractor(names string) (Extractor, error) {
+	var chain ChainExtractor
+
+	for _, name := range strings.Split(names, ",") {
+		var extractor Extractor
+
+		switch strings.ToLower(strings.TrimSpace(name)) {
+		case "", "readability":
+			extractor = NewReadabilityExtractor()
+		case "embedly":
+			extractor = NewEmbedlyExtractor(os.Getenv("EMBEDLY_API_KEY"))
+		case "alchemy":
+			extractor = NewAlchemyExtractor(os.Getenv("ALCHEMY_API_KEY"))
+		default:
+			return nil, fmt.Errorf("Unknown extractor: %s", name)
+		}
+
+		chain = append(chain, extractor)
+	}
+
+	// Even a single backend goes through the chain, which turns empty
+	// articles into ErrNoText
+	return chain, nil
+}
+
+// ChainExtractor tries each Extractor in turn until one finds article text.
+type ChainExtractor []Extractor
+
+func (c ChainExtractor) Extract(url string) (*Article, error) {
+	err := ErrNoText
+
+	for _, extractor := range c {
+		var article *Article
+
+		article, err = extractor.Extract(url)
+		if err == nil && strings.TrimSpace(article.Text) == "" {
+			err = ErrNoText
+		}
+
+		if err == nil {
+			return article, nil
+		}
+
+		log.Printf("%T failed on %s: %v", extractor, url, err)
+	}
+
+	return nil, err
+}
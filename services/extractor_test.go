@@ -0,0 +1,177 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+type stubExtractor struct {
+	article *Article
+	err     error
+	calls   int
+}
+
+func (s *stubExtractor) Extract(url string) (*Article, error) {
+	s.calls++
+	return s.article, s.err
+}
+
+func TestNewExtractor(t *testing.T) {
+	tests := map[string]string{
+		"":                     "[*services.ReadabilityExtractor]",
+		"readability":          "[*services.ReadabilityExtractor]",
+		"Embedly":              "[*services.EmbedlyExtractor]",
+		"alchemy":              "[*services.AlchemyExtractor]",
+		"readability, embedly": "[*services.ReadabilityExtractor *services.EmbedlyExtractor]",
+	}
+
+	for names, expected := range tests {
+		extractor, err := NewExtractor(names)
+
+		chain, ok := extractor.(ChainExtractor)
+		if err != nil || !ok {
+			t.Errorf("NewExtractor(%q) = %T %v, expected a ChainExtractor", names, extractor, err)
+			continue
+		}
+
+		var types []string
+		for _, backend := range chain {
+			types = append(types, fmt.Sprintf("%T", backend))
+		}
+
+		if actual := fmt.Sprint(types); actual != expected {
+			t.Errorf("NewExtractor(%q) = %s, expected %s", names, actual, expected)
+		}
+	}
+
+	if _, err := NewExtractor("readability,diffbot"); err == nil {
+		t.Error("Expected an unknown extractor to fail")
+	}
+}
+
+func TestChainExtractor(t *testing.T) {
+	down := &stubExtractor{err: errors.New("service unavailable")}
+	empty := &stubExtractor{article: &Article{Title: "No text"}}
+	working := &stubExtractor{article: &Article{Title: "Works", Text: "Hello"}}
+	unused := &stubExtractor{article: &Article{Text: "Unused"}}
+
+	article, err := ChainExtractor{down, empty, working, unused}.Extract("http://example.com")
+	if err != nil || article.Title != "Works" {
+		t.Errorf("Unexpected article %+v %v", article, err)
+	}
+
+	if down.calls != 1 || empty.calls != 1 || unused.calls != 0 {
+		t.Errorf("Unexpected calls %d %d %d", down.calls, empty.calls, unused.calls)
+	}
+
+	if _, err = (ChainExtractor{down}).Extract("http://example.com"); err != down.err {
+		t.Errorf("Expected the last error, got %v", err)
+	}
+
+	if _, err = (ChainExtractor{empty}).Extract("http://example.com"); err != ErrNoText {
+		t.Errorf("Expected ErrNoText, got %v", err)
+	}
+}
+
+func TestReadabilityExtractor(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/article" {
+			http.NotFound(w, r)
+			return
+		}
+
+		fmt.Fprint(w, `<html lang="en"><head><title>A title</title></head><body><p>Hello there.</p></body></html>`)
+	}))
+	defer server.Close()
+
+	article, err := (&ReadabilityExtractor{client: server.Client()}).Extract(server.URL + "/article")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if article.Title != "A title" || article.Text != "Hello there." || article.Language != "en" || article.URL != server.URL+"/article" {
+		t.Errorf("Unexpected article %+v", article)
+	}
+
+	if _, err = (&ReadabilityExtractor{client: server.Client()}).Extract(server.URL + "/missing"); err == nil {
+		t.Error("Expected a 404 to fail")
+	}
+}
+
+func TestReadabilityExtractorPDF(t *testing.T) {
+	content := "BT /F1 11 Tf 72 700 Td (Quarterly numbers are up.) Tj ET"
+	document := fmt.Sprintf(`%%PDF-1.4
+1 0 obj << /Type /Catalog /Pages 2 0 R >> endobj
+2 0 obj << /Type /Pages /Kids [3 0 R] /Count 1 >> endobj
+3 0 obj << /Type /Page /Parent 2 0 R /Contents 4 0 R >> endobj
+4 0 obj << /Length %d >>
+stream
+%s
+endstream
+endobj
+trailer << /Root 1 0 R >>
+%%%%EOF`, len(content), content)
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// Sent without a PDF content type, as many servers do
+		w.Header().Set("Content-Type", "application/octet-stream")
+		fmt.Fprint(w, document)
+	}))
+	defer server.Close()
+
+	article, err := (&ReadabilityExtractor{client: server.Client()}).Extract(server.URL + "/files/q3-report.pdf?download=1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if article.Title != "q3-report" || article.Text != "Quarterly numbers are up." || article.SourceType != "pdf" || article.PageCount != 1 {
+		t.Errorf("Unexpected article %+v", article)
+	}
+}
+
+func TestReadabilityExtractorPrivateAddress(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprint(w, "<p>Internal only</p>")
+	}))
+	defer server.Close()
+
+	extractor := NewReadabilityExtractor()
+
+	// The test server itself is on loopback
+	if _, err := extractor.Extract(server.URL); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Expected ErrPrivateAddress, got %v", err)
+	}
+
+	// So is localhost, after resolving it
+	if _, err := extractor.Extract("http://localhost:1/"); !errors.Is(err, ErrPrivateAddress) {
+		t.Errorf("Expected ErrPrivateAddress, got %v", err)
+	}
+}
+
+func TestIsPublicIP(t *testing.T) {
+	tests := map[string]bool{
+		"8.8.8.8":          true,
+		"2001:4860::8888":  true,
+		"127.0.0.1":        false,
+		"10.1.2.3":         false,
+		"172.16.0.1":       false,
+		"192.168.1.1":      false,
+		"169.254.169.254":  false,
+		"100.64.0.1":       false,
+		"0.0.0.0":          false,
+		"::1":              false,
+		"fd00::1":          false,
+		"fe80::1":          false,
+		"::ffff:127.0.0.1": false,
+	}
+
+	for ip, public := range tests {
+		if IsPublicIP(net.ParseIP(ip)) != public {
+			t.Errorf("IsPublicIP(%s): expected %v", ip, public)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+package services
+
+import (
+	"log"
+	"strings"
+
+	ivona "github.com/jpadilla/ivona-go"
+)
+
+// ivonaVoices are the voices offered by IVONA Speech Cloud.
+var ivonaVoices = []string{
+	"Salli", "Joey", "Kimberly", "Kendra", "Eric", "Jennifer", "Ivy", "Justin", "Chipmunk",
+	"Amy", "Brian", "Emma", "Nicole", "Russell", "Geraint", "Gwyneth", "Raveena",
+	"Celine", "Mathieu", "Chantal", "Marlene", "Hans", "Carla", "Giorgio",
+	"Conchita", "Enrique", "Penelope", "Miguel", "Ines", "Cristiano", "Vitoria", "Ricardo",
+	"Lotte", "Ruben", "Naja", "Mads", "Liv", "Astrid", "Ewa", "Maja", "Jacek", "Jan",
+	"Tatyana", "Maxim", "Filiz", "Carmen", "Dora", "Karl",
+}
+
+// IvonaSynthesizer synthesizes speech through IVONA Speech Cloud.
+type IvonaSynthesizer struct {
+	client *ivona.Ivona
+	limits Limits
+}
+
+// NewIvonaSynthesizer returns a Synthesizer backed by IVONA Speech Cloud.
+func NewIvonaSynthesizer(accessKey string, secretKey string) *IvonaSynthesizer {
+	return &IvonaSynthesizer{
+		client: ivona.New(accessKey, secretKey),
+		limits: Limits{
+			MaxChunkSize:  4096,
+			MaxChunkBytes: 8192,
+			Concurrency:   4,
+			MaxRetries:    3,
+		},
+	}
+}
+
+func (s *IvonaSynthesizer) Synthesize(text string, options SpeechOptions) ([]byte, error) {
+	ivonaOptions := ivona.NewSpeechOptions(text)
+
+	if options.Voice != "" {
+		ivonaOptions.Voice.Name = options.Voice
+		ivonaOptions.Voice.Gender = ""
+	}
+
+	if options.Language != "" {
+		ivonaOptions.Voice.Language = options.Language
+	}
+
+	if options.Rate != "" {
+		ivonaOptions.Parameters.Rate = options.Rate
+	}
+
+	ir, err := s.client.CreateSpeech(ivonaOptions)
+	if err != nil {
+		// ivona-go reports every non 200 response with this prefix
+		if strings.HasPrefix(err.Error(), "Got non 200 status code") {
+			return nil, TemporaryError{err}
+		}
+
+		return nil, err
+	}
+
+	log.Println("RequestID = ", ir.RequestID)
+
+	return ir.Audio, nil
+}
+
+func (s *IvonaSynthesizer) Format() AudioFormat {
+	return MP3
+}
+
+func (s *IvonaSynthesizer) Limits() Limits {
+	return s.limits
+}
+
+func (s *IvonaSynthesizer) Voices() []string {
+	return ivonaVoices
+}
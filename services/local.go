@@ -0,0 +1,76 @@
+package services
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"runtime"
+	"strings"
+)
+
+const defaultLocalCommand = "espeak-ng --stdin --stdout"
+
+// LocalSynthesizer shells out to an offline TTS engine such as espeak-ng or
+// piper. Text is written to the command's stdin and WAV audio is read from
+// its stdout.
+type LocalSynthesizer struct {
+	Command   []string
+	VoiceFlag string
+	// VoiceNames are the voices installed for the command, if known.
+	VoiceNames []string
+	limits     Limits
+}
+
+// NewLocalSynthesizer returns a Synthesizer that runs command for every
+// chunk of text. An empty command defaults to espeak-ng.
+func NewLocalSynthesizer(command string, voiceFlag string) *LocalSynthesizer {
+	if strings.TrimSpace(command) == "" {
+		command = defaultLocalCommand
+	}
+
+	if voiceFlag == "" {
+		voiceFlag = "-v"
+	}
+
+	return &LocalSynthesizer{
+		Command:   strings.Fields(command),
+		VoiceFlag: voiceFlag,
+		limits: Limits{
+			MaxChunkSize: 16384,
+			Concurrency:  runtime.NumCPU(),
+		},
+	}
+}
+
+func (s *LocalSynthesizer) Synthesize(text string, options SpeechOptions) ([]byte, error) {
+	args := append([]string{}, s.Command[1:]...)
+
+	if options.Voice != "" {
+		args = append(args, s.VoiceFlag, options.Voice)
+	}
+
+	var stdout, stderr bytes.Buffer
+
+	cmd := exec.Command(s.Command[0], args...)
+	cmd.Stdin = strings.NewReader(text)
+	cmd.Stdout = &stdout
+	cmd.Stderr = &stderr
+
+	if err := cmd.Run(); err != nil {
+		return nil, fmt.Errorf("%s: %v %q", s.Command[0], err, stderr.String())
+	}
+
+	return stdout.Bytes(), nil
+}
+
+func (s *LocalSynthesizer) Format() AudioFormat {
+	return WAV
+}
+
+func (s *LocalSynthesizer) Limits() Limits {
+	return s.limits
+}
+
+func (s *LocalSynthesizer) Voices() []string {
+	return s.VoiceNames
+}
@@ -0,0 +1,155 @@
+package services
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+)
+
+// retryBackoff is the wait before the first retry of a chunk. It doubles
+// after every failed attempt.
+var retryBackoff = 500 * time.Millisecond
+
+// TemporaryError marks a synthesis failure that is worth retrying, such as a
+// non 200 response from the provider.
+type TemporaryError struct {
+	Err error
+}
+
+func (e TemporaryError) Error() string {
+	return e.Err.Error()
+}
+
+func (e TemporaryError) Temporary() bool {
+	return true
+}
+
+func isTemporary(err error) bool {
+	t, ok := err.(interface {
+		Temporary() bool
+	})
+
+	return ok && t.Temporary()
+}
+
+// synthesizeAll synthesizes chunks through a pool of workers bounded by the
+// synthesizer's limits and returns the audio in the same order as chunks.
+// The first permanent failure cancels the remaining work.
+func synthesizeAll(ctx context.Context, synth Synthesizer, chunks []string, options SpeechOptions) ([][]byte, error) {
+	limits := synth.Limits()
+	workers := limits.Concurrency
+
+	if workers < 1 {
+		workers = 1
+	}
+
+	if workers > len(chunks) {
+		workers = len(chunks)
+	}
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	var throttle <-chan time.Time
+
+	if limits.RequestsPerSecond > 0 {
+		ticker := time.NewTicker(time.Duration(float64(time.Second) / limits.RequestsPerSecond))
+		defer ticker.Stop()
+		throttle = ticker.C
+	}
+
+	results := make([][]byte, len(chunks))
+	jobs := make(chan int)
+
+	var wg sync.WaitGroup
+	var once sync.Once
+	var firstErr error
+
+	fail := func(err error) {
+		once.Do(func() {
+			firstErr = err
+			cancel()
+		})
+	}
+
+	for w := 0; w < workers; w++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for i := range jobs {
+				audio, err := synthesizeChunk(ctx, synth, chunks[i], options, limits.MaxRetries, throttle)
+				if err != nil {
+					fail(err)
+					continue
+				}
+
+				results[i] = audio
+			}
+		}()
+	}
+
+dispatch:
+	for i := range chunks {
+		select {
+		case jobs <- i:
+		case <-ctx.Done():
+			break dispatch
+		}
+	}
+
+	close(jobs)
+	wg.Wait()
+
+	if firstErr != nil {
+		return nil, firstErr
+	}
+
+	if err := ctx.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func synthesizeChunk(ctx context.Context, synth Synthesizer, text string, options SpeechOptions, retries int, throttle <-chan time.Time) ([]byte, error) {
+	backoff := retryBackoff
+
+	for attempt := 0; ; attempt++ {
+		if throttle != nil {
+			select {
+			case <-throttle:
+			case <-ctx.Done():
+				return nil, ctx.Err()
+			}
+		}
+
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+
+		log.Println("Creating speech...")
+		audio, err := synth.Synthesize(text, options)
+
+		if err == nil {
+			return audio, nil
+		}
+
+		if !isTemporary(err) || attempt >= retries {
+			log.Println(err)
+			return nil, err
+		}
+
+		log.Println("Retrying speech in", backoff, err)
+
+		select {
+		case <-time.After(backoff):
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		}
+
+		backoff *= 2
+	}
+}
@@ -0,0 +1,128 @@
+package services
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type stubSynthesizer struct {
+	sync.Mutex
+	limits   Limits
+	failures map[string][]error
+	calls    map[string]int
+	active   int
+	peak     int
+}
+
+func (s *stubSynthesizer) Synthesize(text string, options SpeechOptions) ([]byte, error) {
+	s.Lock()
+	s.calls[text]++
+	s.active++
+	if s.active > s.peak {
+		s.peak = s.active
+	}
+
+	var err error
+	if errs := s.failures[text]; len(errs) > 0 {
+		err, s.failures[text] = errs[0], errs[1:]
+	}
+	s.Unlock()
+
+	time.Sleep(time.Millisecond)
+
+	s.Lock()
+	s.active--
+	s.Unlock()
+
+	if err != nil {
+		return nil, err
+	}
+
+	return []byte(text), nil
+}
+
+func (s *stubSynthesizer) Format() AudioFormat {
+	return MP3
+}
+
+func (s *stubSynthesizer) Limits() Limits {
+	return s.limits
+}
+
+func (s *stubSynthesizer) Voices() []string {
+	return nil
+}
+
+func newStubSynthesizer(limits Limits) *stubSynthesizer {
+	return &stubSynthesizer{
+		limits:   limits,
+		failures: map[string][]error{},
+		calls:    map[string]int{},
+	}
+}
+
+func init() {
+	retryBackoff = time.Millisecond
+}
+
+func TestSynthesizeAllOrdered(t *testing.T) {
+	synth := newStubSynthesizer(Limits{Concurrency: 3})
+	chunks := []string{"a", "b", "c", "d", "e", "f", "g", "h"}
+
+	results, err := synthesizeAll(context.Background(), synth, chunks, SpeechOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i, chunk := range chunks {
+		if string(results[i]) != chunk {
+			t.Errorf("Expected result %d to be %q, got %q", i, chunk, results[i])
+		}
+	}
+
+	if synth.peak > 3 {
+		t.Errorf("Expected at most 3 concurrent calls, got %d", synth.peak)
+	}
+}
+
+func TestSynthesizeAllRetries(t *testing.T) {
+	synth := newStubSynthesizer(Limits{Concurrency: 2, MaxRetries: 2})
+	synth.failures["b"] = []error{
+		TemporaryError{errors.New("Got non 200 status code: 503")},
+		TemporaryError{errors.New("Got non 200 status code: 503")},
+	}
+
+	results, err := synthesizeAll(context.Background(), synth, []string{"a", "b"}, SpeechOptions{})
+
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if string(results[1]) != "b" || synth.calls["b"] != 3 {
+		t.Errorf("Expected chunk to succeed on third attempt, got %d calls", synth.calls["b"])
+	}
+}
+
+func TestSynthesizeAllPermanentFailure(t *testing.T) {
+	synth := newStubSynthesizer(Limits{Concurrency: 1, MaxRetries: 5})
+	permanent := errors.New("invalid voice")
+	synth.failures["a"] = []error{permanent}
+
+	_, err := synthesizeAll(context.Background(), synth, []string{"a", "b", "c"}, SpeechOptions{})
+
+	if err != permanent {
+		t.Errorf("Expected permanent error, got %v", err)
+	}
+
+	if synth.calls["a"] != 1 {
+		t.Errorf("Expected no retries, got %d calls", synth.calls["a"])
+	}
+
+	if synth.calls["c"] != 0 {
+		t.Error("Expected remaining chunks to be cancelled")
+	}
+}
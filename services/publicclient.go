@@ -0,0 +1,70 @@
+package services
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is returned when a URL fetched on behalf of a user
+// resolves to a loopback, private or link-local address.
+var ErrPrivateAddress = errors.New("Refusing to connect to a private address")
+
+var (
+	// sharedAddressSpace is carrier-grade NAT, which is private in practice
+	sharedAddressSpace = &net.IPNet{IP: net.IPv4(100, 64, 0, 0), Mask: net.CIDRMask(10, 32)}
+	thisNetwork        = &net.IPNet{IP: net.IPv4(0, 0, 0, 0), Mask: net.CIDRMask(8, 32)}
+)
+
+// IsPublicIP reports whether ip is reachable on the public internet, rather
+// than being this host, a private network or a cloud metadata service.
+func IsPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() ||
+		ip.IsLinkLocalUnicast() || ip.IsLinkLocalMulticast() || ip.IsMulticast() ||
+		sharedAddressSpace.Contains(ip) || thisNetwork.Contains(ip))
+}
+
+// NewPublicClient returns an HTTP client for fetching user supplied URLs.
+// It refuses to connect to addresses that aren't public. The check runs
+// after DNS resolution, on every connection, so hostnames and redirects
+// can't be used to reach internal services.
+func NewPublicClient(timeout time.Duration) *http.Client {
+	dialer := &net.Dialer{
+		Timeout: timeout,
+		Control: func(network, address string, c syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+
+			if ip := net.ParseIP(host); ip == nil || !IsPublicIP(ip) {
+				return ErrPrivateAddress
+			}
+
+			return nil
+		},
+	}
+
+	return &http.Client{
+		Timeout: timeout,
+		Transport: &http.Transport{
+			// No proxy, which would make the connection on our behalf
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: timeout,
+		},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 10 {
+				return errors.New("Stopped after 10 redirects")
+			}
+
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return fmt.Errorf("Invalid redirect to %s", req.URL)
+			}
+
+			return nil
+		},
+	}
+}
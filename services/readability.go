@@ -0,0 +1,111 @@
+package services
+
+import (
+	"bufio"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+
+	"github.com/jpadilla/rttm/pdf"
+	"github.com/jpadilla/rttm/readability"
+)
+
+// maxPageSize caps how much of a page ReadabilityExtractor reads, and
+// maxPDFSize how much of a PDF, which is read whole.
+const (
+	maxPageSize = 5 << 20
+	maxPDFSize  = 25 << 20
+)
+
+// ReadabilityExtractor fetches pages itself and extracts them locally with
+// the readability package, or the pdf package for PDF documents. It only
+// fetches from public addresses.
+type ReadabilityExtractor struct {
+	client *http.Client
+}
+
+func NewReadabilityExtractor() *ReadabilityExtractor {
+	return &ReadabilityExtractor{client: NewPublicClient(20 * time.Second)}
+}
+
+func (e *ReadabilityExtractor) Extract(url string) (*Article, error) {
+	req, err := http.NewRequest("GET", url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("User-Agent", "rttm (+https://github.com/jpadilla/rttm)")
+	req.Header.Set("Accept", "text/html,application/xhtml+xml,application/pdf")
+
+	resp, err := e.client.Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("Fetching %s: %s", url, resp.Status)
+	}
+
+	// Servers often send PDFs as application/octet-stream, so sniff too
+	body := bufio.NewReader(resp.Body)
+	start, _ := body.Peek(1024)
+	contentType, _, _ := mime.ParseMediaType(resp.Header.Get("Content-Type"))
+
+	if contentType == "application/pdf" || pdf.IsPDF(start) {
+		return extractPDF(io.LimitReader(body, maxPDFSize), resp.Request.URL.String())
+	}
+
+	page, err := readability.Extract(io.LimitReader(body, maxPageSize), resp.Request.URL.String())
+	if err != nil {
+		return nil, err
+	}
+
+	return &Article{
+		URL:         page.URL,
+		Title:       page.Title,
+		Description: page.Description,
+		Authors:     page.Authors,
+		Published:   page.Published,
+		ImageURL:    page.ImageURL,
+		FaviconURL:  page.FaviconURL,
+		SiteName:    page.SiteName,
+		Language:    page.Language,
+		Text:        page.Text,
+		SourceType:  "html",
+	}, nil
+}
+
+func extractPDF(r io.Reader, url string) (*Article, error) {
+	data, err := ioutil.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	doc, err := pdf.Extract(data)
+	if err != nil {
+		return nil, err
+	}
+
+	// Fall back to the file name, e.g. "annual-report" for annual-report.pdf
+	title := doc.Title
+	if title == "" {
+		name := path.Base(strings.SplitN(url, "?", 2)[0])
+		title = strings.TrimSuffix(name, path.Ext(name))
+	}
+
+	return &Article{
+		URL:        url,
+		Title:      title,
+		Authors:    doc.Authors,
+		Published:  doc.Created,
+		Language:   doc.Language,
+		Text:       doc.Text,
+		SourceType: "pdf",
+		PageCount:  doc.Pages,
+	}, nil
+}
@@ -8,7 +8,7 @@ import (
 )
 
 // SendSMS builds and sends SMS message via Twilio.
-func SendSMS(phone string, body string) {
+func SendSMS(phone string, body string) error {
 	twilioAccountSID := os.Getenv("TWILIO_ACCOUNT_SID")
 	twilioAuthToken := os.Getenv("TWILIO_AUTH_TOKEN")
 	twilioNumber := os.Getenv("TWILIO_NUMBER")
@@ -21,4 +21,6 @@ func SendSMS(phone string, body string) {
 	twilioMessage, twilioResponse, err := tw.Messages.Send(twilioNumber, phone, params)
 
 	fmt.Println(twilioMessage, twilioResponse, err)
+
+	return err
 }
@@ -0,0 +1,158 @@
+package services
+
+import (
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+
+	"github.com/jpadilla/rttm/chunker"
+)
+
+// AudioFormat describes the encoding of audio returned by a Synthesizer.
+type AudioFormat struct {
+	ContentType string
+	Extension   string
+}
+
+var (
+	MP3 = AudioFormat{ContentType: "audio/mpeg", Extension: "mp3"}
+	WAV = AudioFormat{ContentType: "audio/wav", Extension: "wav"}
+)
+
+// SpeechOptions is the set of parameters passed to a Synthesizer.
+// Empty fields fall back to the backend's defaults.
+type SpeechOptions struct {
+	Voice    string
+	Language string
+	Rate     string
+}
+
+// Limits describes how a Synthesizer backend may be called.
+type Limits struct {
+	// MaxChunkSize is the largest number of characters accepted by a single
+	// Synthesize call.
+	MaxChunkSize int
+
+	// MaxChunkBytes is the largest UTF-8 encoded size accepted by a single
+	// Synthesize call, for providers that limit bytes. Zero means unlimited.
+	MaxChunkBytes int
+
+	// Concurrency is the number of chunks synthesized in parallel.
+	Concurrency int
+
+	// RequestsPerSecond caps the rate of Synthesize calls. Zero means
+	// unlimited.
+	RequestsPerSecond float64
+
+	// MaxRetries is the number of times a chunk is retried after a
+	// temporary error.
+	MaxRetries int
+}
+
+// Chunker returns a chunker that keeps chunks within both MaxChunkSize and
+// MaxChunkBytes.
+func (l Limits) Chunker() *chunker.Chunker {
+	if l.MaxChunkBytes <= 0 {
+		return chunker.New(l.MaxChunkSize, chunker.Runes)
+	}
+
+	if l.MaxChunkSize <= 0 {
+		return chunker.New(l.MaxChunkBytes, chunker.Bytes)
+	}
+
+	// Scale each measure by the other limit, so that staying within their
+	// product means staying within both
+	return chunker.New(l.MaxChunkSize*l.MaxChunkBytes, func(s string) int {
+		runes := chunker.Runes(s) * l.MaxChunkBytes
+		bytes := chunker.Bytes(s) * l.MaxChunkSize
+
+		if runes > bytes {
+			return runes
+		}
+		return bytes
+	})
+}
+
+// Synthesizer converts a piece of text into audio.
+type Synthesizer interface {
+	Synthesize(text string, options SpeechOptions) ([]byte, error)
+	Format() AudioFormat
+	Limits() Limits
+
+	// Voices returns the names accepted as SpeechOptions.Voice, or nil when
+	// the backend can't tell.
+	Voices() []string
+}
+
+// FindVoice returns the name of synth's voice matching name in any case.
+// Any name is accepted when synth doesn't list its voices.
+func FindVoice(synth Synthesizer, name string) (string, bool) {
+	voices := synth.Voices()
+	if voices == nil {
+		return name, true
+	}
+
+	for _, voice := range voices {
+		if strings.EqualFold(voice, name) {
+			return voice, true
+		}
+	}
+
+	return "", false
+}
+
+// NewSynthesizer returns the Synthesizer backend registered under name.
+func NewSynthesizer(name string) (Synthesizer, error) {
+	switch strings.ToLower(name) {
+	case "", "ivona":
+		s := NewIvonaSynthesizer(os.Getenv("IVONA_ACCESS_KEY"), os.Getenv("IVONA_SECRET_KEY"))
+		s.limits = limitsFromEnv("IVONA", s.limits)
+		return s, nil
+	case "local":
+		s := NewLocalSynthesizer(os.Getenv("TTS_LOCAL_COMMAND"), os.Getenv("TTS_LOCAL_VOICE_FLAG"))
+		s.VoiceNames = splitList(os.Getenv("TTS_LOCAL_VOICES"))
+		s.limits = limitsFromEnv("TTS_LOCAL", s.limits)
+		return s, nil
+	}
+
+	return nil, fmt.Errorf("Unknown TTS engine: %s", name)
+}
+
+// splitList splits a comma separated list, returning nil when it's empty.
+func splitList(list string) []string {
+	var items []string
+
+	for _, item := range strings.Split(list, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
+}
+
+// limitsFromEnv overrides defaults with <prefix>_CONCURRENCY,
+// <prefix>_REQUESTS_PER_SECOND, <prefix>_MAX_RETRIES and
+// <prefix>_MAX_CHUNK_BYTES.
+func limitsFromEnv(prefix string, defaults Limits) Limits {
+	limits := defaults
+
+	if n, err := strconv.Atoi(os.Getenv(prefix + "_CONCURRENCY")); err == nil && n > 0 {
+		limits.Concurrency = n
+	}
+
+	if n, err := strconv.ParseFloat(os.Getenv(prefix+"_REQUESTS_PER_SECOND"), 64); err == nil && n >= 0 {
+		limits.RequestsPerSecond = n
+	}
+
+	if n, err := strconv.Atoi(os.Getenv(prefix + "_MAX_RETRIES")); err == nil && n >= 0 {
+		limits.MaxRetries = n
+	}
+
+	if n, err := strconv.Atoi(os.Getenv(prefix + "_MAX_CHUNK_BYTES")); err == nil && n >= 0 {
+		limits.MaxChunkBytes = n
+	}
+
+	return limits
+}
@@ -0,0 +1,59 @@
+package services
+
+import "testing"
+
+func TestFindVoice(t *testing.T) {
+	ivona := NewIvonaSynthesizer("", "")
+
+	if voice, ok := FindVoice(ivona, "joey"); !ok || voice != "Joey" {
+		t.Errorf("Expected Joey, got %q %v", voice, ok)
+	}
+
+	if _, ok := FindVoice(ivona, "Hal"); ok {
+		t.Error("Expected an unknown voice to be refused")
+	}
+
+	// Without a list of installed voices any name goes
+	local := NewLocalSynthesizer("", "")
+
+	if voice, ok := FindVoice(local, "en-us"); !ok || voice != "en-us" {
+		t.Errorf("Expected en-us, got %q %v", voice, ok)
+	}
+
+	local.VoiceNames = []string{"en-us", "en-gb"}
+
+	if _, ok := FindVoice(local, "fr"); ok {
+		t.Error("Expected a voice that isn't installed to be refused")
+	}
+}
+
+func TestLimitsChunker(t *testing.T) {
+	// Four characters, but eight bytes, per word
+	text := "éééé éééé éééé éééé"
+
+	tests := []struct {
+		limits   Limits
+		expected int
+	}{
+		{Limits{MaxChunkSize: 9}, 2},
+		{Limits{MaxChunkBytes: 9}, 4},
+		{Limits{MaxChunkSize: 9, MaxChunkBytes: 18}, 2},
+		{Limits{MaxChunkSize: 9, MaxChunkBytes: 9}, 4},
+		{Limits{}, 1},
+	}
+
+	for _, test := range tests {
+		chunks := test.limits.Chunker().Split(text)
+
+		if len(chunks) != test.expected {
+			t.Errorf("%+v: expected %d chunks, got %q", test.limits, test.expected, chunks)
+		}
+
+		for _, chunk := range chunks {
+			if test.limits.MaxChunkSize > 0 && len([]rune(chunk)) > test.limits.MaxChunkSize ||
+				test.limits.MaxChunkBytes > 0 && len(chunk) > test.limits.MaxChunkBytes {
+				t.Errorf("%+v: chunk %q is over the limit", test.limits, chunk)
+			}
+		}
+	}
+}
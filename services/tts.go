@@ -1,51 +1,48 @@
 package services
 
 import (
-	ivona "github.com/jpadilla/ivona-go"
+	"context"
 	"log"
 	"os"
+	"time"
+
+	"github.com/jpadilla/rttm/audio"
 )
 
-// TextToSpeech paginates text and returns appended audio bytes
-func TextToSpeech(text string) ([]byte, error) {
-	ivonaAccessKey := os.Getenv("IVONA_ACCESS_KEY")
-	ivonaSecretKey := os.Getenv("IVONA_SECRET_KEY")
-	ivonaClient := ivona.New(ivonaAccessKey, ivonaSecretKey)
+// Speech is the audio produced for a piece of text.
+type Speech struct {
+	Audio    []byte
+	Duration time.Duration
+	Format   AudioFormat
+	Options  SpeechOptions
+}
 
+// TextToSpeech splits text into chunks the synthesizer accepts and joins the
+// resulting audio into a single file. TTS_CHUNK_SILENCE sets the pause
+// inserted between chunks, e.g. "400ms".
+func TextToSpeech(synth Synthesizer, text string, options SpeechOptions) (*Speech, error) {
 	log.Println("Splitting text...")
-	max := 4096
-	count := 0
-	bucket := 0
-	results := make([]string, (len(text)/max)+1)
-	a := []rune(text)
-
-	for _, s := range a {
-		results[bucket] = results[bucket] + string(s)
-		count++
-
-		if count == max {
-			bucket++
-			count = 0
-		}
-	}
-
-	playlist := make([]byte, len(results))
+	chunks := synth.Limits().Chunker().Split(text)
 
-	for _, s := range results {
-		log.Println("Creating speech...")
-
-		ivonaOptions := ivona.NewSpeechOptions(s)
-		ir, err := ivonaClient.CreateSpeech(ivonaOptions)
-
-		if err != nil {
-			log.Println(err)
-			return nil, err
-		}
+	results, err := synthesizeAll(context.Background(), synth, chunks, options)
+	if err != nil {
+		return nil, err
+	}
 
-		log.Println("RequestID = ", ir.RequestID)
+	silence, _ := time.ParseDuration(os.Getenv("TTS_CHUNK_SILENCE"))
+	format := synth.Format()
 
-		playlist = append(playlist, ir.Audio...)
+	log.Println("Joining audio...")
+	result, err := audio.Join(format.ContentType, results, silence)
+	if err != nil {
+		log.Println(err)
+		return nil, err
 	}
 
-	return playlist, nil
+	return &Speech{
+		Audio:    result.Audio,
+		Duration: result.Duration,
+		Format:   format,
+		Options:  options,
+	}, nil
 }
@@ -0,0 +1,164 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gorilla/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	sessionCookieName = "rttm_session"
+	sessionMaxAge     = 30 * 24 * time.Hour
+)
+
+const userContextKey contextKey = 1
+
+// csrfField is the form field that carries the CSRF token.
+const csrfField = "csrf_token"
+
+var errInvalidSession = errors.New("Invalid session")
+
+// signSession returns the cookie value for userId, valid until expires:
+// the id and expiry followed by their HMAC-SHA256 with SESSION_SECRET.
+func signSession(secret string, userId bson.ObjectId, expires time.Time) string {
+	value := userId.Hex() + "|" + strconv.FormatInt(expires.Unix(), 10)
+
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(value))
+
+	return value + "|" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// parseSession returns the user id signed into value if it is unexpired.
+func parseSession(secret string, value string, now time.Time) (bson.ObjectId, error) {
+	parts := strings.Split(value, "|")
+
+	if secret == "" || len(parts) != 3 || !bson.IsObjectIdHex(parts[0]) {
+		return "", errInvalidSession
+	}
+
+	expires, err := strconv.ParseInt(parts[1], 10, 64)
+	if err != nil || now.Unix() > expires {
+		return "", errInvalidSession
+	}
+
+	expected := signSession(secret, bson.ObjectIdHex(parts[0]), time.Unix(expires, 0))
+	if !hmac.Equal([]byte(value), []byte(expected)) {
+		return "", errInvalidSession
+	}
+
+	return bson.ObjectIdHex(parts[0]), nil
+}
+
+// csrfToken returns the CSRF token for a session cookie value, an HMAC of it
+// so each session has its own token and no state needs to be stored.
+func csrfToken(secret string, session string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("csrf|" + session))
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// CSRFToken returns the token forms posted in r's session must include.
+func CSRFToken(r *http.Request) string {
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil || cookie.Value == "" {
+		return ""
+	}
+
+	return csrfToken(os.Getenv("SESSION_SECRET"), cookie.Value)
+}
+
+// validCSRF reports whether r carries its session's CSRF token.
+func validCSRF(r *http.Request) bool {
+	expected := CSRFToken(r)
+
+	return expected != "" && hmac.Equal([]byte(r.FormValue(csrfField)), []byte(expected))
+}
+
+// SignIn sets the session cookie for user.
+func SignIn(w http.ResponseWriter, user *User) {
+	expires := time.Now().Add(sessionMaxAge)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    signSession(os.Getenv("SESSION_SECRET"), user.Id, expires),
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   strings.HasPrefix(siteURL(), "https://"),
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// SignOut clears the session cookie.
+func SignOut(w http.ResponseWriter) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookieName,
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// CurrentUser returns the user signed in to r, or nil.
+func CurrentUser(r *http.Request) *User {
+	if user, ok := context.Get(r, userContextKey).(*User); ok {
+		return user
+	}
+
+	cookie, err := r.Cookie(sessionCookieName)
+	if err != nil {
+		return nil
+	}
+
+	userId, err := parseSession(os.Getenv("SESSION_SECRET"), cookie.Value, time.Now())
+	if err != nil {
+		return nil
+	}
+
+	user, err := GetUserById(userId)
+	if err != nil {
+		return nil
+	}
+
+	context.Set(r, userContextKey, user)
+	return user
+}
+
+// RequireUser redirects to the sign in page unless someone is signed in,
+// and checks the CSRF token of anything they post.
+func RequireUser(h http.HandlerFunc) http.HandlerFunc {
+	return RequireCSRF(func(w http.ResponseWriter, r *http.Request) {
+		if CurrentUser(r) == nil {
+			http.Redirect(w, r, "/signin", http.StatusSeeOther)
+			return
+		}
+
+		h(w, r)
+	})
+}
+
+// RequireCSRF rejects POSTs without their session's CSRF token, so other
+// sites can't submit forms on behalf of someone signed in.
+func RequireCSRF(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" && !validCSRF(r) {
+			http.Error(w, "Invalid CSRF token", http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	}
+}
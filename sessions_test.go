@@ -0,0 +1,102 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/context"
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseSession(t *testing.T) {
+	now := time.Now()
+	userId := bson.NewObjectId()
+	value := signSession("secret", userId, now.Add(time.Hour))
+
+	if id, err := parseSession("secret", value, now); err != nil || id != userId {
+		t.Errorf("Expected %s, got %s %v", userId.Hex(), id.Hex(), err)
+	}
+
+	tests := []struct {
+		name   string
+		secret string
+		value  string
+		now    time.Time
+	}{
+		{"expired", "secret", value, now.Add(2 * time.Hour)},
+		{"wrong secret", "other", value, now},
+		{"no secret", "", value, now},
+		{"tampered id", "secret", bson.NewObjectId().Hex() + value[24:], now},
+		{"tampered expiry", "secret", strings.Replace(value, "|", "|9", 1), now},
+		{"garbage", "secret", "garbage", now},
+	}
+
+	for _, test := range tests {
+		if _, err := parseSession(test.secret, test.value, test.now); err != errInvalidSession {
+			t.Errorf("%s: expected errInvalidSession, got %v", test.name, err)
+		}
+	}
+}
+
+func TestRequireUser(t *testing.T) {
+	called := false
+	handler := RequireUser(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	r, _ := http.NewRequest("GET", "/account", nil)
+	w := httptest.NewRecorder()
+	handler(w, r)
+
+	if called || w.Code != http.StatusSeeOther || w.Header().Get("Location") != "/signin" {
+		t.Errorf("Expected redirect to /signin, got %d %s", w.Code, w.Header().Get("Location"))
+	}
+}
+
+func TestRequireUserCSRF(t *testing.T) {
+	session := signSession("", bson.NewObjectId(), time.Now().Add(time.Hour))
+
+	tests := []struct {
+		name     string
+		method   string
+		token    string
+		expected int
+	}{
+		{"get", "GET", "", http.StatusOK},
+		{"post without token", "POST", "", http.StatusForbidden},
+		{"post with another session's token", "POST", csrfToken("", session+"x"), http.StatusForbidden},
+		{"post with token", "POST", csrfToken("", session), http.StatusOK},
+	}
+
+	for _, test := range tests {
+		handler := RequireUser(func(w http.ResponseWriter, r *http.Request) {})
+
+		form := url.Values{csrfField: {test.token}}
+		r, _ := http.NewRequest(test.method, "/account/phones", strings.NewReader(form.Encode()))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.AddCookie(&http.Cookie{Name: sessionCookieName, Value: session})
+		context.Set(r, userContextKey, &User{Id: bson.NewObjectId()})
+
+		w := httptest.NewRecorder()
+		handler(w, r)
+		context.Clear(r)
+
+		if w.Code != test.expected {
+			t.Errorf("%s: expected %d, got %d", test.name, test.expected, w.Code)
+		}
+	}
+}
+
+func TestSignInCookie(t *testing.T) {
+	w := httptest.NewRecorder()
+	SignIn(w, &User{Id: bson.NewObjectId()})
+
+	cookie := w.Result().Cookies()[0]
+	if !cookie.HttpOnly || cookie.SameSite != http.SameSiteLaxMode {
+		t.Errorf("Expected an HttpOnly SameSite=Lax cookie, got %s", cookie)
+	}
+}
@@ -0,0 +1,275 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"strconv"
+	"strings"
+
+	"github.com/jpadilla/rttm/services"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	CommandSubmit  = "SUBMIT"
+	CommandHelp    = "HELP"
+	CommandList    = "LIST"
+	CommandFeed    = "FEED"
+	CommandStop    = "STOP"
+	CommandStart   = "START"
+	CommandVoice   = "VOICE"
+	CommandDelete  = "DELETE"
+	CommandUnknown = "UNKNOWN"
+
+	defaultListSize = 5
+	maxListSize     = 10
+)
+
+var commandAliases = map[string]string{
+	"HELP":        CommandHelp,
+	"INFO":        CommandHelp,
+	"LIST":        CommandList,
+	"FEED":        CommandFeed,
+	"PODCAST":     CommandFeed,
+	"STOP":        CommandStop,
+	"UNSUBSCRIBE": CommandStop,
+	"CANCEL":      CommandStop,
+	"END":         CommandStop,
+	"QUIT":        CommandStop,
+	"START":       CommandStart,
+	"UNSTOP":      CommandStart,
+	"YES":         CommandStart,
+	"VOICE":       CommandVoice,
+	"DELETE":      CommandDelete,
+	"DEL":         CommandDelete,
+}
+
+const helpMessage = "Text us a link and we'll read it to you. " +
+	"LIST shows your last articles, DELETE <n> removes one, FEED gets your podcast, FEED NEW replaces its link, " +
+	"VOICE <name> changes the voice, STOP unsubscribes."
+
+// SMSCommand is an inbound SMS parsed into a command and its argument.
+// Submitted links are in URLs, with Dropped counting those over the cap.
+type SMSCommand struct {
+	Name    string
+	Arg     string
+	URLs    []string
+	Dropped int
+}
+
+// ParseSMSCommand recognizes links anywhere in body as CommandSubmit, or
+// otherwise a keyword in the first word such as "LIST" or "voice Joey".
+func ParseSMSCommand(body string) SMSCommand {
+	words := strings.Fields(body)
+
+	if urls, dropped := ExtractURLs(body, maxURLsPerMessage()); len(urls) > 0 {
+		return SMSCommand{Name: CommandSubmit, URLs: urls, Dropped: dropped}
+	}
+
+	if len(words) == 0 {
+		return SMSCommand{Name: CommandUnknown}
+	}
+
+	name, ok := commandAliases[strings.ToUpper(strings.Trim(words[0], ".!?"))]
+	if !ok {
+		return SMSCommand{Name: CommandUnknown, Arg: strings.TrimSpace(body)}
+	}
+
+	return SMSCommand{Name: name, Arg: strings.Join(words[1:], " ")}
+}
+
+// HandleSMSCommand runs command on behalf of phone and returns the reply.
+func HandleSMSCommand(phone string, command SMSCommand) (string, error) {
+	subscriber, err := GetSubscriber(phone)
+	if err != nil {
+		return "", err
+	}
+
+	switch command.Name {
+	case CommandSubmit:
+		if subscriber.OptedOut {
+			return "You're unsubscribed. Reply START to get articles read to you again.", nil
+		}
+
+		if !allow(PhoneLimiter, "phone", phone) {
+			return "You're sending links faster than we can read them. Please try again in a little while.", nil
+		}
+
+		// Twilio vouches for the sender, so the number counts as verified
+		if _, err := FindOrCreateUserByPhone(phone); err != nil {
+			return "", err
+		}
+
+		if _, err := EnqueueJobs(command.URLs, phone); err != nil {
+			return "", err
+		}
+
+		reply := "Got it! We'll text you a link as soon as it's ready."
+
+		if len(command.URLs) > 1 {
+			reply = fmt.Sprintf("Got %d links! We'll text you once they're all ready.", len(command.URLs))
+		}
+
+		if command.Dropped > 0 {
+			reply += fmt.Sprintf(" We only read %d links per message, so %d were skipped.", len(command.URLs), command.Dropped)
+		}
+
+		return reply, nil
+
+	case CommandHelp:
+		return helpMessage, nil
+
+	case CommandList:
+		return listCommand(phone, command.Arg)
+
+	case CommandFeed:
+		return feedCommand(phone, command.Arg)
+
+	case CommandStop:
+		if err := SetSubscriber(phone, bson.M{"optedout": true}); err != nil {
+			return "", err
+		}
+
+		return "You've been unsubscribed and won't get any more messages. Reply START to resubscribe.", nil
+
+	case CommandStart:
+		if err := SetSubscriber(phone, bson.M{"optedout": false}); err != nil {
+			return "", err
+		}
+
+		return "Welcome back! Text us a link and we'll read it to you.", nil
+
+	case CommandVoice:
+		voice := strings.TrimSpace(command.Arg)
+
+		if voice == "" {
+			options, err := speechOptionsForPhone(phone)
+			if err != nil {
+				return "", err
+			}
+
+			if options.Voice == "" {
+				return "You're using the default voice. Reply VOICE <name> to change it.", nil
+			}
+
+			return "Your voice is " + options.Voice + ". Reply VOICE <name> to change it.", nil
+		}
+
+		voice, ok := services.FindVoice(Synthesizer, voice)
+		if !ok {
+			return "Sorry, we don't have that voice. Reply VOICE with one of: " + strings.Join(Synthesizer.Voices(), ", "), nil
+		}
+
+		user, err := FindOrCreateUserByPhone(phone)
+		if err != nil {
+			return "", err
+		}
+
+		user.Voice = voice
+
+		if err = user.Update(); err != nil {
+			return "", err
+		}
+
+		return "New articles will be read by " + voice + ".", nil
+
+	case CommandDelete:
+		return deleteCommand(phone, command.Arg)
+	}
+
+	return "Sorry, we didn't understand that. " + helpMessage, nil
+}
+
+func listCommand(phone string, arg string) (string, error) {
+	n := defaultListSize
+
+	if i, err := strconv.Atoi(arg); err == nil && i > 0 {
+		n = i
+	}
+
+	if n > maxListSize {
+		n = maxListSize
+	}
+
+	requests, err := FindRecentRequestsByPhone(phone, n)
+	if err != nil {
+		return "", err
+	}
+
+	if len(requests) == 0 {
+		return "You haven't sent us any articles yet. Text us a link to get started.", nil
+	}
+
+	lines := make([]string, len(requests))
+
+	for i, request := range requests {
+		lines[i] = fmt.Sprintf("%d. %s %s/%s", i+1, SmartTruncate(request.Post.Title, 60, "..."), siteURL(), request.Id.Hex())
+	}
+
+	return strings.Join(lines, "\n"), nil
+}
+
+// feedCommand replies with the private feed URL of phone's owner, first
+// replacing it when arg is NEW.
+func feedCommand(phone string, arg string) (string, error) {
+	user, err := FindOrCreateUserByPhone(phone)
+	if err != nil {
+		return "", err
+	}
+
+	if strings.EqualFold(strings.TrimSpace(arg), "NEW") {
+		if err = user.RotateFeedToken(); err != nil {
+			return "", err
+		}
+
+		feedURL, _ := user.FeedURL()
+		return "Your old feed link no longer works. Subscribe with your new one: " + feedURL, nil
+	}
+
+	feedURL, err := user.FeedURL()
+	if err != nil {
+		return "", err
+	}
+
+	return "Subscribe to your podcast: " + feedURL + " Keep it private, anyone with the link can listen.", nil
+}
+
+func deleteCommand(phone string, arg string) (string, error) {
+	n, err := strconv.Atoi(strings.TrimSpace(arg))
+
+	if err != nil || n < 1 || n > maxListSize {
+		return "Reply DELETE <n> with the number of an article from LIST.", nil
+	}
+
+	requests, err := FindRecentRequestsByPhone(phone, n)
+	if err != nil {
+		return "", err
+	}
+
+	if len(requests) < n {
+		return fmt.Sprintf("There's no article number %d. Reply LIST to see your articles.", n), nil
+	}
+
+	request := requests[n-1]
+
+	// The article may have been requested several times, from this phone or
+	// another one of the owner's, so remove it from their feed altogether
+	owners := []bson.M{{"phone": phone}}
+
+	user, err := GetUserByPhone(phone)
+	if err == nil {
+		owners = append(owners, bson.M{"user_id": user.Id})
+	} else if err != mgo.ErrNotFound {
+		return "", err
+	}
+
+	info, err := RequestCollection.RemoveAll(bson.M{"post_id": request.PostId, "$or": owners})
+	if err != nil {
+		return "", err
+	}
+
+	log.Println("Deleted", info.Removed, "requests for post", request.PostId.Hex(), "for", phone)
+
+	return "Deleted " + SmartTruncate(request.Post.Title, 60, "...") + ".", nil
+}
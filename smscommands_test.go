@@ -0,0 +1,205 @@
+package main
+
+import (
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestParseSMSCommand(t *testing.T) {
+	tests := []struct {
+		body     string
+		expected SMSCommand
+	}{
+		{"", SMSCommand{Name: CommandUnknown}},
+		{"Read this http://example.com/post please", SMSCommand{Name: CommandSubmit, URLs: []string{"http://example.com/post"}}},
+		{"http://a.com/1 and http://b.com/2, http://a.com/1", SMSCommand{Name: CommandSubmit, URLs: []string{"http://a.com/1", "http://b.com/2"}}},
+		{"help", SMSCommand{Name: CommandHelp}},
+		{"Help!", SMSCommand{Name: CommandHelp}},
+		{"LIST 3", SMSCommand{Name: CommandList, Arg: "3"}},
+		{"feed", SMSCommand{Name: CommandFeed}},
+		{"Stop", SMSCommand{Name: CommandStop}},
+		{"unsubscribe", SMSCommand{Name: CommandStop}},
+		{"START", SMSCommand{Name: CommandStart}},
+		{"voice  Joey", SMSCommand{Name: CommandVoice, Arg: "Joey"}},
+		{"delete 2", SMSCommand{Name: CommandDelete, Arg: "2"}},
+		{"what is this?", SMSCommand{Name: CommandUnknown, Arg: "what is this?"}},
+	}
+
+	for _, test := range tests {
+		command := ParseSMSCommand(test.body)
+
+		if !reflect.DeepEqual(command, test.expected) {
+			t.Errorf("%q: expected %+v, got %+v", test.body, test.expected, command)
+		}
+	}
+}
+
+func TestRenderTwiML(t *testing.T) {
+	w := httptest.NewRecorder()
+
+	renderTwiML(w, "Tom & Jerry <3")
+
+	body := w.Body.String()
+
+	if w.Header().Get("Content-Type") != "text/xml" || !strings.HasSuffix(body, "<Response><Message>Tom &amp; Jerry &lt;3</Message></Response>") {
+		t.Errorf("Unexpected TwiML %s", body)
+	}
+}
+
+// sms runs body as an SMS from phone and returns the reply.
+func sms(t *testing.T, phone string, body string) string {
+	reply, err := HandleSMSCommand(phone, ParseSMSCommand(body))
+	if err != nil {
+		t.Fatalf("%q: %v", body, err)
+	}
+
+	return reply
+}
+
+func TestListAndDeleteCommands(t *testing.T) {
+	defer withTestDB(t)()
+
+	phone, other := "+15555550100", "+15555550101"
+
+	user, err := FindOrCreateUserByPhone(phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = user.AddPhone(other); err != nil {
+		t.Fatal(err)
+	}
+
+	posts := map[string]bson.ObjectId{}
+	for _, title := range []string{"Alpha", "Beta", "Gamma"} {
+		posts[title] = bson.NewObjectId()
+		if err := PostCollection.Insert(&Post{Id: posts[title], Title: title}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	posts["Deleted"] = bson.NewObjectId()
+
+	start := time.Date(2014, 8, 1, 0, 0, 0, 0, time.UTC)
+	requests := []struct {
+		post  string
+		phone string
+	}{
+		{"Alpha", phone},
+		{"Beta", phone},
+		{"Alpha", phone},
+		{"Gamma", phone},
+		{"Beta", other},
+		{"Deleted", phone},
+	}
+
+	for i, r := range requests {
+		err := RequestCollection.Insert(&Request{
+			Id:        bson.NewObjectId(),
+			PostId:    posts[r.post],
+			Phone:     r.phone,
+			UserId:    user.Id,
+			CreatedAt: start.Add(time.Duration(i) * time.Hour),
+		})
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	titles := func() []string {
+		var titles []string
+		for _, line := range strings.Split(sms(t, phone, "LIST"), "\n") {
+			titles = append(titles, strings.Fields(line)[1])
+		}
+		return titles
+	}
+
+	// Alpha is listed once, and the deleted post not at all
+	if expected := []string{"Gamma", "Alpha", "Beta"}; !reflect.DeepEqual(titles(), expected) {
+		t.Errorf("Expected %v, got %v", expected, titles())
+	}
+
+	if reply := sms(t, phone, "DELETE 2"); reply != "Deleted Alpha." {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	if reply := sms(t, phone, "DELETE 2"); reply != "Deleted Beta." {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	if expected := []string{"Gamma"}; !reflect.DeepEqual(titles(), expected) {
+		t.Errorf("Expected %v, got %v", expected, titles())
+	}
+
+	// Beta is gone from the other phone too, as it shares the feed
+	if n, _ := RequestCollection.Find(bson.M{"post_id": posts["Beta"]}).Count(); n != 0 {
+		t.Errorf("Expected every request for Beta to be deleted, %d left", n)
+	}
+
+	if reply := sms(t, phone, "DELETE 2"); !strings.HasPrefix(reply, "There's no article number 2") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+}
+
+func TestVoiceCommand(t *testing.T) {
+	defer withTestDB(t)()
+
+	Synthesizer = &fakeSynthesizer{}
+	defer func() { Synthesizer = nil }()
+
+	phone := "+15555550100"
+
+	if reply := sms(t, phone, "VOICE"); !strings.HasPrefix(reply, "You're using the default voice") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	if reply := sms(t, phone, "VOICE Hal"); !strings.HasSuffix(reply, "one of: Salli, Joey") {
+		t.Errorf("Expected the valid voices, got %q", reply)
+	}
+
+	if reply := sms(t, phone, "VOICE joey"); reply != "New articles will be read by Joey." {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	options, err := speechOptionsForPhone(phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if options.Voice != "Joey" {
+		t.Errorf("Expected voice Joey, got %q", options.Voice)
+	}
+}
+
+func TestStopCommand(t *testing.T) {
+	defer withTestDB(t)()
+
+	phone := "+15555550100"
+
+	if reply := sms(t, phone, "STOP"); !strings.HasPrefix(reply, "You've been unsubscribed") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	if reply := sms(t, phone, "http://example.com/a"); !strings.HasPrefix(reply, "You're unsubscribed") {
+		t.Errorf("Unexpected reply %q", reply)
+	}
+
+	if n, _ := JobCollection.Count(); n != 0 {
+		t.Errorf("Expected no jobs while unsubscribed, got %d", n)
+	}
+
+	sms(t, phone, "START")
+
+	subscriber, err := GetSubscriber(phone)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if subscriber.OptedOut {
+		t.Error("Expected START to resubscribe")
+	}
+}
@@ -0,0 +1,156 @@
+package storage
+
+import (
+	"io/ioutil"
+	"net/http"
+	"strings"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// GridFSStore keeps blobs in MongoDB GridFS, using the key as the file id,
+// for the app itself to serve at BaseURL with Handler.
+type GridFSStore struct {
+	GridFS  *mgo.GridFS
+	BaseURL string
+}
+
+// NewGridFSStore stores blobs in the "audio" GridFS of db.
+func NewGridFSStore(db *mgo.Database, baseURL string) *GridFSStore {
+	return &GridFSStore{GridFS: db.GridFS("audio"), BaseURL: strings.TrimRight(baseURL, "/")}
+}
+
+// EnsureIndexes creates the indexes GridFS drivers expect on its
+// collections.
+func (s *GridFSStore) EnsureIndexes() error {
+	if err := s.GridFS.Files.EnsureIndexKey("filename", "uploadDate"); err != nil {
+		return err
+	}
+
+	return s.GridFS.Chunks.EnsureIndex(mgo.Index{Key: []string{"files_id", "n"}, Unique: true})
+}
+
+// open returns the file stored under key. Files holding only metadata, whose
+// data has not been written yet, are reported as missing.
+func (s *GridFSStore) open(key string) (*mgo.GridFile, error) {
+	file, err := s.GridFS.OpenId(key)
+	if err == mgo.ErrNotFound {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if file.MD5() == "" {
+		file.Close()
+		return nil, ErrNotFound
+	}
+
+	return file, nil
+}
+
+// Put replaces the file under key, keeping any metadata stored for it.
+func (s *GridFSStore) Put(key string, data []byte, contentType string) error {
+	var existing struct {
+		Metadata Metadata `bson:"metadata"`
+	}
+
+	err := s.GridFS.Files.FindId(key).One(&existing)
+	if err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+
+	if err = s.Delete(key); err != nil {
+		return err
+	}
+
+	file, err := s.GridFS.Create(key)
+	if err != nil {
+		return err
+	}
+
+	file.SetId(key)
+	file.SetContentType(contentType)
+	if existing.Metadata != nil {
+		file.SetMeta(existing.Metadata)
+	}
+
+	if _, err = file.Write(data); err != nil {
+		file.Abort()
+		file.Close()
+		return err
+	}
+
+	return file.Close()
+}
+
+func (s *GridFSStore) Get(key string) ([]byte, error) {
+	file, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	return ioutil.ReadAll(file)
+}
+
+func (s *GridFSStore) Delete(key string) error {
+	if err := s.GridFS.RemoveId(key); err != nil && err != mgo.ErrNotFound {
+		return err
+	}
+
+	return nil
+}
+
+func (s *GridFSStore) Exists(key string) (bool, error) {
+	n, err := s.GridFS.Files.Find(bson.M{"_id": key, "md5": bson.M{"$exists": true}}).Count()
+	return n > 0, err
+}
+
+func (s *GridFSStore) PublicURL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+// PutMetadata sets the metadata of the file under key. It may be called
+// before Put, which keeps it.
+func (s *GridFSStore) PutMetadata(key string, metadata Metadata) error {
+	_, err := s.GridFS.Files.UpsertId(key, bson.M{"$set": bson.M{"metadata": metadata}})
+	return err
+}
+
+func (s *GridFSStore) GetMetadata(key string) (Metadata, error) {
+	var file struct {
+		Metadata Metadata `bson:"metadata"`
+	}
+
+	err := s.GridFS.Files.FindId(key).One(&file)
+	if err == mgo.ErrNotFound || (err == nil && file.Metadata == nil) {
+		return nil, ErrNotFound
+	}
+
+	return file.Metadata, err
+}
+
+func (s *GridFSStore) Open(key string) (*Blob, error) {
+	file, err := s.open(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Blob{
+		ReadSeeker:  file,
+		Closer:      file,
+		ContentType: file.ContentType(),
+		ModTime:     file.UploadDate(),
+		ETag:        `"` + file.MD5() + `"`,
+	}, nil
+}
+
+// Handler serves the stored files with their content type, supporting
+// Range requests so players can seek. Mount it with the BaseURL path
+// stripped.
+func (s *GridFSStore) Handler() http.Handler {
+	return serveOpener(s)
+}
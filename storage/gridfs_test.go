@@ -0,0 +1,107 @@
+package storage
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+// newTestGridFSStore uses a scratch database on the Mongo server at
+// MONGO_TEST_URL, skipping the test when it is unset.
+func newTestGridFSStore(t *testing.T) (*GridFSStore, func()) {
+	url := os.Getenv("MONGO_TEST_URL")
+	if url == "" {
+		t.Skip("MONGO_TEST_URL not set")
+	}
+
+	session, err := mgo.DialWithTimeout(url, 2*time.Second)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	db := session.DB("")
+	store := NewGridFSStore(db, "http://example.com/audio/")
+
+	if err = store.EnsureIndexes(); err != nil {
+		t.Fatal(err)
+	}
+
+	return store, func() {
+		db.DropDatabase()
+		session.Close()
+	}
+}
+
+func TestGridFSStore(t *testing.T) {
+	store, cleanup := newTestGridFSStore(t)
+	defer cleanup()
+
+	testBlobStore(t, store)
+
+	if url := store.PublicURL("posts/1/a.mp3"); url != "http://example.com/audio/posts/1/a.mp3" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+}
+
+func TestGridFSStoreMetadata(t *testing.T) {
+	store, cleanup := newTestGridFSStore(t)
+	defer cleanup()
+
+	key := "posts/1/a.mp3"
+
+	if err := PutMetadata(store, key, Metadata{"voice": "Joey"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := store.Exists(key); ok {
+		t.Error("Expected metadata alone not to count as the file")
+	}
+
+	if err := store.Put(key, []byte("audio"), "audio/mpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	metadata, err := GetMetadata(store, key)
+	if err != nil || metadata["voice"] != "Joey" {
+		t.Errorf("Expected metadata to survive Put, got %v %v", metadata, err)
+	}
+
+	if ok, _ := store.Exists(MetadataKey(key)); ok {
+		t.Error("Expected no metadata sidecar")
+	}
+}
+
+func TestGridFSStoreHandler(t *testing.T) {
+	store, cleanup := newTestGridFSStore(t)
+	defer cleanup()
+
+	store.Put("posts/1/a.mp3", []byte("0123456789"), "audio/mpeg")
+	handler := http.StripPrefix("/audio", store.Handler())
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/audio/posts/1/a.mp3", nil))
+
+	if w.Code != http.StatusOK || w.Header().Get("Content-Type") != "audio/mpeg" || w.Header().Get("Content-Length") != "10" {
+		t.Errorf("Unexpected response %d %v", w.Code, w.Header())
+	}
+
+	r := httptest.NewRequest("GET", "/audio/posts/1/a.mp3", nil)
+	r.Header.Set("Range", "bytes=2-4")
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+
+	if w.Code != http.StatusPartialContent || w.Body.String() != "234" || w.Header().Get("Content-Range") != "bytes 2-4/10" {
+		t.Errorf("Unexpected range response %d %q %v", w.Code, w.Body.String(), w.Header())
+	}
+
+	w = httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest("GET", "/audio/missing.mp3", nil))
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("Expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,180 @@
+package storage
+
+import (
+	"fmt"
+	"io/ioutil"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// LocalStore keeps blobs as files under Root, for the app itself to serve
+// at BaseURL with Handler.
+type LocalStore struct {
+	Root    string
+	BaseURL string
+}
+
+func NewLocalStore(root string, baseURL string) (*LocalStore, error) {
+	if err := os.MkdirAll(root, 0755); err != nil {
+		return nil, err
+	}
+
+	return &LocalStore{Root: root, BaseURL: strings.TrimRight(baseURL, "/")}, nil
+}
+
+// filename maps key to a file under Root, refusing keys that would escape it.
+func (s *LocalStore) filename(key string) (string, error) {
+	clean := path.Clean("/" + key)
+
+	if key == "" || clean != "/"+key {
+		return "", fmt.Errorf("Invalid key %q", key)
+	}
+
+	return filepath.Join(s.Root, filepath.FromSlash(clean)), nil
+}
+
+func (s *LocalStore) Put(key string, data []byte, contentType string) error {
+	filename, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.MkdirAll(filepath.Dir(filename), 0755); err != nil {
+		return err
+	}
+
+	// Write to a temporary file first so readers never see partial audio
+	tmp, err := ioutil.TempFile(filepath.Dir(filename), ".upload")
+	if err != nil {
+		return err
+	}
+
+	if _, err = tmp.Write(data); err != nil {
+		tmp.Close()
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = tmp.Close(); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	if err = os.Chmod(tmp.Name(), 0644); err != nil {
+		os.Remove(tmp.Name())
+		return err
+	}
+
+	return os.Rename(tmp.Name(), filename)
+}
+
+func (s *LocalStore) Get(key string) ([]byte, error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := ioutil.ReadFile(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (s *LocalStore) Delete(key string) error {
+	filename, err := s.filename(key)
+	if err != nil {
+		return err
+	}
+
+	if err = os.Remove(filename); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *LocalStore) Exists(key string) (bool, error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = os.Stat(filename)
+	if os.IsNotExist(err) {
+		return false, nil
+	}
+
+	return err == nil, err
+}
+
+func (s *LocalStore) PublicURL(key string) string {
+	return s.BaseURL + "/" + key
+}
+
+func (s *LocalStore) Open(key string) (*Blob, error) {
+	filename, err := s.filename(key)
+	if err != nil {
+		return nil, err
+	}
+
+	file, err := os.Open(filename)
+	if os.IsNotExist(err) {
+		return nil, ErrNotFound
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, err
+	}
+
+	if info.IsDir() {
+		file.Close()
+		return nil, ErrNotFound
+	}
+
+	return &Blob{
+		ReadSeeker:  file,
+		Closer:      file,
+		ContentType: mime.TypeByExtension(filepath.Ext(filename)),
+		ModTime:     info.ModTime(),
+		ETag:        fmt.Sprintf(`"%x-%x"`, info.ModTime().UnixNano(), info.Size()),
+	}, nil
+}
+
+// Handler serves the stored files, but not directory listings. Mount it
+// with the BaseURL path stripped.
+func (s *LocalStore) Handler() http.Handler {
+	return serveOpener(s)
+}
+
+// serveOpener serves the blobs of store by request path.
+func serveOpener(store Opener) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		key := strings.TrimPrefix(r.URL.Path, "/")
+
+		blob, err := store.Open(key)
+		if err != nil {
+			if err != ErrNotFound {
+				log.Println(err)
+			}
+
+			http.NotFound(w, r)
+			return
+		}
+		defer blob.Close()
+
+		Serve(w, r, key, blob)
+	})
+}
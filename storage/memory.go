@@ -0,0 +1,36 @@
+package storage
+
+import (
+	"launchpad.net/goamz/aws"
+	"launchpad.net/goamz/s3"
+	"launchpad.net/goamz/s3/s3test"
+)
+
+// MemoryStore is an S3Store backed by an in-process fake S3 server, for
+// tests. Close stops the server.
+type MemoryStore struct {
+	*S3Store
+	server *s3test.Server
+}
+
+// NewMemoryStore starts a fake S3 server with an empty bucket.
+func NewMemoryStore() (*MemoryStore, error) {
+	server, err := s3test.NewServer(nil)
+	if err != nil {
+		return nil, err
+	}
+
+	region := aws.Region{Name: "memory", S3Endpoint: server.URL(), S3LocationConstraint: true}
+	store := NewS3Store(aws.Auth{}, region, "rttm")
+
+	if err = store.Bucket.PutBucket(s3.Private); err != nil {
+		server.Quit()
+		return nil, err
+	}
+
+	return &MemoryStore{S3Store: store, server: server}, nil
+}
+
+func (s *MemoryStore) Close() {
+	s.server.Quit()
+}
@@ -0,0 +1,54 @@
+package storage
+
+import (
+	"encoding/json"
+)
+
+// Metadata describes a stored blob, e.g. the post and voice of an audio file.
+type Metadata map[string]string
+
+// MetadataStore is implemented by stores that can keep metadata alongside
+// a blob natively.
+type MetadataStore interface {
+	PutMetadata(key string, metadata Metadata) error
+	GetMetadata(key string) (Metadata, error)
+}
+
+// MetadataKey is where stores without native metadata keep that of key.
+func MetadataKey(key string) string {
+	return key + ".json"
+}
+
+// PutMetadata stores metadata for key, as a JSON object next to it unless
+// store supports metadata natively.
+func PutMetadata(store BlobStore, key string, metadata Metadata) error {
+	if m, ok := store.(MetadataStore); ok {
+		return m.PutMetadata(key, metadata)
+	}
+
+	b, err := json.Marshal(metadata)
+	if err != nil {
+		return err
+	}
+
+	return store.Put(MetadataKey(key), b, "application/json")
+}
+
+// GetMetadata returns the metadata stored for key by PutMetadata.
+func GetMetadata(store BlobStore, key string) (Metadata, error) {
+	if m, ok := store.(MetadataStore); ok {
+		return m.GetMetadata(key)
+	}
+
+	b, err := store.Get(MetadataKey(key))
+	if err != nil {
+		return nil, err
+	}
+
+	metadata := Metadata{}
+	if err = json.Unmarshal(b, &metadata); err != nil {
+		return nil, err
+	}
+
+	return metadata, nil
+}
@@ -0,0 +1,96 @@
+package storage
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"launchpad.net/goamz/aws"
+	"launchpad.net/goamz/s3"
+)
+
+// S3Store keeps blobs in an S3 bucket, or one on any S3-compatible server
+// such as MinIO.
+type S3Store struct {
+	Bucket *s3.Bucket
+}
+
+// NewS3Store returns a store for bucket in region.
+func NewS3Store(auth aws.Auth, region aws.Region, bucket string) *S3Store {
+	return &S3Store{Bucket: s3.New(auth, region).Bucket(bucket)}
+}
+
+// NewS3StoreFromEnv configures a store from AWS_S3_BUCKET_NAME, AWS_REGION
+// (us-east-1 by default) and, for S3-compatible servers, AWS_S3_ENDPOINT.
+func NewS3StoreFromEnv() (*S3Store, error) {
+	auth, err := aws.EnvAuth()
+	if err != nil {
+		return nil, err
+	}
+
+	region, err := s3Region(os.Getenv("AWS_REGION"), os.Getenv("AWS_S3_ENDPOINT"))
+	if err != nil {
+		return nil, err
+	}
+
+	return NewS3Store(auth, region, os.Getenv("AWS_S3_BUCKET_NAME")), nil
+}
+
+// s3Region looks up the named AWS region, or describes a custom one when an
+// endpoint is given. Buckets on custom endpoints are addressed by path.
+func s3Region(name string, endpoint string) (aws.Region, error) {
+	if endpoint != "" {
+		if name == "" {
+			name = "custom"
+		}
+
+		return aws.Region{Name: name, S3Endpoint: strings.TrimRight(endpoint, "/")}, nil
+	}
+
+	if name == "" {
+		return aws.USEast, nil
+	}
+
+	region, ok := aws.Regions[name]
+	if !ok {
+		return aws.Region{}, fmt.Errorf("Unknown AWS region %q", name)
+	}
+
+	return region, nil
+}
+
+func (s *S3Store) Put(key string, data []byte, contentType string) error {
+	return s.Bucket.Put(key, data, contentType, s3.PublicRead)
+}
+
+func (s *S3Store) Get(key string) ([]byte, error) {
+	data, err := s.Bucket.Get(key)
+	if isNotFound(err) {
+		return nil, ErrNotFound
+	}
+
+	return data, err
+}
+
+func (s *S3Store) Delete(key string) error {
+	return s.Bucket.Del(key)
+}
+
+func (s *S3Store) Exists(key string) (bool, error) {
+	result, err := s.Bucket.List(key, "", "", 1)
+	if err != nil {
+		return false, err
+	}
+
+	return len(result.Contents) > 0 && result.Contents[0].Key == key, nil
+}
+
+func (s *S3Store) PublicURL(key string) string {
+	return s.Bucket.URL(key)
+}
+
+func isNotFound(err error) bool {
+	s3err, ok := err.(*s3.Error)
+	return ok && s3err.StatusCode == http.StatusNotFound
+}
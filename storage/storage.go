@@ -0,0 +1,73 @@
+// Package storage keeps generated audio in a pluggable blob store.
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path"
+	"time"
+)
+
+// ErrNotFound is returned when a key does not exist in a store.
+var ErrNotFound = errors.New("storage: not found")
+
+// BlobStore stores publicly readable blobs by key.
+type BlobStore interface {
+	Put(key string, data []byte, contentType string) error
+	Get(key string) ([]byte, error)
+	Delete(key string) error
+	Exists(key string) (bool, error)
+	PublicURL(key string) string
+}
+
+// Blob is a stored blob opened for streaming.
+type Blob struct {
+	io.ReadSeeker
+	io.Closer
+	ContentType string
+	ModTime     time.Time
+	ETag        string
+}
+
+// Opener is implemented by stores the app serves itself, which can open a
+// blob for streaming instead of reading it into memory.
+type Opener interface {
+	Open(key string) (*Blob, error)
+}
+
+// Serve writes blob in response to r. It answers HEAD, Range, If-Range and
+// conditional requests, streaming only the requested bytes.
+func Serve(w http.ResponseWriter, r *http.Request, key string, blob *Blob) {
+	if blob.ContentType != "" {
+		w.Header().Set("Content-Type", blob.ContentType)
+	}
+
+	if blob.ETag != "" {
+		w.Header().Set("ETag", blob.ETag)
+	}
+
+	http.ServeContent(w, r, path.Base(key), blob.ModTime, blob)
+}
+
+// New returns the store named by name, configured from the environment:
+// "s3" (the default) or "local", which keeps files under STORAGE_LOCAL_PATH
+// to be served at mediaURL. The "gridfs" backend needs the app's database
+// and is created with NewGridFSStore instead.
+func New(name string, mediaURL string) (BlobStore, error) {
+	switch name {
+	case "", "s3":
+		return NewS3StoreFromEnv()
+	case "local":
+		root := os.Getenv("STORAGE_LOCAL_PATH")
+		if root == "" {
+			root = "media"
+		}
+
+		return NewLocalStore(root, mediaURL)
+	}
+
+	return nil, fmt.Errorf("Unknown storage backend %q", name)
+}
@@ -0,0 +1,228 @@
+package storage
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+	"time"
+)
+
+// testBlobStore checks the behavior every BlobStore must share.
+func testBlobStore(t *testing.T, store BlobStore) {
+	key := "posts/1/audio.mp3"
+	data := []byte("ID3 not really audio")
+
+	if ok, err := store.Exists(key); ok || err != nil {
+		t.Errorf("Expected missing key, got %v %v", ok, err)
+	}
+
+	if _, err := store.Get(key); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+
+	if err := store.Put(key, data, "audio/mpeg"); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := store.Exists(key); !ok || err != nil {
+		t.Errorf("Expected existing key, got %v %v", ok, err)
+	}
+
+	if ok, _ := store.Exists("posts/1/audio"); ok {
+		t.Error("Expected a prefix of a key not to exist")
+	}
+
+	if got, err := store.Get(key); err != nil || !bytes.Equal(got, data) {
+		t.Errorf("Expected %q, got %q %v", data, got, err)
+	}
+
+	if err := store.Delete(key); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, err := store.Exists(key); ok || err != nil {
+		t.Errorf("Expected deleted key, got %v %v", ok, err)
+	}
+}
+
+func TestMemoryStore(t *testing.T) {
+	store, err := NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	testBlobStore(t, store)
+}
+
+func TestLocalStore(t *testing.T) {
+	root, err := ioutil.TempDir("", "rttm-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store, err := NewLocalStore(root, "http://example.com/media/")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	testBlobStore(t, store)
+
+	if url := store.PublicURL("posts/1/a.mp3"); url != "http://example.com/media/posts/1/a.mp3" {
+		t.Errorf("Unexpected URL %s", url)
+	}
+
+	for _, key := range []string{"", "../escape", "posts/../../escape", "/absolute"} {
+		if err := store.Put(key, nil, "audio/mpeg"); err == nil {
+			t.Errorf("Expected key %q to be rejected", key)
+		}
+	}
+}
+
+func TestLocalStoreHandler(t *testing.T) {
+	root, err := ioutil.TempDir("", "rttm-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store, _ := NewLocalStore(root, "/media")
+	store.Put("posts/1/a.mp3", []byte("audio"), "audio/mpeg")
+
+	handler := http.StripPrefix("/media", store.Handler())
+
+	tests := map[string]int{
+		"/media/posts/1/a.mp3": http.StatusOK,
+		"/media/posts/1/":      http.StatusNotFound,
+		"/media/missing.mp3":   http.StatusNotFound,
+	}
+
+	for path, expected := range tests {
+		w := httptest.NewRecorder()
+		handler.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+
+		if w.Code != expected {
+			t.Errorf("%s: expected %d, got %d", path, expected, w.Code)
+		}
+	}
+}
+
+func TestS3Region(t *testing.T) {
+	tests := []struct {
+		name, endpoint      string
+		expectedName, s3URL string
+	}{
+		{"", "", "us-east-1", "https://s3.amazonaws.com"},
+		{"eu-west-1", "", "eu-west-1", "https://s3-eu-west-1.amazonaws.com"},
+		{"", "http://minio:9000/", "custom", "http://minio:9000"},
+		{"us-west-2", "http://minio:9000", "us-west-2", "http://minio:9000"},
+	}
+
+	for _, test := range tests {
+		region, err := s3Region(test.name, test.endpoint)
+
+		if err != nil || region.Name != test.expectedName || region.S3Endpoint != test.s3URL {
+			t.Errorf("s3Region(%q, %q) = %+v %v", test.name, test.endpoint, region, err)
+		}
+	}
+
+	if _, err := s3Region("mars-1", ""); err == nil {
+		t.Error("Expected an unknown region to fail")
+	}
+}
+
+func TestMetadataSidecar(t *testing.T) {
+	store, err := NewMemoryStore()
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	if err = PutMetadata(store, "a.mp3", Metadata{"voice": "Joey"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if ok, _ := store.Exists(MetadataKey("a.mp3")); !ok {
+		t.Error("Expected metadata next to the blob")
+	}
+
+	metadata, err := GetMetadata(store, "a.mp3")
+	if err != nil || metadata["voice"] != "Joey" {
+		t.Errorf("Unexpected metadata %v %v", metadata, err)
+	}
+
+	if _, err = GetMetadata(store, "b.mp3"); err != ErrNotFound {
+		t.Errorf("Expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestServe(t *testing.T) {
+	root, err := ioutil.TempDir("", "rttm-storage")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	store, _ := NewLocalStore(root, "/media")
+	store.Put("a.mp3", []byte("0123456789"), "audio/mpeg")
+
+	blob, err := store.Open("a.mp3")
+	if err != nil {
+		t.Fatal(err)
+	}
+	blob.Close()
+
+	tests := []struct {
+		method  string
+		headers map[string]string
+		status  int
+		body    string
+	}{
+		{"GET", nil, http.StatusOK, "0123456789"},
+		{"HEAD", nil, http.StatusOK, ""},
+		{"GET", map[string]string{"Range": "bytes=2-4"}, http.StatusPartialContent, "234"},
+		{"GET", map[string]string{"Range": "bytes=8-"}, http.StatusPartialContent, "89"},
+		{"GET", map[string]string{"Range": "bytes=2-4", "If-Range": blob.ETag}, http.StatusPartialContent, "234"},
+		{"GET", map[string]string{"Range": "bytes=2-4", "If-Range": `"stale"`}, http.StatusOK, "0123456789"},
+		{"GET", map[string]string{"If-None-Match": blob.ETag}, http.StatusNotModified, ""},
+		{"GET", map[string]string{"If-None-Match": `"stale"`}, http.StatusOK, "0123456789"},
+		{"GET", map[string]string{"If-Modified-Since": blob.ModTime.Add(time.Minute).UTC().Format(http.TimeFormat)}, http.StatusNotModified, ""},
+	}
+
+	for _, test := range tests {
+		blob, _ := store.Open("a.mp3")
+
+		r := httptest.NewRequest(test.method, "/media/a.mp3", nil)
+		for name, value := range test.headers {
+			r.Header.Set(name, value)
+		}
+
+		w := httptest.NewRecorder()
+		Serve(w, r, "a.mp3", blob)
+		blob.Close()
+
+		if w.Code != test.status || w.Body.String() != test.body {
+			t.Errorf("%s %v: expected %d %q, got %d %q", test.method, test.headers, test.status, test.body, w.Code, w.Body.String())
+		}
+
+		if w.Code == http.StatusOK && (w.Header().Get("ETag") != blob.ETag || w.Header().Get("Content-Type") != "audio/mpeg" || w.Header().Get("Accept-Ranges") != "bytes") {
+			t.Errorf("%s %v: unexpected headers %v", test.method, test.headers, w.Header())
+		}
+	}
+
+	blob, _ = store.Open("a.mp3")
+	defer blob.Close()
+
+	r := httptest.NewRequest("GET", "/media/a.mp3", nil)
+	r.Header.Set("Range", "bytes=20-")
+	w := httptest.NewRecorder()
+	Serve(w, r, "a.mp3", blob)
+
+	if w.Code != http.StatusRequestedRangeNotSatisfiable || w.Header().Get("Content-Range") != "bytes */10" {
+		t.Errorf("Expected an unsatisfiable range, got %d %v", w.Code, w.Header())
+	}
+}
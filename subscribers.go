@@ -0,0 +1,49 @@
+package main
+
+import (
+	"time"
+
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+// Subscriber holds the settings a phone number chose over SMS. Voice is only
+// read for numbers without a User; see MigrateUsers.
+type Subscriber struct {
+	Phone     string `bson:"_id"`
+	OptedOut  bool
+	Voice     string
+	UpdatedAt time.Time
+}
+
+// GetSubscriber returns the settings for phone, or defaults when it never
+// changed any.
+func GetSubscriber(phone string) (*Subscriber, error) {
+	subscriber := &Subscriber{}
+	err := SubscriberCollection.FindId(phone).One(&subscriber)
+
+	if err == mgo.ErrNotFound {
+		return &Subscriber{Phone: phone}, nil
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	return subscriber, nil
+}
+
+func SetSubscriber(phone string, fields bson.M) error {
+	fields["updatedat"] = time.Now()
+	_, err := SubscriberCollection.UpsertId(phone, bson.M{"$set": fields})
+
+	return err
+}
+
+// FindRecentRequestsByPhone returns the last n articles requested by
+// phone, newest first, with their posts. Like the feed, an article requested
+// more than once is listed once, and articles whose post is gone are left
+// out.
+func FindRecentRequestsByPhone(phone string, n int) ([]Request, error) {
+	return findRequests(bson.M{"phone": phone}, 0, n)
+}
@@ -0,0 +1,87 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha1"
+	"encoding/base64"
+	"log"
+	"net/http"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+)
+
+const twilioSignatureHeader = "X-Twilio-Signature"
+
+// TwilioSignature computes the signature Twilio sends for a POST to
+// requestURL with params: the base64 HMAC-SHA1 of the URL followed by every
+// parameter name and value, sorted by name.
+func TwilioSignature(authToken string, requestURL string, params url.Values) string {
+	keys := make([]string, 0, len(params))
+	for k := range params {
+		keys = append(keys, k)
+	}
+	sort.Strings(keys)
+
+	data := requestURL
+	for _, k := range keys {
+		values := append([]string{}, params[k]...)
+		sort.Strings(values)
+
+		for _, v := range values {
+			data += k + v
+		}
+	}
+
+	mac := hmac.New(sha1.New, []byte(authToken))
+	mac.Write([]byte(data))
+
+	return base64.StdEncoding.EncodeToString(mac.Sum(nil))
+}
+
+// twilioRequestURL returns the public URL Twilio posted to. Behind a proxy
+// r.URL lacks the scheme and host, so TWILIO_WEBHOOK_BASE_URL may be set to
+// e.g. https://rttm.herokuapp.com; otherwise it is rebuilt from the Host
+// and X-Forwarded-Proto headers.
+func twilioRequestURL(r *http.Request) string {
+	if base := os.Getenv("TWILIO_WEBHOOK_BASE_URL"); base != "" {
+		return strings.TrimRight(base, "/") + r.URL.RequestURI()
+	}
+
+	scheme := "http"
+	if r.TLS != nil {
+		scheme = "https"
+	}
+
+	if proto := r.Header.Get("X-Forwarded-Proto"); proto != "" {
+		scheme = strings.TrimSpace(strings.Split(proto, ",")[0])
+	}
+
+	return scheme + "://" + r.Host + r.URL.RequestURI()
+}
+
+// RequireTwilioSignature rejects webhook requests not signed by Twilio with
+// TWILIO_AUTH_TOKEN.
+func RequireTwilioSignature(h http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		authToken := os.Getenv("TWILIO_AUTH_TOKEN")
+		signature := r.Header.Get(twilioSignatureHeader)
+
+		if err := r.ParseForm(); err != nil {
+			renderError(w, err)
+			return
+		}
+
+		expected := TwilioSignature(authToken, twilioRequestURL(r), r.PostForm)
+
+		if authToken == "" || !hmac.Equal([]byte(signature), []byte(expected)) {
+			twilioSignatureFailures.Add(1)
+			log.Println("Invalid Twilio signature for", twilioRequestURL(r))
+			http.Error(w, "Invalid signature", http.StatusForbidden)
+			return
+		}
+
+		h(w, r)
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"strings"
+	"testing"
+)
+
+var twilioTestParams = url.Values{
+	"CallSid": {"CA1234567890ABCDE"},
+	"Caller":  {"+12349013030"},
+	"Digits":  {"1234"},
+	"From":    {"+12349013030"},
+	"To":      {"+18005551212"},
+}
+
+func TestTwilioSignature(t *testing.T) {
+	signature := TwilioSignature("12345", "https://mycompany.com/myapp.php?foo=1&bar=2", twilioTestParams)
+
+	if signature != "0/KCTR6DLpKmkAf8muzZqo1nDgQ=" {
+		t.Errorf("Unexpected signature %s", signature)
+	}
+}
+
+func TestRequireTwilioSignature(t *testing.T) {
+	os.Setenv("TWILIO_AUTH_TOKEN", "12345")
+	os.Setenv("TWILIO_WEBHOOK_BASE_URL", "")
+	defer os.Setenv("TWILIO_AUTH_TOKEN", "")
+
+	called := false
+	handler := RequireTwilioSignature(func(w http.ResponseWriter, r *http.Request) {
+		called = true
+	})
+
+	newRequest := func(signature string) *http.Request {
+		r, _ := http.NewRequest("POST", "/twilio/callback?foo=1", strings.NewReader(twilioTestParams.Encode()))
+		r.Host = "rttm.herokuapp.com"
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("X-Forwarded-Proto", "https")
+		r.Header.Set(twilioSignatureHeader, signature)
+		return r
+	}
+
+	failures := twilioSignatureFailures.Value()
+	w := httptest.NewRecorder()
+	handler(w, newRequest("forged"))
+
+	if called || w.Code != http.StatusForbidden || twilioSignatureFailures.Value() != failures+1 {
+		t.Errorf("Expected forged request to be rejected, got %d", w.Code)
+	}
+
+	signature := TwilioSignature("12345", "https://rttm.herokuapp.com/twilio/callback?foo=1", twilioTestParams)
+	w = httptest.NewRecorder()
+	handler(w, newRequest(signature))
+
+	if !called {
+		t.Errorf("Expected signed request to be accepted, got %d", w.Code)
+	}
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"math/big"
+	"strings"
+	"time"
+
+	"github.com/jpadilla/rttm/services"
+	"gopkg.in/mgo.v2"
+	"gopkg.in/mgo.v2/bson"
+)
+
+const (
+	loginCodeLength      = 6
+	loginCodeExpiry      = 10 * time.Minute
+	loginCodeMaxAttempts = 5
+
+	feedTokenSize = 16
+)
+
+var errInvalidCode = errors.New("Invalid or expired code")
+
+// User owns one or more phone numbers along with their feed and preferences.
+type User struct {
+	Id         bson.ObjectId `bson:"_id"`
+	Email      string
+	Phones     []Phone
+	Voice      string
+	SpeechRate string
+	FeedToken  string `bson:",omitempty"`
+	FeedTitle  string
+	FeedLimit  int
+	CreatedAt  time.Time
+	UpdatedAt  time.Time
+}
+
+// Phone is a number owned by a User once verified over SMS.
+type Phone struct {
+	Number     string
+	Verified   bool
+	VerifiedAt time.Time
+}
+
+// LoginCode is a one-time code sent over SMS to sign in as, or verify
+// ownership of, Phone. Only its hash is stored.
+type LoginCode struct {
+	Id        bson.ObjectId `bson:"_id"`
+	Phone     string
+	Hash      string
+	UserId    bson.ObjectId `bson:"user_id,omitempty"`
+	Attempts  int
+	ExpiresAt time.Time
+	CreatedAt time.Time
+}
+
+func GetUserById(id bson.ObjectId) (*User, error) {
+	user := &User{}
+	err := UserCollection.FindId(id).One(&user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// GetUserByPhone returns the user owning the verified number phone.
+func GetUserByPhone(phone string) (*User, error) {
+	user := &User{}
+	err := UserCollection.Find(bson.M{"phones": bson.M{"$elemMatch": bson.M{"number": phone, "verified": true}}}).One(&user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// FindOrCreateUserByPhone returns the owner of phone, creating a user for it
+// when there is none. Callers must have verified the number, e.g. because
+// it came from Twilio or was confirmed with a LoginCode.
+func FindOrCreateUserByPhone(phone string) (*User, error) {
+	user, err := GetUserByPhone(phone)
+
+	if err != mgo.ErrNotFound {
+		return user, err
+	}
+
+	now := time.Now()
+	user = &User{
+		Id:        bson.NewObjectId(),
+		Phones:    []Phone{{Number: phone, Verified: true, VerifiedAt: now}},
+		CreatedAt: now,
+		UpdatedAt: now,
+	}
+
+	if err = UserCollection.Insert(user); err != nil {
+		log.Println(err)
+		return nil, err
+	}
+
+	if err = linkRequests(phone, user.Id); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// linkRequests gives the requests phone made before it had an owner to
+// userId, so they show up in the owner's feed.
+func linkRequests(phone string, userId bson.ObjectId) error {
+	_, err := RequestCollection.UpdateAll(
+		bson.M{"phone": phone, "user_id": bson.M{"$exists": false}},
+		bson.M{"$set": bson.M{"user_id": userId}},
+	)
+
+	return err
+}
+
+// AddPhone records phone as a verified number of the user.
+func (u *User) AddPhone(phone string) error {
+	if owner, err := GetUserByPhone(phone); err == nil && owner.Id != u.Id {
+		return fmt.Errorf("%s belongs to another account", phone)
+	}
+
+	for _, p := range u.Phones {
+		if p.Number == phone {
+			return nil
+		}
+	}
+
+	p := Phone{Number: phone, Verified: true, VerifiedAt: time.Now()}
+	u.Phones = append(u.Phones, p)
+
+	if err := UserCollection.UpdateId(u.Id, bson.M{"$push": bson.M{"phones": p}}); err != nil {
+		return err
+	}
+
+	return linkRequests(phone, u.Id)
+}
+
+// Numbers returns the user's verified phone numbers.
+func (u *User) Numbers() []string {
+	var numbers []string
+
+	for _, p := range u.Phones {
+		if p.Verified {
+			numbers = append(numbers, p.Number)
+		}
+	}
+
+	return numbers
+}
+
+// Update saves the user's email, preferences and feed settings.
+func (u *User) Update() error {
+	u.Email = strings.TrimSpace(u.Email)
+	u.UpdatedAt = time.Now()
+
+	return UserCollection.UpdateId(u.Id, bson.M{"$set": bson.M{
+		"email":      u.Email,
+		"voice":      u.Voice,
+		"speechrate": u.SpeechRate,
+		"feedtitle":  u.FeedTitle,
+		"feedlimit":  u.FeedLimit,
+		"updatedat":  u.UpdatedAt,
+	}})
+}
+
+// speechOptionsForPhone returns the voice and rate preferred by the owner
+// of phone, falling back to a voice chosen over SMS before accounts existed.
+func speechOptionsForPhone(phone string) (services.SpeechOptions, error) {
+	user, err := GetUserByPhone(phone)
+
+	if err == nil {
+		return services.SpeechOptions{Voice: user.Voice, Rate: user.SpeechRate}, nil
+	}
+
+	if err != mgo.ErrNotFound {
+		return services.SpeechOptions{}, err
+	}
+
+	subscriber, err := GetSubscriber(phone)
+	if err != nil {
+		return services.SpeechOptions{}, err
+	}
+
+	return services.SpeechOptions{Voice: subscriber.Voice}, nil
+}
+
+// GetUserByFeedToken returns the user whose private feed is at token.
+func GetUserByFeedToken(token string) (*User, error) {
+	user := &User{}
+	err := UserCollection.Find(bson.M{"feedtoken": token}).One(&user)
+
+	if err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+func generateFeedToken() (string, error) {
+	b := make([]byte, feedTokenSize)
+
+	if _, err := rand.Read(b); err != nil {
+		return "", err
+	}
+
+	return hex.EncodeToString(b), nil
+}
+
+// RotateFeedToken gives the user a new private feed URL, so that the old
+// one stops working.
+func (u *User) RotateFeedToken() error {
+	token, err := generateFeedToken()
+	if err != nil {
+		return err
+	}
+
+	if err = UserCollection.UpdateId(u.Id, bson.M{"$set": bson.M{"feedtoken": token}}); err != nil {
+		return err
+	}
+
+	u.FeedToken = token
+	return nil
+}
+
+// FeedURL returns the user's private feed URL, creating its token the first
+// time it is needed.
+func (u *User) FeedURL() (string, error) {
+	if u.FeedToken == "" {
+		if err := u.RotateFeedToken(); err != nil {
+			return "", err
+		}
+	}
+
+	return siteURL() + "/feed/" + u.FeedToken, nil
+}
+
+func hashLoginCode(code string) string {
+	sum := sha256.Sum256([]byte(code))
+	return hex.EncodeToString(sum[:])
+}
+
+func generateLoginCode() (string, error) {
+	max := big.NewInt(1)
+	for i := 0; i < loginCodeLength; i++ {
+		max.Mul(max, big.NewInt(10))
+	}
+
+	n, err := rand.Int(rand.Reader, max)
+	if err != nil {
+		return "", err
+	}
+
+	return fmt.Sprintf("%0*d", loginCodeLength, n), nil
+}
+
+// CreateLoginCode stores a new code for phone, replacing earlier ones, and
+// returns it so it can be sent. userId is set when an existing user is
+// adding phone to their account.
+func CreateLoginCode(phone string, userId bson.ObjectId) (string, error) {
+	code, err := generateLoginCode()
+	if err != nil {
+		return "", err
+	}
+
+	if _, err = LoginCodeCollection.RemoveAll(bson.M{"phone": phone}); err != nil {
+		return "", err
+	}
+
+	now := time.Now()
+	loginCode := &LoginCode{
+		Id:        bson.NewObjectId(),
+		Phone:     phone,
+		Hash:      hashLoginCode(code),
+		UserId:    userId,
+		ExpiresAt: now.Add(loginCodeExpiry),
+		CreatedAt: now,
+	}
+
+	if err = LoginCodeCollection.Insert(loginCode); err != nil {
+		return "", err
+	}
+
+	return code, nil
+}
+
+// VerifyLoginCode checks code for phone and returns the user it signs in:
+// the user who asked to add phone, or else its owner, created if needed.
+func VerifyLoginCode(phone string, code string) (*User, error) {
+	loginCode := &LoginCode{}
+	err := LoginCodeCollection.Find(bson.M{"phone": phone, "expiresat": bson.M{"$gt": time.Now()}}).One(&loginCode)
+
+	if err == mgo.ErrNotFound {
+		return nil, errInvalidCode
+	}
+
+	if err != nil {
+		return nil, err
+	}
+
+	if loginCode.Attempts >= loginCodeMaxAttempts {
+		return nil, errInvalidCode
+	}
+
+	if loginCode.Hash != hashLoginCode(strings.TrimSpace(code)) {
+		LoginCodeCollection.UpdateId(loginCode.Id, bson.M{"$inc": bson.M{"attempts": 1}})
+		return nil, errInvalidCode
+	}
+
+	if err = LoginCodeCollection.RemoveId(loginCode.Id); err != nil {
+		return nil, err
+	}
+
+	if !loginCode.UserId.Valid() {
+		return FindOrCreateUserByPhone(phone)
+	}
+
+	user, err := GetUserById(loginCode.UserId)
+	if err != nil {
+		return nil, err
+	}
+
+	if err = user.AddPhone(phone); err != nil {
+		return nil, err
+	}
+
+	return user, nil
+}
+
+// MigrateUsers creates a user for every phone found in requests and links
+// the requests to it, carrying over any voice chosen over SMS.
+func MigrateUsers() (int, error) {
+	var phones []string
+
+	if err := RequestCollection.Find(nil).Distinct("phone", &phones); err != nil {
+		return 0, err
+	}
+
+	for _, phone := range phones {
+		// Requests made through the API have no phone
+		if phone == "" {
+			continue
+		}
+
+		user, err := FindOrCreateUserByPhone(phone)
+		if err != nil {
+			return 0, err
+		}
+
+		subscriber, err := GetSubscriber(phone)
+		if err == nil && subscriber.Voice != "" && user.Voice == "" {
+			user.Voice = subscriber.Voice
+
+			if err = user.Update(); err != nil {
+				return 0, err
+			}
+		}
+
+		if err = linkRequests(phone, user.Id); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(phones), nil
+}
@@ -0,0 +1,222 @@
+package main
+
+import (
+	"regexp"
+	"testing"
+	"time"
+
+	"gopkg.in/mgo.v2/bson"
+)
+
+func TestGenerateLoginCode(t *testing.T) {
+	seen := map[string]bool{}
+
+	for i := 0; i < 20; i++ {
+		code, err := generateLoginCode()
+		if err != nil {
+			t.Fatal(err)
+		}
+
+		if !regexp.MustCompile(`^[0-9]{6}$`).MatchString(code) {
+			t.Errorf("Expected six digits, got %q", code)
+		}
+
+		seen[code] = true
+	}
+
+	if len(seen) < 2 {
+		t.Error("Expected codes to differ")
+	}
+}
+
+func TestHashLoginCode(t *testing.T) {
+	if hashLoginCode("123456") != hashLoginCode("123456") {
+		t.Error("Expected the same hash for the same code")
+	}
+
+	if hashLoginCode("123456") == hashLoginCode("123457") {
+		t.Error("Expected different hashes for different codes")
+	}
+}
+
+func TestUserNumbers(t *testing.T) {
+	user := &User{Phones: []Phone{
+		{Number: "+15551234567", Verified: true, VerifiedAt: time.Now()},
+		{Number: "+15557654321"},
+	}}
+
+	numbers := user.Numbers()
+
+	if len(numbers) != 1 || numbers[0] != "+15551234567" {
+		t.Errorf("Expected only the verified number, got %v", numbers)
+	}
+}
+
+func TestGenerateFeedToken(t *testing.T) {
+	token, err := generateFeedToken()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(token) != 2*feedTokenSize || isPhoneNumber(token) {
+		t.Errorf("Unexpected token %q", token)
+	}
+
+	if other, _ := generateFeedToken(); other == token {
+		t.Error("Expected tokens to differ")
+	}
+}
+
+// insertRequest records a request from phone that has no user yet.
+func insertRequest(t *testing.T, phone string) bson.ObjectId {
+	id := bson.NewObjectId()
+
+	if err := RequestCollection.Insert(&Request{Id: id, PostId: bson.NewObjectId(), Phone: phone, CreatedAt: time.Now()}); err != nil {
+		t.Fatal(err)
+	}
+
+	return id
+}
+
+// requestOwner returns the user_id of the request with id.
+func requestOwner(t *testing.T, id bson.ObjectId) bson.ObjectId {
+	request := &Request{}
+
+	if err := RequestCollection.FindId(id).One(request); err != nil {
+		t.Fatal(err)
+	}
+
+	return request.UserId
+}
+
+func TestAddPhone(t *testing.T) {
+	defer withTestDB(t)()
+
+	before := insertRequest(t, "+15555550101")
+
+	user, err := FindOrCreateUserByPhone("+15555550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = user.AddPhone("+15555550101"); err != nil {
+		t.Fatal(err)
+	}
+
+	if owner := requestOwner(t, before); owner != user.Id {
+		t.Errorf("Expected the earlier request to be linked to %s, got %q", user.Id.Hex(), owner)
+	}
+
+	if owner, err := GetUserByPhone("+15555550101"); err != nil || owner.Id != user.Id {
+		t.Errorf("Expected the number to belong to the user, got %v %v", owner, err)
+	}
+
+	other, err := FindOrCreateUserByPhone("+15555550102")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err = other.AddPhone("+15555550101"); err == nil {
+		t.Error("Expected another user's number to be refused")
+	}
+}
+
+func TestVerifyLoginCode(t *testing.T) {
+	defer withTestDB(t)()
+
+	phone := "+15555550100"
+	before := insertRequest(t, phone)
+
+	code, err := CreateLoginCode(phone, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err = VerifyLoginCode(phone, "000000x"); err != errInvalidCode {
+		t.Errorf("Expected errInvalidCode for a wrong code, got %v", err)
+	}
+
+	user, err := VerifyLoginCode(phone, code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if owner := requestOwner(t, before); owner != user.Id {
+		t.Errorf("Expected the earlier request to be linked to the new user, got %q", owner)
+	}
+
+	if _, err = VerifyLoginCode(phone, code); err != errInvalidCode {
+		t.Errorf("Expected a used code to be refused, got %v", err)
+	}
+
+	// A code sent to add a number signs in the user who asked for it
+	code, err = CreateLoginCode("+15555550101", user.Id)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	added, err := VerifyLoginCode("+15555550101", code)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if added.Id != user.Id || len(added.Numbers()) != 2 {
+		t.Errorf("Expected the number to be added to %s, got %+v", user.Id.Hex(), added)
+	}
+
+	// Too many wrong guesses use the code up
+	code, err = CreateLoginCode(phone, "")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	for i := 0; i < loginCodeMaxAttempts; i++ {
+		VerifyLoginCode(phone, "000000x")
+	}
+
+	if _, err = VerifyLoginCode(phone, code); err != errInvalidCode {
+		t.Errorf("Expected the code to be locked after %d attempts, got %v", loginCodeMaxAttempts, err)
+	}
+}
+
+func TestMigrateUsers(t *testing.T) {
+	defer withTestDB(t)()
+
+	first := insertRequest(t, "+15555550100")
+	second := insertRequest(t, "+15555550100")
+	api := insertRequest(t, "")
+
+	if err := SetSubscriber("+15555550100", bson.M{"voice": "Joey"}); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := MigrateUsers(); err != nil {
+		t.Fatal(err)
+	}
+
+	user, err := GetUserByPhone("+15555550100")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if user.Voice != "Joey" {
+		t.Errorf("Expected the SMS voice to carry over, got %q", user.Voice)
+	}
+
+	if requestOwner(t, first) != user.Id || requestOwner(t, second) != user.Id {
+		t.Error("Expected the phone's requests to be linked to its user")
+	}
+
+	if requestOwner(t, api) != "" {
+		t.Error("Expected API requests to be left alone")
+	}
+
+	// Running it again changes nothing
+	if _, err := MigrateUsers(); err != nil {
+		t.Fatal(err)
+	}
+
+	if n, _ := UserCollection.Count(); n != 1 {
+		t.Errorf("Expected 1 user, got %d", n)
+	}
+}
@@ -2,9 +2,13 @@ package main
 
 import (
 	"net/url"
+	"os"
+	"regexp"
 	"strings"
 )
 
+var phoneNumberPattern = regexp.MustCompile(`^\+?[0-9]{7,15}$`)
+
 func IsValidURL(str string) bool {
 	u, err := url.Parse(str)
 
@@ -23,6 +27,11 @@ func IsValidURL(str string) bool {
 	return true
 }
 
+// isPhoneNumber reports whether str looks like an E.164 phone number.
+func isPhoneNumber(str string) bool {
+	return phoneNumberPattern.MatchString(str)
+}
+
 func SmartTruncate(str string, length int, suffix string) string {
 	if len(str) <= length {
 		return str
@@ -32,3 +41,12 @@ func SmartTruncate(str string, length int, suffix string) string {
 
 	return strings.Join(splitted[:len(splitted)-1], " ") + suffix
 }
+
+// siteURL is the public base URL of the app, without a trailing slash.
+func siteURL() string {
+	if u := os.Getenv("SITE_URL"); u != "" {
+		return strings.TrimRight(u, "/")
+	}
+
+	return "http://rttm.herokuapp.com"
+}
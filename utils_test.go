@@ -13,3 +13,21 @@ func TestSmartTruncate(t *testing.T) {
 		t.Error("Sentences does not match expected string")
 	}
 }
+
+func TestIsPhoneNumber(t *testing.T) {
+	tests := map[string]bool{
+		"+15551234567":                     true,
+		"15551234567":                      true,
+		"5551234":                          true,
+		"555":                              false,
+		"+1 555 123 4567":                  false,
+		"0123456789abcdef0123456789abcdef": false,
+		"":                                 false,
+	}
+
+	for str, expected := range tests {
+		if isPhoneNumber(str) != expected {
+			t.Errorf("isPhoneNumber(%q) should be %v", str, expected)
+		}
+	}
+}
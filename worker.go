@@ -0,0 +1,76 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"gopkg.in/mgo.v2"
+)
+
+const defaultWorkerPollInterval = 2 * time.Second
+
+// RunWorker claims and runs queued jobs until the process exits.
+// WORKER_CONCURRENCY sets the number of jobs processed at once.
+func RunWorker() {
+	concurrency := 2
+	if n, err := strconv.Atoi(os.Getenv("WORKER_CONCURRENCY")); err == nil && n > 0 {
+		concurrency = n
+	}
+
+	hostname, _ := os.Hostname()
+	owner := fmt.Sprintf("%s:%d", hostname, os.Getpid())
+
+	log.Printf("INFO: Worker %s processing jobs with concurrency %d", owner, concurrency)
+
+	var wg sync.WaitGroup
+
+	for i := 0; i < concurrency; i++ {
+		wg.Add(1)
+
+		go func() {
+			defer wg.Done()
+
+			for {
+				if !processNextJob(owner) {
+					time.Sleep(defaultWorkerPollInterval)
+				}
+			}
+		}()
+	}
+
+	wg.Wait()
+}
+
+// processNextJob runs a single job and reports whether one was found.
+func processNextJob(owner string) bool {
+	job, err := ClaimJob(owner, defaultJobLease)
+
+	if err == mgo.ErrNotFound {
+		return false
+	}
+
+	if err != nil {
+		log.Println("Error claiming job", err)
+		return false
+	}
+
+	log.Printf("Job %s claimed, attempt %d of %d", job.Id.Hex(), job.Attempts, job.MaxAttempts)
+
+	release := job.holdLease(defaultJobLease)
+	err = job.Run()
+	release()
+
+	if err == errLeaseLost {
+		log.Printf("Job %s: %s", job.Id.Hex(), err)
+	} else if err != nil {
+		if err = job.Fail(err); err != nil {
+			log.Println("Error failing job", err)
+		}
+	}
+
+	return true
+}